@@ -0,0 +1,82 @@
+// Package access holds the middleware checking the role of the signed in
+// account grants the permission of the api route called.
+package access
+
+import (
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/yleemj/dockerMan/app/auth"
+	"github.com/yleemj/dockerMan/app/manager"
+)
+
+const (
+	// Any lets every signed in account call the route
+	Any = "*"
+)
+
+var (
+	logger = logrus.New()
+)
+
+// AccessRequired rejects requests to api routes the role of the account
+// does not permit. Routes without a permission require accounts:manage, so
+// only admins can call them.
+type AccessRequired struct {
+	manager     *manager.Manager
+	auth        *auth.AuthRequired
+	router      *mux.Router
+	permissions map[*mux.Route]string
+}
+
+func NewAccessRequired(m *manager.Manager, router *mux.Router) *AccessRequired {
+	return &AccessRequired{
+		manager:     m,
+		auth:        auth.NewAuthRequired(m),
+		router:      router,
+		permissions: make(map[*mux.Route]string),
+	}
+}
+
+// Require sets the permission needed to call the route
+func (a *AccessRequired) Require(route *mux.Route, permission string) *mux.Route {
+	a.permissions[route] = permission
+	return route
+}
+
+// Permission returns the permission needed to call the route the request
+// matches; ok is false if it matches no route
+func (a *AccessRequired) Permission(r *http.Request) (permission string, ok bool) {
+	var match mux.RouteMatch
+	if !a.router.Match(r, &match) || match.Route == nil {
+		return "", false
+	}
+	permission, ok = a.permissions[match.Route]
+	if !ok {
+		permission = manager.PermAccountsManage
+	}
+	return permission, true
+}
+
+func (a *AccessRequired) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	permission, ok := a.Permission(r)
+	if !ok || permission == Any {
+		// unmatched requests get the 404 or 405 of the router
+		next(w, r)
+		return
+	}
+
+	username := a.auth.Username(r)
+	permitted, err := a.manager.Permitted(username, permission)
+	if err != nil {
+		logger.Errorf("error checking %s of %s: %s", permission, username, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !permitted {
+		http.Error(w, "forbidden: requires "+permission, http.StatusForbidden)
+		return
+	}
+	next(w, r)
+}
@@ -0,0 +1,43 @@
+package access
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/yleemj/dockerMan/app/manager"
+)
+
+func TestPermission(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	router := mux.NewRouter()
+	a := NewAccessRequired(nil, router)
+	a.Require(router.HandleFunc("/api/containers", noop).Methods("GET"), manager.PermContainersView)
+	a.Require(router.HandleFunc("/api/containers/{id}", noop).Methods("DELETE"), manager.PermContainersManage)
+	a.Require(router.HandleFunc("/api/containers/{id}/stop", noop).Methods("GET"), manager.PermContainersManage)
+	a.Require(router.HandleFunc("/api/account/password", noop).Methods("POST"), Any)
+	router.HandleFunc("/api/unmapped", noop).Methods("GET")
+
+	tests := []struct {
+		method, path string
+		permission   string
+		matched      bool
+	}{
+		{"GET", "/api/containers", manager.PermContainersView, true},
+		{"DELETE", "/api/containers/abc", manager.PermContainersManage, true},
+		{"GET", "/api/containers/abc/stop", manager.PermContainersManage, true},
+		{"POST", "/api/account/password", Any, true},
+		{"GET", "/api/unmapped", manager.PermAccountsManage, true},
+		{"GET", "/api/missing", "", false},
+		{"PUT", "/api/containers", "", false},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		permission, matched := a.Permission(r)
+		if permission != test.permission || matched != test.matched {
+			t.Errorf("%s %s: expected %q %t; received %q %t", test.method, test.path, test.permission, test.matched, permission, matched)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package auth holds the middleware restricting the api to signed in
+// accounts.
+package auth
+
+import (
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/yleemj/dockerMan/app/manager"
+)
+
+var (
+	logger = logrus.New()
+)
+
+// AuthRequired rejects requests not signed in as an existing account
+type AuthRequired struct {
+	manager *manager.Manager
+}
+
+func NewAuthRequired(m *manager.Manager) *AuthRequired {
+	return &AuthRequired{
+		manager: m,
+	}
+}
+
+// Username returns the account the request is signed in as, with an
+// access token or a session
+func (a *AuthRequired) Username(r *http.Request) string {
+	if username := TokenUsername(r); username != "" {
+		return username
+	}
+	session, err := a.manager.Store().Get(r, a.manager.StoreKey)
+	if err != nil {
+		return ""
+	}
+	username, _ := session.Values["username"].(string)
+	return username
+}
+
+// authenticated returns true if the request is signed in as an account
+// that still exists; sessions must be of the current session generation of
+// the account
+func (a *AuthRequired) authenticated(r *http.Request) bool {
+	username := TokenUsername(r)
+	generation := -1
+	if username == "" {
+		session, err := a.manager.Store().Get(r, a.manager.StoreKey)
+		if err != nil {
+			return false
+		}
+		username, _ = session.Values["username"].(string)
+		generation, _ = session.Values["generation"].(int)
+	}
+	if username == "" {
+		return false
+	}
+
+	account, err := a.manager.Account(username)
+	if err != nil {
+		if err != manager.ErrAccountDoesNotExist {
+			logger.Errorf("error loading account %s: %s", username, err)
+		}
+		return false
+	}
+	return generation < 0 || generation == account.SessionGeneration
+}
+
+func (a *AuthRequired) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !a.authenticated(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	next(w, r)
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/manager"
+)
+
+type contextKey int
+
+const (
+	usernameKey contextKey = iota
+)
+
+// TokenAuth authenticates requests carrying an access token in the
+// X-Access-Token header or as a bearer token. Requests without a token are
+// passed on for session authentication.
+type TokenAuth struct {
+	manager tokenAuthenticator
+}
+
+type tokenAuthenticator interface {
+	AuthenticateToken(token string) (*dockerMan.Account, error)
+}
+
+func NewTokenAuth(m *manager.Manager) *TokenAuth {
+	return &TokenAuth{
+		manager: m,
+	}
+}
+
+// RequestToken returns the access token sent with the request
+func RequestToken(r *http.Request) string {
+	if token := r.Header.Get("X-Access-Token"); token != "" {
+		return token
+	}
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) == 2 && strings.EqualFold(parts[0], "bearer") {
+		return strings.TrimSpace(parts[1])
+	}
+	return ""
+}
+
+// TokenUsername returns the account the access token of the request
+// authenticated. It is kept in the request context, which survives the
+// copies of the request mux hands to handlers.
+func TokenUsername(r *http.Request) string {
+	username, _ := r.Context().Value(usernameKey).(string)
+	return username
+}
+
+func (t *TokenAuth) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	token := RequestToken(r)
+	if token == "" {
+		next(w, r)
+		return
+	}
+
+	account, err := t.manager.AuthenticateToken(token)
+	if err != nil {
+		if err != manager.ErrInvalidToken {
+			logger.Errorf("error authenticating access token: %s", err)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	next(w, r.WithContext(context.WithValue(r.Context(), usernameKey, account.Username)))
+}
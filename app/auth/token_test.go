@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/manager"
+)
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		header, value, expected string
+	}{
+		{"X-Access-Token", "abc.def", "abc.def"},
+		{"Authorization", "Bearer abc.def", "abc.def"},
+		{"Authorization", "bearer  abc.def ", "abc.def"},
+		{"Authorization", "Basic dXNlcjpwYXNz", ""},
+		{"Accept", "application/json", ""},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/api/containers", nil)
+		r.Header.Set(test.header, test.value)
+		if token := RequestToken(r); token != test.expected {
+			t.Errorf("%s: %s: expected %q; received %q", test.header, test.value, test.expected, token)
+		}
+	}
+}
+
+type fakeTokens map[string]string
+
+func (f fakeTokens) AuthenticateToken(token string) (*dockerMan.Account, error) {
+	username, ok := f[token]
+	if !ok {
+		return nil, manager.ErrInvalidToken
+	}
+	return &dockerMan.Account{Username: username}, nil
+}
+
+func TestTokenAuthThroughRouter(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/containers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(TokenUsername(r)))
+	}).Methods("GET")
+
+	n := negroni.New()
+	n.Use(negroni.HandlerFunc((&TokenAuth{manager: fakeTokens{"abc.def": "ci"}}).HandlerFuncWithNext))
+	n.UseHandler(router)
+
+	tests := []struct {
+		token    string
+		status   int
+		username string
+	}{
+		{"abc.def", http.StatusOK, "ci"},
+		{"", http.StatusOK, ""},
+		{"abc.xyz", http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/api/containers/abc", nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		n.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%q: expected status %d; received %d", test.token, test.status, w.Code)
+			continue
+		}
+		if test.status == http.StatusOK && w.Body.String() != test.username {
+			t.Errorf("%q: expected username %q; received %q", test.token, test.username, w.Body.String())
+		}
+	}
+}
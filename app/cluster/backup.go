@@ -0,0 +1,135 @@
+package cluster
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNoVolumes = errors.New("container has no volumes")
+)
+
+// Backup writes a tar archive of the volumes mounted by the container to w;
+// the entries are named by their absolute path in the container. It returns
+// the mount points archived. The container keeps running, so stop it first
+// for a consistent snapshot.
+func (e *Engine) Backup(c *Container, w io.Writer) ([]string, error) {
+	info, err := e.client.InspectContainer(c.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := []string{}
+	for _, m := range info.Mounts {
+		// bind mounts are host directories; only volumes are archived
+		if m.Name != "" {
+			volumes = append(volumes, m.Destination)
+		}
+	}
+	if len(volumes) == 0 {
+		return nil, ErrNoVolumes
+	}
+	sort.Strings(volumes)
+
+	tw := tar.NewWriter(w)
+	for _, v := range volumes {
+		if err := e.copyArchive(c.ID, v, tw); err != nil {
+			return nil, fmt.Errorf("%s: %s", v, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return volumes, nil
+}
+
+// copyArchive copies the archive of the path in the container to tw. The
+// docker archive API names the entries after the base name of the path, so
+// they are prefixed with its parent directory.
+func (e *Engine) copyArchive(id, dir string, tw *tar.Writer) error {
+	resp, err := e.request("GET", "/containers/"+id+"/archive?"+url.Values{"path": {dir}}.Encode(), nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	parent := strings.Trim(path.Dir(dir), "/")
+	tr := tar.NewReader(resp.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = path.Join(parent, hdr.Name)
+		if hdr.FileInfo().IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// Restore creates a container for the image on the engine, extracts the
+// archive written by Backup into it and starts it
+func (e *Engine) Restore(c *Container, archive io.Reader) error {
+	return e.start(c, func(id string) error {
+		resp, err := e.request("PUT", "/containers/"+id+"/archive?"+url.Values{"path": {"/"}}.Encode(), archive, "application/x-tar")
+		if err != nil {
+			return fmt.Errorf("unable to extract the backup into %s: %s", id, err)
+		}
+		return resp.Body.Close()
+	})
+}
+
+// Restore starts a container for the image with the archive written by
+// Backup extracted into its volumes. The container is started on the engine
+// with the id or, without one, where the resource manager places it.
+func (c *Cluster) Restore(image *Image, engineID string, archive io.Reader) (*Container, error) {
+	container := &Container{
+		Image: image,
+		Name:  image.ContainerName,
+	}
+
+	// the upload can take long, the cluster is only locked while the
+	// engine is chosen
+	engine, err := c.placeContainer(container, engineID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := engine.Restore(container, archive); err != nil {
+		return nil, err
+	}
+
+	return container, nil
+}
+
+// RestoreImage returns a copy of the image with its named volumes renamed
+// with the suffix, so a restore never writes into the volumes of the
+// container that was backed up
+func RestoreImage(image *Image, suffix string) *Image {
+	i := *image
+	i.Volumes = make([]string, len(image.Volumes))
+	for n, v := range image.Volumes {
+		if name := volumeName(v); name != "" {
+			v = name + "-" + suffix + strings.TrimPrefix(v, name)
+		}
+		i.Volumes[n] = v
+	}
+	return &i
+}
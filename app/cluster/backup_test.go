@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"archive/tar"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestRestoreImage(t *testing.T) {
+	i := &Image{
+		Name:    "postgres",
+		Volumes: []string{"/tmp", "/srv/conf:/etc/app:ro", "db-data:/var/lib/postgresql:rw", "cache:/cache"},
+	}
+
+	restored := RestoreImage(i, "abc")
+	expected := []string{"/tmp", "/srv/conf:/etc/app:ro", "db-data-abc:/var/lib/postgresql:rw", "cache-abc:/cache"}
+	if !reflect.DeepEqual(restored.Volumes, expected) {
+		t.Fatalf("expected %v; received %v", expected, restored.Volumes)
+	}
+	if i.Volumes[2] != "db-data:/var/lib/postgresql:rw" {
+		t.Fatalf("expected the image to be unchanged; received %v", i.Volumes)
+	}
+}
+
+func TestCopyArchive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+apiVersion+"/containers/abc/archive" || r.FormValue("path") != "/var/lib/db" {
+			http.NotFound(w, r)
+			return
+		}
+		tw := tar.NewWriter(w)
+		tw.WriteHeader(&tar.Header{Name: "db/", Mode: 0755, Typeflag: tar.TypeDir})
+		tw.WriteHeader(&tar.Header{Name: "db/data", Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+		tw.Write([]byte("data"))
+		tw.Close()
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	e := &Engine{}
+	e.client = &dockerclient.DockerClient{URL: u, HTTPClient: server.Client()}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := e.copyArchive("abc", "/var/lib/db", tw); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+
+	names := []string{}
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+
+	expected := []string{"var/lib/db/", "var/lib/db/data"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v; received %v", expected, names)
+	}
+}
@@ -0,0 +1,127 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/samalba/dockerclient"
+)
+
+// BuildOptions describes an image build from an uploaded context
+type BuildOptions struct {
+	// Context is the tar archive of the build context
+	Context io.Reader
+
+	// Tag is the repository and optional tag to give the built image
+	Tag string
+
+	// Dockerfile is the path of the Dockerfile within the context
+	Dockerfile string
+
+	// NoCache disables the build cache
+	NoCache bool
+
+	// Pull always attempts to pull a newer version of the base image
+	Pull bool
+
+	// BuildArgs are the build time variables
+	BuildArgs map[string]string
+
+	// RegistryAuth are the credentials by registry host the base images
+	// are pulled with
+	RegistryAuth map[string]*dockerclient.AuthConfig
+
+	// Labels selects the engines eligible to run the build; the scheduler
+	// picks the least loaded of them
+	Labels []string
+}
+
+// Build runs a docker build on the engine and returns the build output stream
+func (e *Engine) Build(opts *BuildOptions) (io.ReadCloser, error) {
+	return e.client.BuildImage(&dockerclient.BuildImage{
+		Context:        opts.Context,
+		RepoName:       opts.Tag,
+		DockerfileName: opts.Dockerfile,
+		NoCache:        opts.NoCache,
+		Pull:           opts.Pull,
+		Remove:         true,
+		BuildArgs:      opts.BuildArgs,
+		Config:         buildAuthConfig(opts.RegistryAuth),
+	})
+}
+
+// buildAuthConfig returns the registry credentials of a build keyed as
+// docker expects them; the docker hub by its index address
+func buildAuthConfig(auth map[string]*dockerclient.AuthConfig) *dockerclient.ConfigFile {
+	if len(auth) == 0 {
+		return nil
+	}
+	config := &dockerclient.ConfigFile{Configs: make(map[string]dockerclient.AuthConfig, len(auth))}
+	for host, a := range auth {
+		if a == nil {
+			continue
+		}
+		if NormalizeRegistry(host) == DefaultRegistry {
+			host = "https://index.docker.io/v1/"
+		}
+		config.Configs[host] = *a
+	}
+	return config
+}
+
+// Push pushes the image from the engine to its registry
+func (e *Engine) Push(image string) error {
+	info := ParseImageName(image)
+	return e.client.PushImage(info.Name, info.Tag, e.authFor(image))
+}
+
+// BuildEngine returns the engine to run a build on, chosen by the resource
+// manager among the engines matching the labels
+func (c *Cluster) BuildEngine(labels []string) (*Engine, error) {
+	engines := c.EnginesWithLabels(labels)
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("no engines match labels %v", labels)
+	}
+
+	engineResources, err := snapshotEngines(engines, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// a build has no reservation of its own; place it on the least used engine
+	s, err := c.resourceManager.PlaceContainer(&Container{Image: &Image{}}, engineResources)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range engines {
+		if e.ID == s.ID {
+			return e, nil
+		}
+	}
+
+	return nil, fmt.Errorf("engine with id %s is not in cluster", s.ID)
+}
+
+// Build runs the build on an engine chosen by BuildEngine
+func (c *Cluster) Build(opts *BuildOptions) (*Engine, io.ReadCloser, error) {
+	if opts.Tag != "" {
+		if _, err := ParseImageReference(opts.Tag); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	e, err := c.BuildEngine(opts.Labels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Infof("building %s on %s", opts.Tag, e.ID)
+
+	out, err := e.Build(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return e, out, nil
+}
@@ -0,0 +1,30 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestBuildAuthConfig(t *testing.T) {
+	if config := buildAuthConfig(nil); config != nil {
+		t.Fatalf("expected no config without credentials; received %+v", config)
+	}
+
+	hub := &dockerclient.AuthConfig{Username: "hub"}
+	local := &dockerclient.AuthConfig{Username: "local"}
+	config := buildAuthConfig(map[string]*dockerclient.AuthConfig{
+		DefaultRegistry:        hub,
+		"registry.local:5000":  local,
+		"registry.example.com": nil,
+	})
+
+	expected := map[string]dockerclient.AuthConfig{
+		"https://index.docker.io/v1/": *hub,
+		"registry.local:5000":         *local,
+	}
+	if !reflect.DeepEqual(config.Configs, expected) {
+		t.Fatalf("expected %v; received %v", expected, config.Configs)
+	}
+}
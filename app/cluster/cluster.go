@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Sirupsen/logrus"
+	"github.com/samalba/dockerclient"
 	"sync"
 )
 
 var (
 	ErrEngineNotConnected = errors.New("engine is not connected to docker's REST API")
+	ErrEngineNotEligible  = errors.New("engine does not carry the labels required")
 	logger                = logrus.New()
 )
 
@@ -16,6 +18,8 @@ type Cluster struct {
 	mux             sync.Mutex
 	engines         map[string]*Engine
 	resourceManager *ResourceManager
+	authResolver    AuthResolver
+	secretResolver  SecretResolver
 }
 
 func New(manager *ResourceManager, engines ...*Engine) (*Cluster, error) {
@@ -39,6 +43,12 @@ func (c *Cluster) AddEngine(e *Engine) error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
+	if c.authResolver != nil {
+		e.SetAuthResolver(c.authResolver)
+	}
+	if c.secretResolver != nil {
+		e.SetSecretResolver(c.secretResolver)
+	}
 	c.engines[e.ID] = e
 
 	return nil
@@ -53,6 +63,28 @@ func (c *Cluster) RemoveEngine(e *Engine) error {
 	return nil
 }
 
+// SetAuthResolver sets the registry credentials lookup on every engine
+func (c *Cluster) SetAuthResolver(r AuthResolver) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.authResolver = r
+	for _, e := range c.engines {
+		e.SetAuthResolver(r)
+	}
+}
+
+// SetSecretResolver sets the secrets lookup on every engine
+func (c *Cluster) SetSecretResolver(r SecretResolver) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.secretResolver = r
+	for _, e := range c.engines {
+		e.SetSecretResolver(r)
+	}
+}
+
 // ListContainers returns all the containers running in the cluster
 func (c *Cluster) ListContainers(all bool, size bool, filter string) []*Container {
 	out := []*Container{}
@@ -66,6 +98,24 @@ func (c *Cluster) ListContainers(all bool, size bool, filter string) []*Containe
 	return out
 }
 
+// Images returns every image in the cluster along with the engines holding it
+func (c *Cluster) Images() []*ClusterImage {
+	engineImages := make(map[string][]*dockerclient.Image)
+
+	for _, e := range c.engines {
+		images, err := e.Images()
+		if err != nil {
+			// skip engines that are not available
+			logger.Warnf("unable to list images on %s: %s", e.ID, err)
+			continue
+		}
+
+		engineImages[e.ID] = images
+	}
+
+	return mergeImages(engineImages)
+}
+
 func (c *Cluster) Kill(container *Container, sig int) error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
@@ -102,6 +152,18 @@ func (c *Cluster) Restart(container *Container, timeout int) error {
 	return engine.Restart(container, timeout)
 }
 
+func (c *Cluster) Rename(container *Container, name string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	engine := c.engines[container.Engine.ID]
+	if engine == nil {
+		return fmt.Errorf("engine with id %s is not in cluster", container.Engine.ID)
+	}
+
+	return engine.Rename(container, name)
+}
+
 func (c *Cluster) Remove(container *Container) error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
@@ -114,40 +176,50 @@ func (c *Cluster) Remove(container *Container) error {
 	return engine.Remove(container)
 }
 
-func (c *Cluster) Start(image *Image, pull bool) (*Container, error) {
+// Start schedules and starts a container for the image; if digest is set the
+// container is started from the image pinned to that digest
+func (c *Cluster) Start(image *Image, digest string) (*Container, error) {
+	return c.start("", image, digest)
+}
+
+// placeContainer returns the engine with the id if it carries the labels of
+// the image, or the scheduled one without an id. Pulls and uploads can take
+// long, so the cluster is only locked while the engine is chosen.
+func (c *Cluster) placeContainer(container *Container, engineID string) (*Engine, error) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
-	var engineResources = []*EngineSnapshot{}
+	if engineID == "" {
+		return c.schedule(container)
+	}
+	engine := c.engines[engineID]
+	if engine == nil {
+		return nil, fmt.Errorf("engine with id %s is not in cluster", engineID)
+	}
+	if !engine.HasLabels(container.Image.Labels) {
+		return nil, ErrEngineNotEligible
+	}
+	return engine, nil
+}
 
+// schedule returns the engine the resource manager places the container on;
+// the caller holds the cluster lock
+func (c *Cluster) schedule(container *Container) (*Engine, error) {
+	// only engines carrying every label of the image are eligible
+	engines := []*Engine{}
 	for _, e := range c.engines {
-		logger.Infof("engine %s is connected: %b", e.ID, e.IsConnected())
-		containers, err := e.ListContainers(false, false, "")
-		if err != nil {
-			return nil, err
+		if e.HasLabels(container.Image.Labels) {
+			engines = append(engines, e)
 		}
-		var cpus, memory float64
-		for _, con := range containers {
-			cpus += con.Image.Cpus
-			memory += con.Image.Memory
-		}
-
-		engineResources = append(engineResources, &EngineSnapshot{
-			ID:             e.ID,
-			ReservedCpus:   cpus,
-			ReservedMemory: memory,
-			Cpus:           e.Cpus,
-			Memory:         e.Memory,
-		})
 	}
 
-	if len(engineResources) == 0 {
-		return nil, fmt.Errorf("no eligible engines to run image")
+	engineResources, err := snapshotEngines(engines, container.Image.NamedVolumes())
+	if err != nil {
+		return nil, err
 	}
 
-	container := &Container{
-		Image: image,
-		Name:  image.ContainerName,
+	if len(engineResources) == 0 {
+		return nil, fmt.Errorf("no eligible engines to run image with labels %v", container.Image.Labels)
 	}
 
 	logger.Infof("container name: %s, image name: %s",
@@ -158,15 +230,84 @@ func (c *Cluster) Start(image *Image, pull bool) (*Container, error) {
 		return nil, err
 	}
 
-	engine := c.engines[s.ID]
+	return c.engines[s.ID], nil
+}
 
-	if err := engine.Start(container, pull); err != nil {
+// StartOnEngine starts a container for the image on the given engine,
+// bypassing the resource manager
+func (c *Cluster) StartOnEngine(engineID string, image *Image, digest string) (*Container, error) {
+	if engineID == "" {
+		return nil, fmt.Errorf("engine with id %s is not in cluster", engineID)
+	}
+	return c.start(engineID, image, digest)
+}
+
+// start places the container and starts it without holding the cluster
+// lock, so a slow pull does not hold up the rest of the cluster
+func (c *Cluster) start(engineID string, image *Image, digest string) (*Container, error) {
+	container := &Container{
+		Image:       image,
+		Name:        image.ContainerName,
+		ImageDigest: digest,
+	}
+
+	engine, err := c.placeContainer(container, engineID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := engine.Start(container); err != nil {
 		return nil, err
 	}
 
 	return container, nil
 }
 
+// snapshotEngines returns the reserved resources of each engine, and which
+// of the named volumes it holds, for scheduling
+func snapshotEngines(engines []*Engine, volumes []string) ([]*EngineSnapshot, error) {
+	var engineResources = []*EngineSnapshot{}
+
+	for _, e := range engines {
+		logger.Infof("engine %s is connected: %t", e.ID, e.IsConnected())
+		containers, err := e.ListContainers(false, false, "")
+		if err != nil {
+			return nil, err
+		}
+		var cpus, memory float64
+		for _, con := range containers {
+			cpus += con.Image.Cpus
+			memory += con.Image.Memory
+		}
+
+		var held []string
+		if len(volumes) > 0 {
+			// the volumes only steer the placement; an engine whose
+			// volumes cannot be listed is taken to hold none of them
+			names, err := e.volumeNames()
+			if err != nil {
+				logger.Warnf("unable to list volumes on %s: %s", e.ID, err)
+			}
+			for _, v := range volumes {
+				if names[v] {
+					held = append(held, v)
+				}
+			}
+		}
+
+		engineResources = append(engineResources, &EngineSnapshot{
+			ID:             e.ID,
+			ReservedCpus:   cpus,
+			ReservedMemory: memory,
+			Cpus:           e.Cpus,
+			Memory:         e.Memory,
+			Volumes:        held,
+		})
+	}
+
+	return engineResources, nil
+}
+
 // Engines returns the engines registered in the cluster
 func (c *Cluster) Engines() []*Engine {
 	out := []*Engine{}
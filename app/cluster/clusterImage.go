@@ -0,0 +1,155 @@
+package cluster
+
+import (
+	"sort"
+
+	"github.com/samalba/dockerclient"
+)
+
+// ClusterImage is an image present on one or more engines of the cluster
+type ClusterImage struct {
+	// ID is the image id
+	ID string `json:"id,omitempty"`
+
+	// Tags are the repository tags of the image across all engines
+	Tags []string `json:"tags,omitempty"`
+
+	// Digests are the repository digests of the image across all engines
+	Digests []string `json:"digests,omitempty"`
+
+	// Size is the size of the image in bytes
+	Size int64 `json:"size,omitempty"`
+
+	// VirtualSize is the size of the image including its parent layers
+	VirtualSize int64 `json:"virtual_size,omitempty"`
+
+	// Created is the unix time the image was created
+	Created int64 `json:"created,omitempty"`
+
+	// Engines are the ids of the engines holding the image
+	Engines []string `json:"engines,omitempty"`
+
+	// MissingEngines are the ids of the reachable engines without the image
+	MissingEngines []string `json:"missing_engines,omitempty"`
+}
+
+// mergeImages groups the images of each engine by image id
+func mergeImages(engineImages map[string][]*dockerclient.Image) []*ClusterImage {
+	var (
+		byID    = make(map[string]*ClusterImage)
+		engines = []string{}
+	)
+
+	for id := range engineImages {
+		engines = append(engines, id)
+	}
+	sort.Strings(engines)
+
+	for _, engineID := range engines {
+		for _, i := range engineImages[engineID] {
+			ci, ok := byID[i.Id]
+			if !ok {
+				ci = &ClusterImage{
+					ID:          i.Id,
+					Size:        i.Size,
+					VirtualSize: i.VirtualSize,
+					Created:     i.Created,
+				}
+				byID[i.Id] = ci
+			}
+			for _, t := range i.RepoTags {
+				if t == "<none>:<none>" || containsString(ci.Tags, t) {
+					continue
+				}
+				ci.Tags = append(ci.Tags, t)
+			}
+			for _, d := range i.RepoDigests {
+				if d == "<none>@<none>" || containsString(ci.Digests, d) {
+					continue
+				}
+				ci.Digests = append(ci.Digests, d)
+			}
+			if !containsString(ci.Engines, engineID) {
+				ci.Engines = append(ci.Engines, engineID)
+			}
+		}
+	}
+
+	out := []*ClusterImage{}
+	for _, ci := range byID {
+		for _, engineID := range engines {
+			if !containsString(ci.Engines, engineID) {
+				ci.MissingEngines = append(ci.MissingEngines, engineID)
+			}
+		}
+		sort.Strings(ci.Tags)
+		sort.Strings(ci.Digests)
+		out = append(out, ci)
+	}
+
+	sort.Sort(clusterImages(out))
+
+	return out
+}
+
+// Matches returns true if any tag or digest of the image references the
+// registry and repository; empty values match anything
+func (i *ClusterImage) Matches(registry, repository string) bool {
+	if registry == "" && repository == "" {
+		return true
+	}
+
+	refs := append([]string{}, i.Tags...)
+	refs = append(refs, i.Digests...)
+	for _, r := range refs {
+		info, err := ParseImageReference(r)
+		if err != nil {
+			continue
+		}
+		if registry != "" && info.Registry != NormalizeRegistry(registry) {
+			continue
+		}
+		if repository != "" && info.Repository != repository && info.Name != repository {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type clusterImages []*ClusterImage
+
+func (c clusterImages) Len() int {
+	return len(c)
+}
+
+func (c clusterImages) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c clusterImages) Less(i, j int) bool {
+	var it, jt string
+	if len(c[i].Tags) > 0 {
+		it = c[i].Tags[0]
+	}
+	if len(c[j].Tags) > 0 {
+		jt = c[j].Tags[0]
+	}
+	if it != jt {
+		// untagged images go last
+		if it == "" || jt == "" {
+			return jt == ""
+		}
+		return it < jt
+	}
+	return c[i].ID < c[j].ID
+}
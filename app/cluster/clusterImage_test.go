@@ -0,0 +1,52 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestMergeImages(t *testing.T) {
+	engineImages := map[string][]*dockerclient.Image{
+		"e1": {
+			{Id: "aaa", RepoTags: []string{"busybox:latest"}},
+			{Id: "bbb", RepoTags: []string{"app:latest"}},
+		},
+		"e2": {
+			{Id: "aaa", RepoTags: []string{"busybox:latest", "busybox:1"}},
+			{Id: "ccc", RepoTags: []string{"app:latest"}},
+			{Id: "ddd", RepoTags: []string{"<none>:<none>"}},
+		},
+	}
+
+	images := mergeImages(engineImages)
+	if len(images) != 4 {
+		t.Fatalf("expected 4 images; received %d", len(images))
+	}
+
+	byID := make(map[string]*ClusterImage)
+	for _, i := range images {
+		byID[i.ID] = i
+	}
+
+	busybox := byID["aaa"]
+	if len(busybox.Engines) != 2 || len(busybox.MissingEngines) != 0 {
+		t.Fatalf("expected busybox on both engines; received %v missing %v", busybox.Engines, busybox.MissingEngines)
+	}
+	if len(busybox.Tags) != 2 {
+		t.Fatalf("expected 2 busybox tags; received %v", busybox.Tags)
+	}
+
+	app := byID["bbb"]
+	if len(app.MissingEngines) != 1 || app.MissingEngines[0] != "e2" {
+		t.Fatalf("expected app image missing on e2; received %v", app.MissingEngines)
+	}
+
+	if len(byID["ddd"].Tags) != 0 {
+		t.Fatalf("expected untagged image to have no tags; received %v", byID["ddd"].Tags)
+	}
+
+	if last := images[len(images)-1]; last.ID != "ddd" {
+		t.Fatalf("expected untagged image last; received %s", last.ID)
+	}
+}
@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestScheduleRequiresEngineLabels(t *testing.T) {
+	c := &Cluster{
+		engines: map[string]*Engine{
+			"a": {ID: "a", Labels: []string{"team:web"}},
+			"b": {ID: "b"},
+		},
+		resourceManager: NewResourceManager(),
+	}
+
+	container := &Container{Image: &Image{Name: "redis", Labels: []string{"team:payments"}}}
+	_, err := c.schedule(container)
+	if err == nil || !strings.Contains(err.Error(), "no eligible engines") {
+		t.Fatalf("expected no eligible engines; received %v", err)
+	}
+}
+
+func TestEngineOverrideRequiresLabels(t *testing.T) {
+	c := &Cluster{
+		engines: map[string]*Engine{
+			"a": {ID: "a", Labels: []string{"team:web"}},
+		},
+		resourceManager: NewResourceManager(),
+	}
+
+	image := &Image{Name: "redis", Labels: []string{"team:payments"}}
+	if _, err := c.StartOnEngine("a", image, ""); err != ErrEngineNotEligible {
+		t.Errorf("expected the engine to be rejected for the start; received %v", err)
+	}
+	if _, err := c.Restore(image, "a", strings.NewReader("")); err != ErrEngineNotEligible {
+		t.Errorf("expected the engine to be rejected for the restore; received %v", err)
+	}
+	if _, err := c.selectEngines("a", image.Labels); err != ErrEngineNotEligible {
+		t.Errorf("expected the engine to be rejected for the selection; received %v", err)
+	}
+	if engines, err := c.selectEngines("a", nil); err != nil || len(engines) != 1 {
+		t.Errorf("expected the engine without labels; received %v %v", engines, err)
+	}
+}
+
+func TestResolveEngineConnected(t *testing.T) {
+	c := &Cluster{
+		engines: map[string]*Engine{
+			"a": {ID: "a"},
+			"b": {ID: "b"},
+		},
+	}
+	if _, err := c.ResolveDigest("redis:3"); err == nil || !strings.Contains(err.Error(), "no connected engines") {
+		t.Fatalf("expected no connected engines; received %v", err)
+	}
+
+	c.engines["b"].client = &dockerclient.DockerClient{}
+	if e := c.resolveEngine(); e == nil || e.ID != "b" {
+		t.Fatalf("expected the connected engine; received %v", e)
+	}
+}
@@ -13,6 +13,10 @@ type Container struct {
     // Image is the configuration from which the container was created
     Image *Image `json:"image,omitempty"`
 
+    // ImageDigest is the content digest the container was started from when
+    // its image tag was resolved at launch
+    ImageDigest string `json:"image_digest,omitempty"`
+
     // Engine is the engine that is runnnig the container
     Engine *Engine `json:"engine,omitempty"`
 
@@ -21,6 +25,23 @@ type Container struct {
 
     // Ports are the public port mappings for the container
     Ports []*Port `json:"ports,omitempty"`
+
+    // IPAddresses are the addresses of the container by network name
+    IPAddresses map[string]string `json:"ip_addresses,omitempty"`
+
+    // LegacyMetadata is true if the container's metadata is stored in env
+    // vars rather than labels; such containers are recreated by the
+    // metadata migration
+    LegacyMetadata bool `json:"legacy_metadata,omitempty"`
+}
+
+// ImageRef returns the reference the container is started from; the image
+// name pinned to the digest if one was resolved
+func (c *Container) ImageRef() string {
+    if c.ImageDigest == "" {
+        return c.Image.Name
+    }
+    return ParseImageName(c.Image.Name).Name + "@" + c.ImageDigest
 }
 
 func (c *Container) String() string {
@@ -2,9 +2,16 @@ package cluster
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/samalba/dockerclient"
 )
@@ -16,8 +23,29 @@ type Engine struct {
 	Memory float64  `json:"memory,omitempty"`
 	Labels []string `json:"labels,omitempty"`
 
-	client     *dockerclient.DockerClient
-	clientAuth *dockerclient.AuthConfig
+	client       *dockerclient.DockerClient
+	clientAuth   *dockerclient.AuthConfig
+	authResolver AuthResolver
+
+	secretResolver SecretResolver
+
+	pullMux sync.Mutex
+	pulls   map[string]*pullCall
+
+	// pulled is when this controller last pulled each image onto the
+	// engine and starting counts the container starts in flight per
+	// image; the image garbage collection leaves both alone
+	pulled   map[string]time.Time
+	starting map[string]int
+}
+
+// AuthResolver returns the credentials for a registry host or nil if there are none
+type AuthResolver func(registry string) *dockerclient.AuthConfig
+
+// pullCall is an in flight image pull shared by concurrent callers
+type pullCall struct {
+	wg  sync.WaitGroup
+	err error
 }
 
 func (e *Engine) Connect(config *tls.Config) error {
@@ -44,37 +72,287 @@ func (e *Engine) SetClientAuth(username, password, email string) {
 	}
 }
 
+// SetAuthResolver sets the lookup used to find registry credentials for an image
+func (e *Engine) SetAuthResolver(r AuthResolver) {
+	e.authResolver = r
+}
+
+// authFor returns the credentials for the registry of the image, falling back
+// to the engine's client auth
+func (e *Engine) authFor(image string) *dockerclient.AuthConfig {
+	if e.authResolver != nil {
+		if auth := e.authResolver(ParseImageName(image).Registry); auth != nil {
+			return auth
+		}
+	}
+	return e.clientAuth
+}
+
+// apiVersion is the docker API version of the requests sent with request;
+// the oldest version covering all of them
+const apiVersion = "v1.22"
+
+// apiError is an error response of the docker API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// isNotFound returns true if the docker API did not find the resource
+func isNotFound(err error) bool {
+	e, ok := err.(*apiError)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// request sends a request to the docker API of the engine; error responses
+// are returned as an apiError and the caller closes the body otherwise
+func (e *Engine) request(method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/%s%s", e.client.URL, apiVersion, path), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := e.client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return nil, &apiError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(data)),
+		}
+	}
+	return resp, nil
+}
+
 // IsConnected returns true if the engine is connected to a remote docker API
 func (e *Engine) IsConnected() bool {
 	return e.client != nil
 }
 
+// HasLabels returns true if the engine carries all of the given labels
+func (e *Engine) HasLabels(labels []string) bool {
+	for _, l := range labels {
+		found := false
+		for _, el := range e.Labels {
+			if el == l {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Pull pulls the image onto the engine; concurrent pulls of the same image
+// wait for the one already in flight instead of starting another
 func (e *Engine) Pull(image string) error {
-	if err := e.client.PullImage(image, e.clientAuth); err != nil {
-		return err
+	return e.sharedPull(image, func() error {
+		return e.pullWithRetry(image)
+	})
+}
+
+// sharedPull runs pull unless a pull of the image is already in flight, in
+// which case it waits for that one and returns its result. The pulls are
+// shared on the normalized reference, whichever way the image is written.
+func (e *Engine) sharedPull(image string, pull func() error) error {
+	key := pullKey(image)
+
+	e.pullMux.Lock()
+	if e.pulls == nil {
+		e.pulls = make(map[string]*pullCall)
 	}
-	return nil
+	if p, ok := e.pulls[key]; ok {
+		e.pullMux.Unlock()
+		p.wg.Wait()
+		return p.err
+	}
+	p := &pullCall{}
+	p.wg.Add(1)
+	e.pulls[key] = p
+	e.pullMux.Unlock()
+
+	p.err = pull()
+	p.wg.Done()
+
+	e.pullMux.Lock()
+	delete(e.pulls, key)
+	if p.err == nil {
+		if e.pulled == nil {
+			e.pulled = make(map[string]time.Time)
+		}
+		e.pulled[key] = time.Now()
+	}
+	e.pullMux.Unlock()
+
+	return p.err
+}
+
+// pullKey returns the reference with the registry, repository and tag or
+// digest spelled out, so that redis, redis:latest and
+// docker.io/library/redis:latest are the same image; anything else, such
+// as an image id, is returned as is
+func pullKey(image string) string {
+	info, err := ParseImageReference(image)
+	if err != nil {
+		return image
+	}
+
+	key := info.Registry + "/" + info.Repository
+	if info.Tag != "" {
+		key += ":" + info.Tag
+	}
+	if info.Digest != "" {
+		key += "@" + info.Digest
+	}
+	return key
+}
+
+// trackStart records a start of a container of the image in flight until
+// the returned func is called
+func (e *Engine) trackStart(image string) func() {
+	e.pullMux.Lock()
+	if e.starting == nil {
+		e.starting = make(map[string]int)
+	}
+	key := pullKey(image)
+	e.starting[key]++
+	e.pullMux.Unlock()
+
+	return func() {
+		e.pullMux.Lock()
+		if e.starting[key]--; e.starting[key] <= 0 {
+			delete(e.starting, key)
+		}
+		e.pullMux.Unlock()
+	}
+}
+
+// Start creates and starts the container, pulling its image first as
+// required by the image pull policy
+func (e *Engine) Start(c *Container) error {
+	return e.start(c, nil)
 }
 
-func (e *Engine) Start(c *Container, pullImage bool) error {
+// start creates and starts the container; prepare is called with the id of
+// the created container before it starts
+func (e *Engine) start(c *Container, prepare func(id string) error) error {
 	var (
 		err    error
-		env    = []string{}
 		client = e.client
 		i      = c.Image
+		ref    = c.ImageRef()
 	)
 	c.Engine = e
 
-	logger.Infof("client: %v", client)
+	// the image is not used by a container until it is created
+	defer e.trackStart(ref)()
+
+	secretEnv, err := e.secretEnv(i)
+	if err != nil {
+		return err
+	}
+
+	config, hostConfig, err := e.containerConfig(c, secretEnv)
+	if err != nil {
+		return err
+	}
+
+	_, _, extraNetworks, err := i.networks()
+	if err != nil {
+		return err
+	}
+
+	if err := e.pullForPolicy(ref, i.PullPolicy); err != nil {
+		return err
+	}
+
+	logger.Infof("config hostname : %v", config.Hostname)
+	logger.Infof("config image: %v", config.Image)
+	logger.Infof("config command: %v", config.Cmd)
+	logger.Infof("config env: %v", redactEnv(config.Env, i.Secrets))
+	logger.Infof("config memory: %v", config.Memory)
+	logger.Infof("config cpu shares: %v", config.CpuShares)
+	logger.Infof("config cpu set: %v", config.Cpuset)
+	logger.Infof("config volumes: %v", config.Volumes)
+
+	if prepare != nil {
+		// the volumes of the container only exist before it starts if
+		// they are created with it
+		config.HostConfig = *hostConfig
+	}
+
+	if c.ID, err = client.CreateContainer(config, c.Name, e.authFor(ref)); err != nil {
+		return err
+	}
+
+	logger.Infof("container %s name %s created", c.ID, c.Name)
+
+	if err := e.startCreated(c, hostConfig, extraNetworks, prepare); err != nil {
+		// a container that never started is of no use and would hold
+		// its name
+		if rerr := client.RemoveContainer(c.ID, true, true); rerr != nil {
+			logger.Warnf("unable to remove container %s that failed to start: %s", c.ID, rerr)
+		}
+		c.ID = ""
+		return err
+	}
+
+	logger.Infof("container %s started", c.ID)
+
+	return e.updatePortInformation(c)
+}
+
+// startCreated connects the created container to its extra networks,
+// prepares and starts it
+func (e *Engine) startCreated(c *Container, hostConfig *dockerclient.HostConfig, networks []*NetworkAttachment, prepare func(id string) error) error {
+	for _, n := range networks {
+		if err := e.connectNetwork(c.ID, n.Name, n.Aliases); err != nil {
+			return err
+		}
+	}
+	if prepare != nil {
+		if err := prepare(c.ID); err != nil {
+			return err
+		}
+	}
+	logger.Infof("host config: %v", hostConfig)
+
+	return e.client.StartContainer(c.ID, hostConfig)
+}
+
+// containerConfig maps the container's image to the docker container and
+// host configs; extraEnv is added to the image environment
+func (e *Engine) containerConfig(c *Container, extraEnv []string) (*dockerclient.ContainerConfig, *dockerclient.HostConfig, error) {
+	var (
+		env = []string{}
+		i   = c.Image
+	)
 
 	for k, v := range i.Environment {
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
 	}
+	env = append(env, extraEnv...)
 
-	env = append(env,
-		fmt.Sprintf("_dockerMan_type=%s", i.Type),
-		fmt.Sprintf("_dockerMan_labels=%s", strings.Join(i.Labels, ",")),
-	)
+	if len(i.UserData) > 0 {
+		data, err := json.Marshal(i.UserData)
+		if err != nil {
+			return nil, nil, err
+		}
+		env = append(env, fmt.Sprintf("%s=%s", userDataEnv, data))
+	}
 
 	vols := make(map[string]struct{})
 	binds := []string{}
@@ -87,17 +365,50 @@ func (e *Engine) Start(c *Container, pullImage bool) error {
 		vols[v] = struct{}{}
 	}
 
+	labels := make(map[string]string)
+	for k, v := range i.DockerLabels {
+		// only the metadata below is recorded under labelPrefix
+		if !strings.HasPrefix(k, labelPrefix) {
+			labels[k] = v
+		}
+	}
+	for k, v := range i.metadataLabels(c.ImageDigest != "") {
+		labels[k] = v
+	}
+
+	memorySwap := int64(i.MemorySwap) * 1024 * 1024
+	if i.MemorySwap < 0 {
+		memorySwap = -1
+	}
+
 	config := &dockerclient.ContainerConfig{
 		Hostname:     i.Hostname,
 		Domainname:   i.Domainname,
-		Image:        i.Name,
+		User:         i.User,
+		WorkingDir:   i.WorkingDir,
+		Image:        c.ImageRef(),
 		Cmd:          i.Args,
+		Entrypoint:   i.Entrypoint,
 		Memory:       int64(i.Memory) * 1024 * 1024,
+		MemorySwap:   memorySwap,
 		Env:          env,
 		CpuShares:    int64(i.Cpus * 100.0 / e.Cpus),
 		Cpuset:       i.Cpuset,
 		ExposedPorts: make(map[string]struct{}),
 		Volumes:      vols,
+		Labels:       labels,
+	}
+
+	networkMode, primary, _, err := i.networks()
+	if err != nil {
+		return nil, nil, err
+	}
+	if primary != nil {
+		config.NetworkingConfig.EndpointsConfig = map[string]*dockerclient.EndpointSettings{
+			primary.Name: {
+				Aliases: primary.Aliases,
+			},
+		}
 	}
 
 	links := []string{}
@@ -114,54 +425,55 @@ func (e *Engine) Start(c *Container, pullImage bool) error {
 			Name:              i.RestartPolicy.Name,
 			MaximumRetryCount: i.RestartPolicy.MaximumRetryCount,
 		},
-		NetworkMode: i.NetworkMode,
+		NetworkMode: networkMode,
 		Privileged:  i.Privileged,
+		Dns:         i.Dns,
+		DnsSearch:   i.DnsSearch,
+		ExtraHosts:  i.ExtraHosts,
+		CapAdd:      i.CapAdd,
+		CapDrop:     i.CapDrop,
+		PidsLimit:   i.PidsLimit,
+		LogConfig: dockerclient.LogConfig{
+			Type:   i.LogDriver,
+			Config: i.LogOptions,
+		},
+	}
+
+	for _, u := range i.Ulimits {
+		hostConfig.Ulimits = append(hostConfig.Ulimits, dockerclient.Ulimit{
+			Name: u.Name,
+			Soft: uint64(u.Soft),
+			Hard: uint64(u.Hard),
+		})
 	}
 
 	for _, b := range i.BindPorts {
 		key := fmt.Sprintf("%d/%s", b.ContainerPort, b.Proto)
 		config.ExposedPorts[key] = struct{}{}
 
+		// a zero host port lets docker pick a free one
+		hostPort := ""
+		if b.Port > 0 {
+			hostPort = fmt.Sprint(b.Port)
+		}
 		hostConfig.PortBindings[key] = []dockerclient.PortBinding{
 			{
 				HostIp:   b.HostIp,
-				HostPort: fmt.Sprint(b.Port),
+				HostPort: hostPort,
 			},
 		}
 	}
 
-	if pullImage {
-		if err := e.Pull(i.Name); err != nil {
-			return err
-		}
-	}
-
-	logger.Infof("config hostname : %v", config.Hostname)
-	logger.Infof("config image: %v", config.Image)
-	logger.Infof("config command: %v", config.Cmd)
-	logger.Infof("config memory: %v", config.Memory)
-	logger.Infof("config cpu shares: %v", config.CpuShares)
-	logger.Infof("config cpu set: %v", config.Cpuset)
-	logger.Infof("config volumes: %v", config.Volumes)
-
-	if c.ID, err = client.CreateContainer(config, c.Name); err != nil {
-		return err
-	}
-
-	logger.Infof("container %s name %s created", c.ID, c.Name)
-	logger.Infof("host config: %v", hostConfig)
-
-	if err := client.StartContainer(c.ID, hostConfig); err != nil {
-		return err
-	}
-
-	logger.Infof("container %s started", c.ID)
+	return config, hostConfig, nil
+}
 
-	return e.updatePortInformation(c)
+// Images returns the top level images on the engine
+func (e *Engine) Images() ([]*dockerclient.Image, error) {
+	return e.client.ListImages(false)
 }
 
 func (e *Engine) ListImages() ([]string, error) {
-	images, err := e.client.ListImages()
+	images, err := e.Images()
 	if err != nil {
 		return nil, err
 	}
@@ -222,6 +534,18 @@ func (e *Engine) Remove(container *Container) error {
 	return e.client.RemoveContainer(container.ID, true, true)
 }
 
+// Rename renames the container
+func (e *Engine) Rename(container *Container, name string) error {
+	resp, err := e.request("POST", fmt.Sprintf("/containers/%s/rename?name=%s", container.ID, url.QueryEscape(name)), nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	container.Name = name
+	return nil
+}
+
 func (e *Engine) Version() (*dockerclient.Version, error) {
 	return e.client.Version()
 }
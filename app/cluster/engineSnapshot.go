@@ -19,4 +19,8 @@ type EngineSnapshot struct {
 
 	// CurrentCpu is the current system's cpu usage at the time of the snapshot
 	CurrentCpu float64 `json:"current_cpu,omitempty"`
+
+	// Volumes are the named volumes of the container being placed that
+	// already exist on the engine
+	Volumes []string `json:"volumes,omitempty"`
 }
@@ -0,0 +1,281 @@
+package cluster
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestContainerConfigRoundTrip(t *testing.T) {
+	e := &Engine{ID: "engine-1", Cpus: 2}
+	image := &Image{
+		Name:        "team/web:1",
+		Cpus:        1,
+		Cpuset:      "0,1",
+		Memory:      256,
+		MemorySwap:  512,
+		Entrypoint:  []string{"/bin/entry"},
+		Args:        []string{"serve", "--debug"},
+		Environment: map[string]string{"MODE": "dev"},
+		Hostname:    "web",
+		Domainname:  "example.com",
+		Type:        "service",
+		Labels:      []string{"zone:a"},
+		UserData:    map[string][]string{"owner": {"team"}},
+		Volumes:     []string{"/data"},
+		NetworkMode: "bridge",
+		Privileged:  true,
+		RestartPolicy: RestartPolicy{
+			Name:              "on-failure",
+			MaximumRetryCount: 3,
+		},
+		User:         "app:app",
+		WorkingDir:   "/srv",
+		Dns:          []string{"10.0.0.2"},
+		DnsSearch:    []string{"example.com"},
+		ExtraHosts:   []string{"db:10.0.0.3"},
+		CapAdd:       []string{"NET_ADMIN"},
+		CapDrop:      []string{"MKNOD"},
+		Ulimits:      []Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+		LogDriver:    "syslog",
+		LogOptions:   map[string]string{"tag": "web"},
+		PidsLimit:    100,
+		DockerLabels: map[string]string{"com.example.team": "web"},
+		Owner:        "alice",
+		Team:         "payments",
+		Service:      "web",
+		Spec:         "abc",
+		Secrets:      map[string]string{"DB_PASSWORD": "db"},
+	}
+
+	config, hostConfig, err := e.containerConfig(&Container{Image: image}, []string{"DB_PASSWORD=hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := &dockerclient.ContainerInfo{
+		Id:              "0123456789abcdef",
+		Name:            "/web",
+		Config:          config,
+		HostConfig:      hostConfig,
+		State:           &dockerclient.State{Running: true},
+		NetworkSettings: &dockerclient.NetworkSettings{},
+	}
+
+	c, err := containerFromInfo(info.Id, config.Image, info, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c.Image, image) {
+		t.Fatalf("expected %+v; received %+v", image, c.Image)
+	}
+	if c.State != "running" || c.Name != "/web" || c.LegacyMetadata {
+		t.Fatalf("unexpected container %+v", c)
+	}
+}
+
+func TestContainerConfigUnlimitedSwap(t *testing.T) {
+	e := &Engine{ID: "engine-1", Cpus: 1}
+
+	config, _, err := e.containerConfig(&Container{Image: &Image{Name: "app", MemorySwap: -1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MemorySwap != -1 {
+		t.Fatalf("expected unlimited swap; received %d", config.MemorySwap)
+	}
+}
+
+func TestContainerConfigPinnedImage(t *testing.T) {
+	e := &Engine{ID: "engine-1", Cpus: 1}
+	c := &Container{Image: &Image{Name: "team/web:1"}, ImageDigest: testDigest}
+
+	config, hostConfig, err := e.containerConfig(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Image != "team/web@"+testDigest {
+		t.Fatalf("expected the digest reference; received %s", config.Image)
+	}
+
+	info := &dockerclient.ContainerInfo{
+		Config:          config,
+		HostConfig:      hostConfig,
+		State:           &dockerclient.State{},
+		NetworkSettings: &dockerclient.NetworkSettings{},
+	}
+	read, err := containerFromInfo("id", config.Image, info, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Image.Name != "team/web:1" || read.ImageDigest != testDigest {
+		t.Fatalf("expected the tag and digest to be read back; received %s %s", read.Image.Name, read.ImageDigest)
+	}
+}
+
+func TestContainerConfigReservedDockerLabels(t *testing.T) {
+	e := &Engine{ID: "engine-1", Cpus: 2}
+	image := &Image{
+		Name: "team/web:1",
+		Team: "payments",
+		DockerLabels: map[string]string{
+			"com.example.team": "web",
+			LabelTeam:          "admins",
+			LabelService:       "web",
+			LabelCpus:          "2",
+			LabelSpec:          "abc",
+		},
+	}
+
+	config, hostConfig, err := e.containerConfig(&Container{Image: image}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Labels["com.example.team"] != "web" || config.Labels[LabelTeam] != "payments" {
+		t.Fatalf("unexpected labels %v", config.Labels)
+	}
+	for _, k := range []string{LabelService, LabelCpus, LabelSpec} {
+		if config.Labels[k] != "" {
+			t.Errorf("expected %s not to be set from the docker labels; received %q", k, config.Labels[k])
+		}
+	}
+
+	c := readContainer(t, e, config, hostConfig)
+	if c.Image.Team != "payments" || c.Image.Service != "" || c.Image.Cpus != 0 || c.Image.Spec != "" {
+		t.Fatalf("unexpected metadata %+v", c.Image)
+	}
+}
+
+func TestContainerConfigReservedImageLabels(t *testing.T) {
+	e := &Engine{ID: "engine-1", Cpus: 2}
+
+	config, hostConfig, err := e.containerConfig(&Container{Image: &Image{Name: "team/web:1", Team: "payments"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// docker adds the LABELs of the image the container labels do not set
+	labels := map[string]string{
+		LabelTeam:    "admins",
+		LabelService: "web",
+		LabelMemory:  "4096",
+		LabelSpec:    "abc",
+	}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+	config.Labels = labels
+	// as are its env vars
+	config.Env = append(config.Env, "_dockerMan_owner=root")
+
+	c := readContainer(t, e, config, hostConfig)
+	if c.Image.Team != "payments" || c.Image.Service != "" || c.Image.Memory != 0 || c.Image.Spec != "" || c.Image.Owner != "" {
+		t.Fatalf("unexpected metadata %+v", c.Image)
+	}
+}
+
+func readContainer(t *testing.T, e *Engine, config *dockerclient.ContainerConfig, hostConfig *dockerclient.HostConfig) *Container {
+	info := &dockerclient.ContainerInfo{
+		Config:          config,
+		HostConfig:      hostConfig,
+		State:           &dockerclient.State{},
+		NetworkSettings: &dockerclient.NetworkSettings{},
+	}
+	c, err := containerFromInfo("id", config.Image, info, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRename(t *testing.T) {
+	renamed := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/"+apiVersion+"/containers/abc/rename" {
+			http.NotFound(w, r)
+			return
+		}
+		renamed = r.FormValue("name")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	e := &Engine{}
+	e.client = &dockerclient.DockerClient{URL: u, HTTPClient: server.Client()}
+
+	c := &Container{ID: "abc", Name: "/web"}
+	if err := e.Rename(c, "web-replaced"); err != nil {
+		t.Fatal(err)
+	}
+	if renamed != "web-replaced" || c.Name != "web-replaced" {
+		t.Fatalf("expected the container to be renamed; received %q %q", renamed, c.Name)
+	}
+
+	if err := e.Rename(&Container{ID: "missing"}, "web"); !isNotFound(err) {
+		t.Fatalf("expected a not found error; received %v", err)
+	}
+}
+
+func TestSharedPull(t *testing.T) {
+	e := &Engine{}
+	pullErr := errors.New("pull failed")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan error)
+	go func() {
+		first <- e.sharedPull("redis", func() error {
+			close(started)
+			<-release
+			return pullErr
+		})
+	}()
+	<-started
+
+	pulls := 0
+	second := make(chan error)
+	go func() {
+		second <- e.sharedPull("docker.io/library/redis:latest", func() error {
+			pulls++
+			return nil
+		})
+	}()
+
+	// give the second pull time to find the one in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-first; err != pullErr {
+		t.Fatalf("expected the pull error; received %v", err)
+	}
+	if err := <-second; err != pullErr || pulls != 0 {
+		t.Fatalf("expected the in flight pull to be shared; received %v after %d pulls", err, pulls)
+	}
+
+	// once done the image is pulled again
+	if err := e.sharedPull("redis", func() error { pulls++; return nil }); err != nil || pulls != 1 {
+		t.Fatalf("expected a new pull; received %v after %d pulls", err, pulls)
+	}
+}
+
+func TestPullKey(t *testing.T) {
+	for _, image := range []string{"redis", "redis:latest", "docker.io/library/redis", "docker.io/library/redis:latest"} {
+		if key := pullKey(image); key != "docker.io/library/redis:latest" {
+			t.Errorf("%s: expected docker.io/library/redis:latest; received %s", image, key)
+		}
+	}
+	if key := pullKey("localhost:5000/web:1"); key != "localhost:5000/web:1" {
+		t.Errorf("expected the registry to be kept; received %s", key)
+	}
+	if key := pullKey("redis:3"); key == pullKey("redis") {
+		t.Error("expected the tags to be different pulls")
+	}
+}
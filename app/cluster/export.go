@@ -0,0 +1,163 @@
+package cluster
+
+import (
+	"strings"
+
+	"github.com/samalba/dockerclient"
+)
+
+// Export returns an image definition that runs a container equivalent to
+// the given one. Values that are docker defaults or come from the docker
+// image, such as its env, cmd and volumes, are left out. The container name,
+// owner, team and dockerMan labels are not exported so the definition can be
+// run more than once by anyone.
+func (e *Engine) Export(c *Container) (*Image, error) {
+	_, image, err := e.inspectImage(c)
+	if err != nil {
+		return nil, err
+	}
+
+	image.Owner = ""
+	image.Team = ""
+	image.Service = ""
+	image.Spec = ""
+	for k := range image.DockerLabels {
+		if strings.HasPrefix(k, labelPrefix) {
+			delete(image.DockerLabels, k)
+		}
+	}
+	if len(image.DockerLabels) == 0 {
+		image.DockerLabels = nil
+	}
+
+	return image, nil
+}
+
+// inspectImage returns the inspect data of the container and the full
+// definition of the container, metadata included
+func (e *Engine) inspectImage(c *Container) (*dockerclient.ContainerInfo, *Image, error) {
+	info, err := e.client.InspectContainer(c.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	container, err := containerFromInfo(info.Id, info.Config.Image, info, e)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the image may have been removed since the container was created
+	imageInfo, err := e.client.InspectImage(info.Image)
+	if err != nil {
+		logger.Warnf("unable to inspect image %s of %s: %s", info.Image, c.ID, err)
+		imageInfo = nil
+	}
+	withoutDefaults(container.Image, info, imageInfo)
+
+	return info, container.Image, nil
+}
+
+// withoutDefaults clears the values of the image read from a container that
+// docker would set anyway, either from the docker image or by default
+func withoutDefaults(image *Image, info *dockerclient.ContainerInfo, imageInfo *dockerclient.ImageInfo) {
+	imageConfig := &dockerclient.ContainerConfig{}
+	if imageInfo != nil && imageInfo.Config != nil {
+		imageConfig = imageInfo.Config
+	}
+
+	for _, e := range imageConfig.Env {
+		vals := strings.SplitN(e, "=", 2)
+		if v, ok := image.Environment[vals[0]]; ok && len(vals) == 2 && v == vals[1] {
+			delete(image.Environment, vals[0])
+		}
+	}
+	if len(image.Environment) == 0 {
+		image.Environment = nil
+	}
+
+	if equalStrings(image.Args, imageConfig.Cmd) {
+		image.Args = nil
+	}
+	if equalStrings(image.Entrypoint, imageConfig.Entrypoint) {
+		image.Entrypoint = nil
+	}
+	if image.User == imageConfig.User {
+		image.User = ""
+	}
+	if image.WorkingDir == imageConfig.WorkingDir {
+		image.WorkingDir = ""
+	}
+
+	for k, v := range image.DockerLabels {
+		if l, ok := imageConfig.Labels[k]; ok && l == v {
+			delete(image.DockerLabels, k)
+		}
+	}
+	if len(image.DockerLabels) == 0 {
+		image.DockerLabels = nil
+	}
+
+	var volumes []string
+	for _, v := range image.Volumes {
+		if _, ok := imageConfig.Volumes[v]; !ok {
+			volumes = append(volumes, v)
+		}
+	}
+	image.Volumes = volumes
+
+	if len(image.Labels) == 0 {
+		image.Labels = nil
+	}
+
+	// docker names the host after the container id by default
+	if strings.HasPrefix(info.Id, image.Hostname) {
+		image.Hostname = ""
+	}
+
+	// json-file is docker's default log driver
+	if image.LogDriver == "json-file" && len(image.LogOptions) == 0 {
+		image.LogDriver = ""
+		image.LogOptions = nil
+	}
+
+	if image.RestartPolicy.Name == "no" {
+		image.RestartPolicy = RestartPolicy{}
+	}
+
+	switch image.NetworkMode {
+	case "default", "bridge":
+		image.NetworkMode = ""
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type portsByContainerPort []*Port
+
+func (p portsByContainerPort) Len() int {
+	return len(p)
+}
+
+func (p portsByContainerPort) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+func (p portsByContainerPort) Less(i, j int) bool {
+	if p[i].ContainerPort != p[j].ContainerPort {
+		return p[i].ContainerPort < p[j].ContainerPort
+	}
+	if p[i].Proto != p[j].Proto {
+		return p[i].Proto < p[j].Proto
+	}
+	return p[i].Port < p[j].Port
+}
@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestExportImage(t *testing.T) {
+	info := &dockerclient.ContainerInfo{
+		Id: "0123456789abcdef",
+		Config: &dockerclient.ContainerConfig{
+			Hostname:  "0123456789ab",
+			Image:     "team/web@" + testDigest,
+			Cmd:       []string{"serve", "--debug"},
+			Env:       []string{"PATH=/usr/bin", "LANG=C", "MODE=dev", "_dockerMan_image=team/web:1", "_dockerMan_type=service", "_dockerMan_labels=", "_dockerMan_build=42", "DB_PASSWORD=hunter2", "_dockerMan_secrets=DB_PASSWORD=db"},
+			Memory:    256 * 1024 * 1024,
+			CpuShares: 50,
+			Volumes: map[string]struct{}{
+				"/data":  struct{}{},
+				"/cache": struct{}{},
+				"/logs":  struct{}{},
+			},
+		},
+		HostConfig: &dockerclient.HostConfig{
+			Binds: []string{"/srv/logs:/logs:ro"},
+			Links: []string{"/db:/web/database"},
+			PortBindings: map[string][]dockerclient.PortBinding{
+				"8080/tcp": {{HostPort: "80"}},
+				"53/udp":   {{HostIp: "127.0.0.1", HostPort: ""}},
+			},
+			RestartPolicy: dockerclient.RestartPolicy{Name: "no"},
+			NetworkMode:   "bridge",
+		},
+		State:           &dockerclient.State{},
+		NetworkSettings: &dockerclient.NetworkSettings{},
+	}
+	imageInfo := &dockerclient.ImageInfo{
+		Config: &dockerclient.ContainerConfig{
+			Cmd:     []string{"serve"},
+			Env:     []string{"PATH=/usr/bin", "LANG=C"},
+			Volumes: map[string]struct{}{"/data": struct{}{}},
+		},
+	}
+
+	expected := &Image{
+		Name:        "team/web:1",
+		Type:        "service",
+		Args:        []string{"serve", "--debug"},
+		Environment: map[string]string{"MODE": "dev"},
+		Secrets:     map[string]string{"DB_PASSWORD": "db"},
+		Memory:      256,
+		// legacy metadata without a label of its own is kept as a label
+		DockerLabels: map[string]string{"com.dockerman.build": "42"},
+		Cpus:         1,
+		Volumes:      []string{"/srv/logs:/logs:ro", "/cache"},
+		Links:        map[string]string{"db": "database"},
+		BindPorts: []*Port{
+			{HostIp: "127.0.0.1", Proto: "udp", ContainerPort: 53},
+			{Proto: "tcp", Port: 80, ContainerPort: 8080},
+		},
+	}
+
+	e := &Engine{Cpus: 2}
+	image := readImage(t, e, info)
+	withoutDefaults(image, info, imageInfo)
+	if !reflect.DeepEqual(image, expected) {
+		t.Fatalf("expected %+v; received %+v", expected, image)
+	}
+
+	// without the docker image nothing can be attributed to it
+	image = readImage(t, e, info)
+	withoutDefaults(image, info, nil)
+	if image.Environment["LANG"] != "C" || len(image.Volumes) != 3 {
+		t.Fatalf("expected image values to be kept; received %+v", image)
+	}
+}
+
+func readImage(t *testing.T, e *Engine, info *dockerclient.ContainerInfo) *Image {
+	c, err := containerFromInfo(info.Id, info.Config.Image, info, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Image
+}
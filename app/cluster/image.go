@@ -22,6 +22,10 @@ type Image struct {
     // Envionrment is the environment vars to set on the container
     Environment map[string]string `json:"environment,omitempty"`
 
+    // Secrets maps environment vars to the names of the secrets whose values
+    // they are set to; the values are only resolved when the container starts
+    Secrets map[string]string `json:"secrets,omitempty"`
+
     // Hostname is the host name to set for the container
     Hostname string `json:"hostname,omitempty"`
 
@@ -61,8 +65,69 @@ type Image struct {
     // NetworkMode is the network mode for the container
     NetworkMode string `json:"network_mode,omitempty"`
 
+    // Networks are the user defined networks the container is attached to;
+    // without a network mode the container is created on the first one
+    Networks []*NetworkAttachment `json:"networks,omitempty"`
+
     // ContainerName is the name set to the container
     ContainerName string `json:"container_name,omitempty"`
+
+    // PullPolicy is when the engine pulls the image before starting the
+    // container; always, if-not-present (the default) or never
+    PullPolicy string `json:"pull_policy,omitempty"`
+
+    // User is the user, and optionally group, the container process runs as
+    User string `json:"user,omitempty"`
+
+    // WorkingDir is the working directory of the container process
+    WorkingDir string `json:"working_dir,omitempty"`
+
+    // Dns are the dns servers of the container
+    Dns []string `json:"dns,omitempty"`
+
+    // DnsSearch are the dns search domains of the container
+    DnsSearch []string `json:"dns_search,omitempty"`
+
+    // ExtraHosts are host:ip mappings added to the container's /etc/hosts
+    ExtraHosts []string `json:"extra_hosts,omitempty"`
+
+    // CapAdd are the kernel capabilities added to the container
+    CapAdd []string `json:"cap_add,omitempty"`
+
+    // CapDrop are the kernel capabilities dropped from the container
+    CapDrop []string `json:"cap_drop,omitempty"`
+
+    // Ulimits are the resource limits of the container process
+    Ulimits []Ulimit `json:"ulimits,omitempty"`
+
+    // LogDriver is the docker log driver of the container
+    LogDriver string `json:"log_driver,omitempty"`
+
+    // LogOptions are the options of the log driver
+    LogOptions map[string]string `json:"log_options,omitempty"`
+
+    // MemorySwap is the total of memory and swap in MB; -1 for unlimited swap
+    MemorySwap float64 `json:"memory_swap,omitempty"`
+
+    // PidsLimit is the maximum number of processes in the container
+    PidsLimit int64 `json:"pids_limit,omitempty"`
+
+    // DockerLabels are the docker labels set on the container; they are
+    // not matched with engine labels
+    DockerLabels map[string]string `json:"docker_labels,omitempty"`
+
+    // Owner is the user the container was started for
+    Owner string `json:"owner,omitempty"`
+
+    // Team is the team owning the container; only its members see it
+    Team string `json:"team,omitempty"`
+
+    // Service is the manifest service the container belongs to
+    Service string `json:"service,omitempty"`
+
+    // Spec is the hash of the manifest service definition the container
+    // was started from; it is only set by the manifest
+    Spec string `json:"-"`
 }
 
 type RestartPolicy struct {
@@ -70,6 +135,12 @@ type RestartPolicy struct {
     MaximumRetryCount int64  `json:"maximum_retry,omitempty"`
 }
 
+type Ulimit struct {
+    Name string `json:"name,omitempty"`
+    Soft int64  `json:"soft,omitempty"`
+    Hard int64  `json:"hard,omitempty"`
+}
+
 func (i *Image) String() string {
     return fmt.Sprintf("image %s type %s cpus %f cpuset %s memory %f", i.Name, i.Type, i.Cpus, i.Cpuset, i.Memory)
 }
@@ -0,0 +1,247 @@
+package cluster
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samalba/dockerclient"
+)
+
+// ImageGCOptions controls which images are removed by an image garbage collection
+type ImageGCOptions struct {
+	// MinAge is the minimum age of an image before it can be removed
+	MinAge time.Duration `json:"min_age,omitempty"`
+
+	// Protected are image names, tags or glob patterns that are never removed
+	Protected []string `json:"protected,omitempty"`
+
+	// DryRun reports what would be removed without removing anything
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Labels restricts the collection to engines carrying all the labels
+	Labels []string `json:"labels,omitempty"`
+}
+
+// ImageGCReport is the result of an image garbage collection on an engine
+type ImageGCReport struct {
+	// Engine is the id of the collected engine
+	Engine string `json:"engine,omitempty"`
+
+	// Time is when the collection started
+	Time time.Time `json:"time,omitempty"`
+
+	// DryRun is true if no images were actually removed
+	DryRun bool `json:"dry_run"`
+
+	// Removed are the images removed, or that would be removed on a dry run
+	Removed []*ClusterImage `json:"removed,omitempty"`
+
+	// Reclaimed is the approximate number of bytes freed
+	Reclaimed int64 `json:"reclaimed"`
+
+	// Errors are the errors hit while collecting
+	Errors []string `json:"errors,omitempty"`
+}
+
+// minProtectedIDLength is the length of the shortest image id prefix that
+// protects an image, as in the short ids docker prints
+const minProtectedIDLength = 12
+
+// isProtected returns true if the image id or any of its tags match the protected list
+func isProtected(id string, tags []string, protected []string) bool {
+	id = strings.TrimPrefix(id, "sha256:")
+	for _, p := range protected {
+		if p == "" {
+			continue
+		}
+		if prefix := strings.TrimPrefix(p, "sha256:"); len(prefix) >= minProtectedIDLength && strings.HasPrefix(id, prefix) {
+			return true
+		}
+		for _, t := range tags {
+			if t == p {
+				return true
+			}
+			// a bare repository protects every tag of it
+			if info := ParseImageName(t); info.Name == p {
+				return true
+			}
+			if ok, _ := path.Match(p, t); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usedImages returns the ids of the images used by any container on the engine
+func (e *Engine) usedImages() (map[string]bool, error) {
+	containers, err := e.client.ListContainers(true, false, "")
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, c := range containers {
+		info, err := e.client.InspectContainer(c.Id)
+		if err != nil {
+			return nil, err
+		}
+		used[info.Image] = true
+	}
+
+	return used, nil
+}
+
+// imageBusy returns true if the image was pulled within the minimum age or
+// is being pulled or started on the engine. Images built long ago are
+// only as old as their pull, which is known for the pulls made since the
+// controller started.
+func (e *Engine) imageBusy(i *dockerclient.Image, minAge time.Duration) bool {
+	e.pullMux.Lock()
+	defer e.pullMux.Unlock()
+
+	refs := []string{}
+	for ref, pulled := range e.pulled {
+		if time.Since(pulled) < minAge {
+			refs = append(refs, ref)
+		}
+	}
+	for ref := range e.pulls {
+		refs = append(refs, ref)
+	}
+	for ref := range e.starting {
+		refs = append(refs, ref)
+	}
+
+	for _, ref := range refs {
+		info, err := ParseImageReference(ref)
+		if err != nil {
+			// not a reference; it can only be an image id
+			if strings.HasPrefix(strings.TrimPrefix(i.Id, "sha256:"), strings.TrimPrefix(ref, "sha256:")) {
+				return true
+			}
+			continue
+		}
+		if imageMatches(i, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectImages removes the images on the engine that are not used by any
+// container, running or stopped, nor pulled or started recently, and are
+// older than the minimum age
+func (e *Engine) CollectImages(opts *ImageGCOptions) *ImageGCReport {
+	report := &ImageGCReport{
+		Engine:  e.ID,
+		Time:    time.Now(),
+		DryRun:  opts.DryRun,
+		Removed: []*ClusterImage{},
+	}
+
+	used, err := e.usedImages()
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+
+	images, err := e.Images()
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+
+	for _, i := range images {
+		tags := []string{}
+		for _, t := range i.RepoTags {
+			if t != "<none>:<none>" {
+				tags = append(tags, t)
+			}
+		}
+
+		if used[i.Id] || isProtected(i.Id, tags, opts.Protected) {
+			continue
+		}
+		if time.Since(time.Unix(i.Created, 0)) < opts.MinAge || e.imageBusy(i, opts.MinAge) {
+			continue
+		}
+
+		if !opts.DryRun {
+			if err := e.removeImage(i.Id, tags); err != nil {
+				logger.Errorf("error removing image %s on %s: %s", i.Id, e.ID, err)
+				report.Errors = append(report.Errors, err.Error())
+				continue
+			}
+			logger.Infof("removed image %s %v on %s", i.Id, tags, e.ID)
+		}
+
+		report.Removed = append(report.Removed, &ClusterImage{
+			ID:          i.Id,
+			Tags:        tags,
+			Size:        i.Size,
+			VirtualSize: i.VirtualSize,
+			Created:     i.Created,
+		})
+		report.Reclaimed += i.Size
+	}
+
+	return report
+}
+
+// removeImage untags every tag of the image, which removes it once the
+// last tag is gone; untagged images are removed by id. Nothing is untagged
+// if any of the tags was moved to another image since the images were
+// listed.
+func (e *Engine) removeImage(id string, tags []string) error {
+	if len(tags) == 0 {
+		_, err := e.client.RemoveImage(id, false)
+		return err
+	}
+
+	for _, t := range tags {
+		info, err := e.client.InspectImage(t)
+		if err != nil {
+			return err
+		}
+		if info.Id != id {
+			return fmt.Errorf("tag %s no longer refers to image %s", t, id)
+		}
+	}
+	for _, t := range tags {
+		if _, err := e.client.RemoveImage(t, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CollectImages runs an image garbage collection on the matching engines in parallel
+func (c *Cluster) CollectImages(opts *ImageGCOptions) []*ImageGCReport {
+	var (
+		wg      sync.WaitGroup
+		mux     sync.Mutex
+		engines = c.EnginesWithLabels(opts.Labels)
+		reports = []*ImageGCReport{}
+	)
+
+	for _, e := range engines {
+		wg.Add(1)
+		go func(e *Engine) {
+			defer wg.Done()
+
+			r := e.CollectImages(opts)
+
+			mux.Lock()
+			reports = append(reports, r)
+			mux.Unlock()
+		}(e)
+	}
+	wg.Wait()
+
+	return reports
+}
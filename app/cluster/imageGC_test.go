@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestIsProtected(t *testing.T) {
+	protected := []string{"busybox", "registry.local/*", "app:stable", "sha256:abc123def456", "fedcba987654", "abc"}
+
+	tests := []struct {
+		id        string
+		tags      []string
+		protected bool
+	}{
+		{"fff", []string{"busybox:latest"}, true},
+		{"fff", []string{"busybox:1.0"}, true},
+		{"fff", []string{"registry.local/app:1"}, true},
+		{"fff", []string{"app:stable", "app:latest"}, true},
+		{"fff", []string{"app:latest"}, false},
+		{"sha256:abc123def4567890", []string{}, true},
+		{"abc123def4567890", []string{}, true},
+		{"sha256:fedcba9876543210", []string{}, true},
+		{"sha256:abc0000000000000", []string{}, false},
+		{"fff", []string{}, false},
+	}
+
+	for _, test := range tests {
+		if p := isProtected(test.id, test.tags, protected); p != test.protected {
+			t.Errorf("expected protected=%t for %s %v; received %t", test.protected, test.id, test.tags, p)
+		}
+	}
+}
+
+func TestImageBusy(t *testing.T) {
+	e := &Engine{}
+	redis := &dockerclient.Image{Id: "sha256:1111", RepoTags: []string{"redis:3"}}
+	nginx := &dockerclient.Image{Id: "sha256:2222", RepoTags: []string{"nginx:latest"}}
+
+	e.pulled = map[string]time.Time{
+		"redis:3": time.Now(),
+		"nginx":   time.Now().Add(-2 * time.Hour),
+	}
+	if !e.imageBusy(redis, time.Hour) {
+		t.Error("expected an image pulled within the minimum age to be busy")
+	}
+	if e.imageBusy(nginx, time.Hour) {
+		t.Error("expected an image pulled before the minimum age not to be busy")
+	}
+
+	done := e.trackStart("docker.io/library/nginx:latest")
+	if !e.imageBusy(nginx, time.Hour) {
+		t.Error("expected an image being started to be busy")
+	}
+	done()
+	if e.imageBusy(nginx, time.Hour) {
+		t.Error("expected the start to be done")
+	}
+
+	e.pulls = map[string]*pullCall{"nginx": {}}
+	if !e.imageBusy(nginx, 0) {
+		t.Error("expected an image being pulled to be busy")
+	}
+}
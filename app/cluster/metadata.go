@@ -0,0 +1,311 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samalba/dockerclient"
+)
+
+// dockerMan records what it knows about a container that docker does not,
+// such as the requested resources, as docker labels under labelPrefix.
+// Containers started by earlier versions carry it in env vars instead.
+const (
+	labelPrefix = "com.dockerman."
+
+	LabelType    = labelPrefix + "type"
+	LabelLabels  = labelPrefix + "labels"
+	LabelCpus    = labelPrefix + "cpus"
+	LabelMemory  = labelPrefix + "memory"
+	LabelOwner   = labelPrefix + "owner"
+	LabelTeam    = labelPrefix + "team"
+	LabelService = labelPrefix + "service"
+	LabelImage   = labelPrefix + "image"
+	LabelSecrets = labelPrefix + "secrets"
+	LabelSpec    = labelPrefix + "spec"
+)
+
+var (
+	// legacyEnvPrefixes are the env var prefixes metadata was stored under
+	legacyEnvPrefixes = []string{"_dockerMan_", "_citadel_"}
+
+	knownLabels = map[string]bool{
+		LabelType:    true,
+		LabelLabels:  true,
+		LabelCpus:    true,
+		LabelMemory:  true,
+		LabelOwner:   true,
+		LabelTeam:    true,
+		LabelService: true,
+		LabelImage:   true,
+		LabelSecrets: true,
+		LabelSpec:    true,
+	}
+)
+
+var ErrReservedLabel = fmt.Errorf("labels starting with %s are reserved", labelPrefix)
+
+// ValidateDockerLabels returns an error if any of the labels is reserved
+// for the metadata dockerMan records
+func ValidateDockerLabels(labels map[string]string) error {
+	for k := range labels {
+		if strings.HasPrefix(k, labelPrefix) {
+			return ErrReservedLabel
+		}
+	}
+	return nil
+}
+
+// metadataLabels returns the labels recording the image's metadata; the
+// image name is only recorded when the container runs a resolved digest.
+// Every known label is set, empty if unset, so the LABELs of the docker
+// image cannot stand in for them.
+func (i *Image) metadataLabels(pinned bool) map[string]string {
+	labels := make(map[string]string)
+	for k := range knownLabels {
+		labels[k] = ""
+	}
+
+	set := func(k, v string) {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	set(LabelType, i.Type)
+	set(LabelLabels, strings.Join(i.Labels, ","))
+	set(LabelOwner, i.Owner)
+	set(LabelTeam, i.Team)
+	set(LabelService, i.Service)
+	set(LabelSecrets, formatSecretRefs(i.Secrets))
+	set(LabelSpec, i.Spec)
+	if i.Cpus > 0 {
+		set(LabelCpus, strconv.FormatFloat(i.Cpus, 'f', -1, 64))
+	}
+	if i.Memory > 0 {
+		set(LabelMemory, strconv.FormatFloat(i.Memory, 'f', -1, 64))
+	}
+	if pinned {
+		// keep the tag the digest was resolved from
+		set(LabelImage, i.Name)
+	}
+
+	return labels
+}
+
+// containerMetadata is the metadata read back from a container
+type containerMetadata struct {
+	// values are keyed by label
+	values map[string]string
+
+	// env and labels are what is left for the application
+	env    []string
+	labels map[string]string
+
+	// legacy is true if any metadata was read from env vars
+	legacy bool
+}
+
+// readMetadata splits the metadata from the container's env and labels.
+// Labels take precedence over the legacy env vars; legacy env vars that
+// have no label counterpart are kept as labels under labelPrefix.
+func readMetadata(env []string, labels map[string]string) *containerMetadata {
+	md := &containerMetadata{
+		values: make(map[string]string),
+		env:    []string{},
+	}
+
+	for k, v := range labels {
+		if knownLabels[k] {
+			md.values[k] = v
+			continue
+		}
+		if md.labels == nil {
+			md.labels = make(map[string]string)
+		}
+		md.labels[k] = v
+	}
+
+	for _, e := range env {
+		k := strings.SplitN(e, "=", 2)[0]
+		name, ok := legacyEnvName(k)
+		if !ok || k == userDataEnv {
+			md.env = append(md.env, e)
+			continue
+		}
+
+		md.legacy = true
+		v := strings.TrimPrefix(e, k+"=")
+		label := labelPrefix + name
+		if knownLabels[label] {
+			if _, ok := md.values[label]; !ok {
+				md.values[label] = v
+			}
+			continue
+		}
+		if _, ok := md.labels[label]; !ok {
+			if md.labels == nil {
+				md.labels = make(map[string]string)
+			}
+			md.labels[label] = v
+		}
+	}
+
+	return md
+}
+
+func legacyEnvName(k string) (string, bool) {
+	for _, prefix := range legacyEnvPrefixes {
+		if strings.HasPrefix(k, prefix) {
+			return strings.TrimPrefix(k, prefix), true
+		}
+	}
+	return "", false
+}
+
+// apply sets the metadata on the image; the requested cpus and memory
+// replace the values derived from the docker config
+func (md *containerMetadata) apply(i *Image) {
+	if v := md.values[LabelType]; v != "" {
+		i.Type = v
+	}
+	if v := md.values[LabelLabels]; v != "" {
+		i.Labels = strings.Split(v, ",")
+	}
+	if v := md.values[LabelOwner]; v != "" {
+		i.Owner = v
+	}
+	if v := md.values[LabelTeam]; v != "" {
+		i.Team = v
+	}
+	if v := md.values[LabelService]; v != "" {
+		i.Service = v
+	}
+	if v := md.values[LabelSpec]; v != "" {
+		i.Spec = v
+	}
+	if v := md.values[LabelImage]; v != "" {
+		i.Name = v
+	}
+	if v := md.values[LabelSecrets]; v != "" {
+		i.Secrets = parseSecretRefs(v)
+	}
+	if v, err := strconv.ParseFloat(md.values[LabelCpus], 64); err == nil {
+		i.Cpus = v
+	}
+	if v, err := strconv.ParseFloat(md.values[LabelMemory], 64); err == nil {
+		i.Memory = v
+	}
+}
+
+// formatSecretRefs records secret references as sorted VAR=secret pairs
+func formatSecretRefs(secrets map[string]string) string {
+	refs := []string{}
+	for k, name := range secrets {
+		refs = append(refs, k+"="+name)
+	}
+	sort.Strings(refs)
+	return strings.Join(refs, ",")
+}
+
+// MigrateMetadata recreates a container whose metadata is stored in env
+// vars so it is stored in labels. Docker labels cannot be added to an
+// existing container, so the container is started again from its
+// definition on the same engine under a temporary name; the old container
+// is only removed, and the new one renamed, once it is running. The
+// volumes mounted by the old container are mounted by name; a stopped
+// container is stopped again after starting.
+func (e *Engine) MigrateMetadata(c *Container) (*Container, error) {
+	info, image, err := e.inspectImage(c)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimPrefix(info.Name, "/")
+	migrated := &Container{
+		Name:  name + "-migrating",
+		Image: image,
+	}
+	if ref, err := ParseImageReference(info.Config.Image); err == nil {
+		migrated.ImageDigest = ref.Digest
+	}
+	image.ContainerName = migrated.Name
+	// volumes declared by the image are anonymous volumes of the old
+	// container; the new one would get empty ones
+	image.Volumes = mountVolumes(image.Volumes, info.Mounts)
+
+	// the old container is stopped so its ports are free and the volumes
+	// are not written by both containers
+	if info.State.Running {
+		if err := e.client.StopContainer(c.ID, 8); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.Start(migrated); err != nil {
+		if info.State.Running {
+			if serr := e.client.StartContainer(c.ID, nil); serr != nil {
+				logger.Warnf("unable to restart container %s after a failed migration: %s", c.ID, serr)
+			}
+		}
+		return nil, err
+	}
+
+	if err := e.client.RemoveContainer(c.ID, true, false); err != nil {
+		return migrated, err
+	}
+	if err := e.Rename(migrated, name); err != nil {
+		return migrated, err
+	}
+	image.ContainerName = name
+
+	if !info.State.Running {
+		if err := e.Stop(migrated); err != nil {
+			return migrated, err
+		}
+		migrated.State = "stopped"
+	} else {
+		migrated.State = "running"
+	}
+
+	return migrated, nil
+}
+
+// mountVolumes returns the volumes with the named volumes mounted by a
+// container in place of the volumes with the same destination
+func mountVolumes(volumes []string, mounts []*dockerclient.MountPoint) []string {
+	named := map[string]string{}
+	for _, m := range mounts {
+		if m.Name == "" {
+			continue
+		}
+		v := m.Name + ":" + m.Destination
+		if !m.RW {
+			v += ":ro"
+		}
+		named[m.Destination] = v
+	}
+
+	result := []string{}
+	for _, v := range volumes {
+		if _, ok := named[volumeDestination(v)]; !ok {
+			result = append(result, v)
+		}
+	}
+	for _, m := range mounts {
+		if v, ok := named[m.Destination]; ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// volumeDestination returns the path a volume is mounted at in the
+// container
+func volumeDestination(v string) string {
+	parts := strings.Split(v, ":")
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return parts[1]
+}
@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestReadMetadataLegacyEnv(t *testing.T) {
+	tests := []struct {
+		env    []string
+		labels map[string]string
+	}{
+		{env: []string{"MODE=dev", "_citadel_type=service", "_citadel_labels=zone:a,ssd"}},
+		{env: []string{"MODE=dev", "_dockerMan_type=service", "_dockerMan_labels=zone:a,ssd"}},
+		{
+			env:    []string{"MODE=dev", "_dockerMan_type=batch"},
+			labels: map[string]string{LabelType: "service", LabelLabels: "zone:a,ssd"},
+		},
+	}
+
+	for _, test := range tests {
+		md := readMetadata(test.env, test.labels)
+
+		image := &Image{}
+		md.apply(image)
+
+		if image.Type != "service" || !reflect.DeepEqual(image.Labels, []string{"zone:a", "ssd"}) {
+			t.Errorf("%v: unexpected metadata type %q labels %v", test.env, image.Type, image.Labels)
+		}
+		if !reflect.DeepEqual(md.env, []string{"MODE=dev"}) {
+			t.Errorf("%v: expected the metadata to be removed from the env; received %v", test.env, md.env)
+		}
+		if !md.legacy {
+			t.Errorf("%v: expected legacy metadata", test.env)
+		}
+	}
+}
+
+func TestReadMetadataLabels(t *testing.T) {
+	labels := map[string]string{
+		LabelCpus:          "0.5",
+		LabelMemory:        "128",
+		LabelOwner:         "alice",
+		LabelTeam:          "payments",
+		LabelImage:         "team/web:1",
+		LabelSecrets:       "DB_PASSWORD=db",
+		"com.example.team": "web",
+	}
+
+	md := readMetadata([]string{"_dockerMan_build=42", userDataEnv + "={}"}, labels)
+	image := &Image{Name: "team/web@" + testDigest, Cpus: 0.49, Memory: 127}
+	md.apply(image)
+
+	expected := &Image{
+		Name:    "team/web:1",
+		Cpus:    0.5,
+		Memory:  128,
+		Owner:   "alice",
+		Team:    "payments",
+		Secrets: map[string]string{"DB_PASSWORD": "db"},
+	}
+	if !reflect.DeepEqual(image, expected) {
+		t.Fatalf("expected %+v; received %+v", expected, image)
+	}
+
+	expectedLabels := map[string]string{"com.example.team": "web", labelPrefix + "build": "42"}
+	if !reflect.DeepEqual(md.labels, expectedLabels) {
+		t.Fatalf("expected labels %v; received %v", expectedLabels, md.labels)
+	}
+	if !reflect.DeepEqual(md.env, []string{userDataEnv + "={}"}) {
+		t.Fatalf("expected the user data to stay in the env; received %v", md.env)
+	}
+}
+
+func TestMountVolumes(t *testing.T) {
+	volumes := []string{"/data", "cache:/cache", "/srv/logs:/logs:ro"}
+	mounts := []*dockerclient.MountPoint{
+		{Name: "3f1c", Source: "/var/lib/docker/volumes/3f1c/_data", Destination: "/data", RW: true},
+		{Name: "cache", Destination: "/cache", RW: true},
+		{Source: "/srv/logs", Destination: "/logs"},
+		{Name: "seed", Destination: "/seed"},
+	}
+
+	expected := []string{"/srv/logs:/logs:ro", "3f1c:/data", "cache:/cache", "seed:/seed:ro"}
+	if v := mountVolumes(volumes, mounts); !reflect.DeepEqual(v, expected) {
+		t.Fatalf("expected %v; received %v", expected, v)
+	}
+}
+
+func TestValidateDockerLabels(t *testing.T) {
+	if err := ValidateDockerLabels(map[string]string{"com.example.team": "web"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{LabelTeam, LabelService, LabelCpus, LabelMemory, LabelSpec, labelPrefix + "other"} {
+		if err := ValidateDockerLabels(map[string]string{k: "x"}); err == nil {
+			t.Errorf("expected %s to be rejected", k)
+		}
+	}
+}
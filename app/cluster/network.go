@@ -0,0 +1,370 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/samalba/dockerclient"
+)
+
+var (
+	ErrNetworkDoesNotExist = errors.New("network does not exist")
+	ErrNetworkNameRequired = errors.New("network name is required")
+)
+
+// builtinNetworks are the networks docker creates on every engine; they are
+// selected with the network mode rather than attached
+var builtinNetworks = map[string]bool{
+	"bridge": true,
+	"host":   true,
+	"none":   true,
+}
+
+// Network is a docker network on an engine
+type Network struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Driver string `json:"driver,omitempty"`
+	Scope  string `json:"scope,omitempty"`
+
+	// Subnets are the address ranges of the network
+	Subnets []string `json:"subnets,omitempty"`
+
+	// Containers are the ids of the containers attached to the network
+	Containers []string `json:"containers,omitempty"`
+
+	Engine *Engine `json:"engine,omitempty"`
+}
+
+// NetworkConfig is a network to create on one or more engines
+type NetworkConfig struct {
+	Name    string            `json:"name,omitempty"`
+	Driver  string            `json:"driver,omitempty"`
+	Subnet  string            `json:"subnet,omitempty"`
+	Gateway string            `json:"gateway,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
+
+	// Engine is the id of the engine to create the network on; when empty
+	// the network is created on every engine matching the labels
+	Engine string   `json:"engine,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// NetworkAttachment is a network a container is attached to
+type NetworkAttachment struct {
+	Name string `json:"name,omitempty"`
+
+	// Aliases are the names other containers on the network resolve to
+	// the container
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// IsBuiltinNetwork returns true for the networks docker creates on every
+// engine
+func IsBuiltinNetwork(name string) bool {
+	return builtinNetworks[name]
+}
+
+// Networks returns the networks on the engine
+func (e *Engine) Networks() ([]*Network, error) {
+	resources, err := e.client.ListNetworks("")
+	if err != nil {
+		return nil, err
+	}
+
+	networks := []*Network{}
+	for _, r := range resources {
+		networks = append(networks, e.network(r))
+	}
+	return networks, nil
+}
+
+func (e *Engine) network(r *dockerclient.NetworkResource) *Network {
+	n := &Network{
+		ID:     r.ID,
+		Name:   r.Name,
+		Driver: r.Driver,
+		Scope:  r.Scope,
+		Engine: e,
+	}
+	for _, c := range r.IPAM.Config {
+		if c.Subnet != "" {
+			n.Subnets = append(n.Subnets, c.Subnet)
+		}
+	}
+	for id := range r.Containers {
+		n.Containers = append(n.Containers, id)
+	}
+	sort.Strings(n.Containers)
+	return n
+}
+
+// CreateNetwork creates the network on the engine
+func (e *Engine) CreateNetwork(config *NetworkConfig) (*Network, error) {
+	if config.Name == "" {
+		return nil, ErrNetworkNameRequired
+	}
+
+	create := &dockerclient.NetworkCreate{
+		Name:           config.Name,
+		CheckDuplicate: true,
+		Driver:         config.Driver,
+		Options:        config.Options,
+	}
+	if config.Subnet != "" || config.Gateway != "" {
+		create.IPAM.Config = []dockerclient.IPAMConfig{
+			{
+				Subnet:  config.Subnet,
+				Gateway: config.Gateway,
+			},
+		}
+	}
+
+	resp, err := e.client.CreateNetwork(create)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Warning != "" {
+		logger.Warnf("network %s on %s: %s", config.Name, e.ID, resp.Warning)
+	}
+
+	r, err := e.client.InspectNetwork(resp.ID)
+	if err != nil {
+		return nil, err
+	}
+	return e.network(r), nil
+}
+
+// RemoveNetwork removes the network with the name or id from the engine
+func (e *Engine) RemoveNetwork(id string) error {
+	return e.client.RemoveNetwork(id)
+}
+
+// ConnectNetwork attaches the container to the network; the container is
+// reachable on the network under its name and the aliases
+func (e *Engine) ConnectNetwork(c *Container, network string, aliases []string) error {
+	return e.connectNetwork(c.ID, network, aliases)
+}
+
+// DisconnectNetwork detaches the container from the network
+func (e *Engine) DisconnectNetwork(c *Container, network string) error {
+	return e.client.DisconnectNetwork(network, c.ID, false)
+}
+
+// connectNetwork posts the connect request directly as the docker client
+// cannot set the endpoint aliases
+func (e *Engine) connectNetwork(id, network string, aliases []string) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"Container": id,
+		"EndpointConfig": &dockerclient.EndpointSettings{
+			Aliases: aliases,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.request("POST", "/networks/"+url.PathEscape(network)+"/connect", bytes.NewReader(data), "application/json")
+	if err != nil {
+		if isNotFound(err) {
+			return ErrNetworkDoesNotExist
+		}
+		return fmt.Errorf("unable to connect %s to network %s: %s", id, network, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// networks returns the network mode of the container, the network attached
+// when the container is created and the networks connected before it starts.
+// Without a network mode the container is only on the image networks.
+func (i *Image) networks() (string, *NetworkAttachment, []*NetworkAttachment, error) {
+	mode := i.NetworkMode
+	if len(i.Networks) == 0 {
+		return mode, nil, nil, nil
+	}
+	for _, n := range i.Networks {
+		if n == nil || n.Name == "" {
+			return "", nil, nil, ErrNetworkNameRequired
+		}
+	}
+
+	switch {
+	case mode == "":
+		mode = i.Networks[0].Name
+	case mode == "host" || mode == "none" || strings.HasPrefix(mode, "container:"):
+		return "", nil, nil, fmt.Errorf("networks cannot be attached in network mode %s", mode)
+	}
+
+	var (
+		primary *NetworkAttachment
+		extra   = []*NetworkAttachment{}
+	)
+	for _, n := range i.Networks {
+		if n.Name == mode && primary == nil {
+			primary = n
+			continue
+		}
+		extra = append(extra, n)
+	}
+	return mode, primary, extra, nil
+}
+
+// readNetworks returns the networks the container is attached to besides the
+// builtin ones and the address of the container on every network
+func readNetworks(id string, settings *dockerclient.NetworkSettings) ([]*NetworkAttachment, map[string]string) {
+	var (
+		attached  []*NetworkAttachment
+		addresses = make(map[string]string)
+		names     = []string{}
+	)
+	if settings == nil {
+		return nil, nil
+	}
+
+	for name := range settings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		endpoint := settings.Networks[name]
+		if endpoint == nil {
+			continue
+		}
+		if endpoint.IPAddress != "" {
+			addresses[name] = endpoint.IPAddress
+		}
+		if builtinNetworks[name] {
+			continue
+		}
+
+		n := &NetworkAttachment{Name: name}
+		for _, a := range endpoint.Aliases {
+			// docker aliases every container with its short id
+			if id != "" && strings.HasPrefix(id, a) {
+				continue
+			}
+			n.Aliases = append(n.Aliases, a)
+		}
+		attached = append(attached, n)
+	}
+
+	// daemons without per network settings only report the bridge address
+	if len(settings.Networks) == 0 && settings.IPAddress != "" {
+		addresses["bridge"] = settings.IPAddress
+	}
+
+	if len(addresses) == 0 {
+		addresses = nil
+	}
+	return attached, addresses
+}
+
+// attachedNetworkMode returns the network mode to report for a container on
+// the attached networks; the mode is left empty when it names one of them
+func attachedNetworkMode(mode string, attached []*NetworkAttachment) string {
+	for _, n := range attached {
+		if n.Name == mode {
+			return ""
+		}
+	}
+	return mode
+}
+
+// Networks returns the networks of every engine in the cluster
+func (c *Cluster) Networks() []*Network {
+	networks := []*Network{}
+
+	for _, e := range c.Engines() {
+		n, err := e.Networks()
+		if err != nil {
+			// skip engines that are not available
+			logger.Warnf("unable to list networks on %s: %s", e.ID, err)
+			continue
+		}
+		networks = append(networks, n...)
+	}
+
+	sort.Sort(networksByName(networks))
+	return networks
+}
+
+// CreateNetwork creates the network on the engine of the config or on every
+// engine matching its labels. The networks created before an engine fails
+// are returned with the error.
+func (c *Cluster) CreateNetwork(config *NetworkConfig) ([]*Network, error) {
+	engines, err := c.selectEngines(config.Engine, config.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("no engines match labels %v", config.Labels)
+	}
+	sort.Sort(enginesByID(engines))
+
+	created := []*Network{}
+	for _, e := range engines {
+		n, err := e.CreateNetwork(config)
+		if err != nil {
+			return created, fmt.Errorf("%s: %s", e.ID, err)
+		}
+		created = append(created, n)
+	}
+	return created, nil
+}
+
+// RemoveNetwork removes the network with the name or id from the engine, or
+// from every engine when engineID is empty
+func (c *Cluster) RemoveNetwork(name, engineID string) ([]*Network, error) {
+	engines, err := c.selectEngines(engineID, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(enginesByID(engines))
+
+	removed := []*Network{}
+	for _, e := range engines {
+		networks, err := e.Networks()
+		if err != nil {
+			return removed, fmt.Errorf("%s: %s", e.ID, err)
+		}
+
+		for _, n := range networks {
+			if n.Name != name && n.ID != name {
+				continue
+			}
+			if err := e.RemoveNetwork(n.ID); err != nil {
+				return removed, fmt.Errorf("%s: %s", e.ID, err)
+			}
+			removed = append(removed, n)
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil, ErrNetworkDoesNotExist
+	}
+	return removed, nil
+}
+
+type networksByName []*Network
+
+func (n networksByName) Len() int {
+	return len(n)
+}
+
+func (n networksByName) Swap(i, j int) {
+	n[i], n[j] = n[j], n[i]
+}
+
+func (n networksByName) Less(i, j int) bool {
+	if n[i].Name != n[j].Name {
+		return n[i].Name < n[j].Name
+	}
+	return n[i].Engine.ID < n[j].Engine.ID
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestImageNetworks(t *testing.T) {
+	front := &NetworkAttachment{Name: "front", Aliases: []string{"web"}}
+	back := &NetworkAttachment{Name: "back"}
+
+	tests := []struct {
+		image   *Image
+		mode    string
+		primary *NetworkAttachment
+		extra   []*NetworkAttachment
+	}{
+		{&Image{NetworkMode: "bridge"}, "bridge", nil, nil},
+		{&Image{Networks: []*NetworkAttachment{front, back}}, "front", front, []*NetworkAttachment{back}},
+		{&Image{NetworkMode: "back", Networks: []*NetworkAttachment{front, back}}, "back", back, []*NetworkAttachment{front}},
+		{&Image{NetworkMode: "bridge", Networks: []*NetworkAttachment{front}}, "bridge", nil, []*NetworkAttachment{front}},
+	}
+
+	for _, test := range tests {
+		mode, primary, extra, err := test.image.networks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode != test.mode || primary != test.primary || len(extra) != len(test.extra) {
+			t.Errorf("expected %s %v %v; received %s %v %v", test.mode, test.primary, test.extra, mode, primary, extra)
+			continue
+		}
+		for i := range extra {
+			if extra[i] != test.extra[i] {
+				t.Errorf("expected %v; received %v", test.extra, extra)
+			}
+		}
+	}
+
+	if _, _, _, err := (&Image{NetworkMode: "host", Networks: []*NetworkAttachment{front}}).networks(); err == nil {
+		t.Error("expected an error attaching networks in host mode")
+	}
+	for _, networks := range [][]*NetworkAttachment{{nil}, {front, {}}} {
+		if _, _, _, err := (&Image{Networks: networks}).networks(); err != ErrNetworkNameRequired {
+			t.Errorf("expected %v; received %v", ErrNetworkNameRequired, err)
+		}
+	}
+}
+
+func TestContainerNetworksRoundTrip(t *testing.T) {
+	e := &Engine{ID: "engine-1", Cpus: 1}
+	image := &Image{
+		Name: "team/web:1",
+		Networks: []*NetworkAttachment{
+			{Name: "back"},
+			{Name: "front", Aliases: []string{"web", "www"}},
+		},
+	}
+
+	config, hostConfig, err := e.containerConfig(&Container{Image: image}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostConfig.NetworkMode != "back" || config.NetworkingConfig.EndpointsConfig["back"] == nil {
+		t.Fatalf("expected the container to be created on the first network; received %s %v", hostConfig.NetworkMode, config.NetworkingConfig.EndpointsConfig)
+	}
+
+	id := "0123456789abcdef"
+	info := &dockerclient.ContainerInfo{
+		Id:         id,
+		Config:     config,
+		HostConfig: hostConfig,
+		State:      &dockerclient.State{Running: true},
+		NetworkSettings: &dockerclient.NetworkSettings{
+			Networks: map[string]*dockerclient.EndpointSettings{
+				"back":  {IPAddress: "10.0.1.2", Aliases: []string{id[:12]}},
+				"front": {IPAddress: "10.0.2.2", Aliases: []string{id[:12], "web", "www"}},
+			},
+		},
+	}
+
+	c, err := containerFromInfo(id, config.Image, info, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Image.NetworkMode != "" || !reflect.DeepEqual(c.Image.Networks, image.Networks) {
+		t.Fatalf("expected %v; received %q %v", image.Networks, c.Image.NetworkMode, c.Image.Networks)
+	}
+
+	expected := map[string]string{"back": "10.0.1.2", "front": "10.0.2.2"}
+	if !reflect.DeepEqual(c.IPAddresses, expected) {
+		t.Fatalf("expected %v; received %v", expected, c.IPAddresses)
+	}
+}
+
+func TestReadNetworksBridge(t *testing.T) {
+	networks, addresses := readNetworks("id", &dockerclient.NetworkSettings{IPAddress: "172.17.0.2"})
+	if networks != nil || addresses["bridge"] != "172.17.0.2" {
+		t.Fatalf("expected the bridge address only; received %v %v", networks, addresses)
+	}
+}
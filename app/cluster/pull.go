@@ -0,0 +1,197 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	PullStatusPulling = "pulling"
+	PullStatusPulled  = "pulled"
+	PullStatusError   = "error"
+)
+
+// PullStatus is the progress of an image pull on a single engine
+type PullStatus struct {
+	// Engine is the id of the engine pulling the image
+	Engine string `json:"engine,omitempty"`
+
+	// Image is the image being pulled
+	Image string `json:"image,omitempty"`
+
+	// Status is one of pulling, pulled or error
+	Status string `json:"status,omitempty"`
+
+	// Error is the pull error if the status is error
+	Error string `json:"error,omitempty"`
+
+	// Elapsed is the time in seconds the pull took
+	Elapsed float64 `json:"elapsed,omitempty"`
+}
+
+// EnginesWithLabels returns the engines carrying all of the given labels
+func (c *Cluster) EnginesWithLabels(labels []string) []*Engine {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	out := []*Engine{}
+	for _, e := range c.engines {
+		if e.HasLabels(labels) {
+			out = append(out, e)
+		}
+	}
+
+	return out
+}
+
+// selectEngines returns the engine with the id, if it matches the labels,
+// or, without an id, the engines matching the labels
+func (c *Cluster) selectEngines(engineID string, labels []string) ([]*Engine, error) {
+	if engineID == "" {
+		return c.EnginesWithLabels(labels), nil
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	e := c.engines[engineID]
+	if e == nil {
+		return nil, fmt.Errorf("engine with id %s is not in cluster", engineID)
+	}
+	if !e.HasLabels(labels) {
+		return nil, ErrEngineNotEligible
+	}
+	return []*Engine{e}, nil
+}
+
+// Pull pulls the image onto every engine matching the labels in parallel.
+// The returned channel receives a pulling status for each engine followed by
+// its result and is closed once all engines are done.
+func (c *Cluster) Pull(image string, labels []string) (<-chan *PullStatus, error) {
+	engines := c.EnginesWithLabels(labels)
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("no engines match labels %v", labels)
+	}
+
+	name := ParseImageName(image).String()
+
+	var (
+		wg     sync.WaitGroup
+		status = make(chan *PullStatus, len(engines)*2)
+	)
+
+	for _, e := range engines {
+		status <- &PullStatus{
+			Engine: e.ID,
+			Image:  name,
+			Status: PullStatusPulling,
+		}
+
+		wg.Add(1)
+		go func(e *Engine) {
+			defer wg.Done()
+
+			start := time.Now()
+			s := &PullStatus{
+				Engine: e.ID,
+				Image:  name,
+				Status: PullStatusPulled,
+			}
+			if err := e.Pull(name); err != nil {
+				logger.Errorf("error pulling %s on %s: %s", name, e.ID, err)
+				s.Status = PullStatusError
+				s.Error = err.Error()
+			}
+			s.Elapsed = time.Since(start).Seconds()
+			status <- s
+		}(e)
+	}
+
+	go func() {
+		wg.Wait()
+		close(status)
+	}()
+
+	return status, nil
+}
+
+// ResolveDigest pulls the image on the first connected engine of the cluster
+// and returns the repository digest its tag points to
+func (c *Cluster) ResolveDigest(image string) (string, error) {
+	info, err := ParseImageReference(image)
+	if err != nil {
+		return "", err
+	}
+	if info.Digest != "" {
+		return info.Digest, nil
+	}
+
+	e := c.resolveEngine()
+	if e == nil {
+		return "", fmt.Errorf("no connected engines to resolve %s", image)
+	}
+
+	if err := e.Pull(info.String()); err != nil {
+		return "", err
+	}
+
+	images, err := e.Images()
+	if err != nil {
+		return "", err
+	}
+
+	for _, i := range images {
+		tagged := false
+		for _, t := range i.RepoTags {
+			if ti, err := ParseImageReference(t); err == nil && sameRepository(ti, info) && ti.Tag == info.Tag {
+				tagged = true
+				break
+			}
+		}
+		if !tagged {
+			continue
+		}
+
+		for _, d := range i.RepoDigests {
+			if di, err := ParseImageReference(d); err == nil && sameRepository(di, info) && di.Digest != "" {
+				logger.Infof("resolved %s to %s on %s", info.String(), di.Digest, e.ID)
+				return di.Digest, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no digest found for %s on %s", info.String(), e.ID)
+}
+
+// resolveEngine returns the connected engine digests are resolved on, the
+// same one every time while it stays connected
+func (c *Cluster) resolveEngine() *Engine {
+	engines := c.Engines()
+	sort.Sort(enginesByID(engines))
+	for _, e := range engines {
+		if e.IsConnected() {
+			return e
+		}
+	}
+	return nil
+}
+
+func sameRepository(a, b *ImageInfo) bool {
+	return a.Registry == b.Registry && a.Repository == b.Repository
+}
+
+type enginesByID []*Engine
+
+func (e enginesByID) Len() int {
+	return len(e)
+}
+
+func (e enginesByID) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+}
+
+func (e enginesByID) Less(i, j int) bool {
+	return e[i].ID < e[j].ID
+}
@@ -0,0 +1,161 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/samalba/dockerclient"
+)
+
+const (
+	PullAlways       = "always"
+	PullIfNotPresent = "if-not-present"
+	PullNever        = "never"
+
+	// DefaultPullPolicy is used for images without a pull policy
+	DefaultPullPolicy = PullIfNotPresent
+
+	pullAttempts = 4
+	pullBackoff  = time.Second
+)
+
+var ErrUnknownPullPolicy = fmt.Errorf("unknown pull policy; expected %s, %s or %s",
+	PullAlways, PullIfNotPresent, PullNever)
+
+// serverErrorStatus matches the 5xx status codes in registry and docker
+// errors, such as "status: 503" or "Status 500", and not the port of an
+// address such as localhost:5000
+var serverErrorStatus = regexp.MustCompile(`(?i)\bstatus:?\s*5\d\d\b`)
+
+// ValidatePullPolicy returns an error for unknown pull policies
+func ValidatePullPolicy(policy string) error {
+	switch policy {
+	case "", PullAlways, PullIfNotPresent, PullNever:
+		return nil
+	}
+	return ErrUnknownPullPolicy
+}
+
+// pullForPolicy pulls the image onto the engine as required by the policy
+func (e *Engine) pullForPolicy(ref string, policy string) error {
+	if policy == "" {
+		policy = DefaultPullPolicy
+	}
+
+	switch policy {
+	case PullAlways:
+		return e.Pull(ref)
+	case PullIfNotPresent:
+		present, err := e.HasImage(ref)
+		if err != nil {
+			return err
+		}
+		if present {
+			return nil
+		}
+		return e.Pull(ref)
+	case PullNever:
+		return nil
+	}
+
+	return ValidatePullPolicy(policy)
+}
+
+// HasImage returns true if the image reference is present on the engine
+func (e *Engine) HasImage(ref string) (bool, error) {
+	images, err := e.Images()
+	if err != nil {
+		return false, err
+	}
+
+	info, err := ParseImageReference(ref)
+	if err != nil {
+		// not a reference; it can only be an image id
+		for _, i := range images {
+			if strings.HasPrefix(i.Id, ref) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	for _, i := range images {
+		if imageMatches(i, info) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// imageMatches returns true if the image carries the tag or digest of the reference
+func imageMatches(i *dockerclient.Image, info *ImageInfo) bool {
+	if info.Digest != "" {
+		for _, d := range i.RepoDigests {
+			if di, err := ParseImageReference(d); err == nil && sameRepository(di, info) && di.Digest == info.Digest {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, t := range i.RepoTags {
+		if ti, err := ParseImageReference(t); err == nil && sameRepository(ti, info) && ti.Tag == info.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// pullWithRetry pulls the image, retrying transient failures with an
+// exponential backoff
+func (e *Engine) pullWithRetry(image string) error {
+	var (
+		err     error
+		backoff = pullBackoff
+	)
+
+	for attempt := 1; attempt <= pullAttempts; attempt++ {
+		if err = e.client.PullImage(image, e.authFor(image)); err == nil {
+			return nil
+		}
+		if !isTransientPullError(err) || attempt == pullAttempts {
+			break
+		}
+
+		logger.Warnf("pull of %s on %s failed (attempt %d/%d), retrying in %s: %s",
+			image, e.ID, attempt, pullAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	return err
+}
+
+// isTransientPullError returns true for network and registry availability
+// errors worth retrying, and false for errors such as a missing image or
+// rejected credentials
+func isTransientPullError(err error) bool {
+	if err == nil || err == dockerclient.ErrNotFound {
+		return false
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"not found", "unauthorized", "authentication required", "denied", "invalid reference"} {
+		if strings.Contains(msg, s) {
+			return false
+		}
+	}
+	for _, s := range []string{"timeout", "timed out", "connection reset", "connection refused", "eof",
+		"tls handshake", "temporary", "too many requests"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return serverErrorStatus.MatchString(msg)
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestImageMatches(t *testing.T) {
+	img := &dockerclient.Image{
+		Id:          "abc",
+		RepoTags:    []string{"busybox:latest", "localhost:5000/team/app:v1"},
+		RepoDigests: []string{"localhost:5000/team/app@" + testDigest},
+	}
+
+	tests := []struct {
+		ref     string
+		matches bool
+	}{
+		{"busybox", true},
+		{"busybox:latest", true},
+		{"docker.io/library/busybox:latest", true},
+		{"busybox:1.0", false},
+		{"localhost:5000/team/app:v1", true},
+		{"localhost:5000/team/app", false},
+		{"team/app:v1", false},
+		{"localhost:5000/team/app@" + testDigest, true},
+		{"busybox@" + testDigest, false},
+	}
+
+	for _, test := range tests {
+		info, err := ParseImageReference(test.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := imageMatches(img, info); m != test.matches {
+			t.Errorf("%q: expected match %t; received %t", test.ref, test.matches, m)
+		}
+	}
+}
+
+func TestIsTransientPullError(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{dockerclient.ErrNotFound, false},
+		{errors.New("Error: image team/app not found"), false},
+		{errors.New("unauthorized: authentication required"), false},
+		{errors.New("net/http: TLS handshake timeout"), true},
+		{errors.New("read tcp: connection reset by peer"), true},
+		{errors.New("received unexpected HTTP status: 503 Service Unavailable"), true},
+		{errors.New("Status 500 trying to pull repository team/app"), true},
+		{errors.New("Get https://localhost:5000/v2/: http: server gave HTTP response to HTTPS client"), false},
+		{errors.New("pull of localhost:5000/team/app:5021 failed"), false},
+		{errors.New("invalid tag format"), false},
+	}
+
+	for _, test := range tests {
+		if tr := isTransientPullError(test.err); tr != test.transient {
+			t.Errorf("%v: expected transient %t; received %t", test.err, test.transient, tr)
+		}
+	}
+}
+
+func TestValidatePullPolicy(t *testing.T) {
+	for _, p := range []string{"", PullAlways, PullIfNotPresent, PullNever} {
+		if err := ValidatePullPolicy(p); err != nil {
+			t.Errorf("expected %q to be valid; received %s", p, err)
+		}
+	}
+	if err := ValidatePullPolicy("sometimes"); err == nil {
+		t.Error("expected an error for an unknown pull policy")
+	}
+}
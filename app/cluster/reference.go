@@ -0,0 +1,191 @@
+package cluster
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry used for images without a registry host
+	DefaultRegistry = "docker.io"
+
+	// DefaultTag is the tag used for references without a tag or digest
+	DefaultTag = "latest"
+
+	// officialRepoPrefix is the docker hub namespace of single component names
+	officialRepoPrefix = "library/"
+
+	maxNameLength = 255
+)
+
+var (
+	ErrReferenceInvalidFormat = errors.New("invalid image reference format")
+	ErrNameContainsUppercase  = errors.New("repository name must be lowercase")
+	ErrNameTooLong            = errors.New("repository name must not be more than 255 characters")
+	ErrDigestInvalidFormat    = errors.New("invalid digest format")
+
+	// the reference grammar from docker's distribution project:
+	//
+	//  reference        := name [ ":" tag ] [ "@" digest ]
+	//  name             := [domain '/'] path-component ['/' path-component]*
+	//  domain           := domain-component ['.' domain-component]* [':' port-number]
+	//  domain-component := /([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])/
+	//  port-number      := /[0-9]+/
+	//  path-component   := alpha-numeric [separator alpha-numeric]*
+	//  alpha-numeric    := /[a-z0-9]+/
+	//  separator        := /[_.]|__|[-]*/
+	//  tag              := /[\w][\w.-]{0,127}/
+	//  digest           := algorithm ":" hex
+	//  algorithm        := component [ /[+.-_]/ component ]*
+	//  component        := /[A-Za-z][A-Za-z0-9]*/
+	//  hex              := /[0-9a-fA-F]{32,}/
+	alphaNumeric    = `[a-z0-9]+`
+	separator       = `(?:[._]|__|[-]*)`
+	pathComponent   = alphaNumeric + `(?:` + separator + alphaNumeric + `)*`
+	domainComponent = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	domain          = domainComponent + `(?:\.` + domainComponent + `)*(?::[0-9]+)?`
+	name            = `(?:` + domain + `/)?` + pathComponent + `(?:/` + pathComponent + `)*`
+	tag             = `[\w][\w.-]{0,127}`
+	digest          = `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}`
+
+	referenceRegexp = regexp.MustCompile(`^(` + name + `)(?::(` + tag + `))?(?:@(` + digest + `))?$`)
+)
+
+// ImageInfo is a parsed image reference
+type ImageInfo struct {
+	// Registry is the registry host, DefaultRegistry for docker hub images
+	Registry string `json:"registry,omitempty"`
+
+	// Repository is the repository path within the registry, e.g. library/busybox
+	Repository string `json:"repository,omitempty"`
+
+	// Name is the repository as written, including any registry host
+	Name string `json:"name,omitempty"`
+
+	// Tag is the image tag; DefaultTag if neither a tag nor a digest is given
+	Tag string `json:"tag,omitempty"`
+
+	// Digest is the content digest, e.g. sha256:...
+	Digest string `json:"digest,omitempty"`
+}
+
+// String returns the reference in name[:tag][@digest] form
+func (i *ImageInfo) String() string {
+	ref := i.Name
+	if i.Tag != "" {
+		ref += ":" + i.Tag
+	}
+	if i.Digest != "" {
+		ref += "@" + i.Digest
+	}
+	return ref
+}
+
+// ParseImageReference parses an image reference following docker's reference grammar
+func ParseImageReference(ref string) (*ImageInfo, error) {
+	m := referenceRegexp.FindStringSubmatch(ref)
+	if m == nil {
+		if ref != "" && referenceRegexp.MatchString(strings.ToLower(ref)) {
+			return nil, ErrNameContainsUppercase
+		}
+		return nil, ErrReferenceInvalidFormat
+	}
+
+	n, t, d := m[1], m[2], m[3]
+	if len(n) > maxNameLength {
+		return nil, ErrNameTooLong
+	}
+	if d != "" {
+		if err := validateDigest(d); err != nil {
+			return nil, err
+		}
+	}
+
+	info := &ImageInfo{
+		Registry:   DefaultRegistry,
+		Repository: n,
+		Name:       n,
+		Tag:        t,
+		Digest:     d,
+	}
+
+	if host, remainder := splitRegistry(n); host != "" {
+		info.Registry = NormalizeRegistry(host)
+		info.Repository = remainder
+	}
+	if info.Registry == DefaultRegistry && !strings.Contains(info.Repository, "/") {
+		info.Repository = officialRepoPrefix + info.Repository
+	}
+	if info.Tag == "" && info.Digest == "" {
+		info.Tag = DefaultTag
+	}
+
+	return info, nil
+}
+
+// ParseImageName parses an image name, falling back to the name as written
+// with the default tag if it is not a valid reference
+func ParseImageName(name string) *ImageInfo {
+	info, err := ParseImageReference(name)
+	if err != nil {
+		return &ImageInfo{
+			Registry:   DefaultRegistry,
+			Repository: name,
+			Name:       name,
+			Tag:        DefaultTag,
+		}
+	}
+	return info
+}
+
+// splitRegistry splits the registry host from a name; the first component is
+// a host if it contains a dot or port, is localhost or has uppercase letters
+func splitRegistry(name string) (string, string) {
+	i := strings.Index(name, "/")
+	if i == -1 {
+		return "", name
+	}
+
+	host := name[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" && strings.ToLower(host) == host {
+		return "", name
+	}
+	return host, name[i+1:]
+}
+
+func validateDigest(d string) error {
+	i := strings.Index(d, ":")
+	algorithm, hex := d[:i], d[i+1:]
+
+	switch algorithm {
+	case "sha256":
+		if len(hex) != 64 {
+			return ErrDigestInvalidFormat
+		}
+	case "sha384":
+		if len(hex) != 96 {
+			return ErrDigestInvalidFormat
+		}
+	case "sha512":
+		if len(hex) != 128 {
+			return ErrDigestInvalidFormat
+		}
+	}
+	return nil
+}
+
+// NormalizeRegistry maps the aliases of the docker hub to DefaultRegistry
+func NormalizeRegistry(host string) string {
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	if i := strings.Index(host, "/"); i > -1 {
+		host = host[:i]
+	}
+
+	switch host {
+	case "", "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return DefaultRegistry
+	}
+	return host
+}
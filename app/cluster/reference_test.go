@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		ref        string
+		registry   string
+		repository string
+		name       string
+		tag        string
+		digest     string
+		err        error
+	}{
+		{ref: "busybox", registry: "docker.io", repository: "library/busybox", name: "busybox", tag: "latest"},
+		{ref: "busybox:1.0", registry: "docker.io", repository: "library/busybox", name: "busybox", tag: "1.0"},
+		{ref: "team/app", registry: "docker.io", repository: "team/app", name: "team/app", tag: "latest"},
+		{ref: "team/app:v2", registry: "docker.io", repository: "team/app", name: "team/app", tag: "v2"},
+		{ref: "docker.io/library/busybox", registry: "docker.io", repository: "library/busybox", name: "docker.io/library/busybox", tag: "latest"},
+		{ref: "index.docker.io/team/app", registry: "docker.io", repository: "team/app", name: "index.docker.io/team/app", tag: "latest"},
+		{ref: "localhost/app", registry: "localhost", repository: "app", name: "localhost/app", tag: "latest"},
+		{ref: "localhost:5000/team/app", registry: "localhost:5000", repository: "team/app", name: "localhost:5000/team/app", tag: "latest"},
+		{ref: "localhost:5000/team/app:1.2.3", registry: "localhost:5000", repository: "team/app", name: "localhost:5000/team/app", tag: "1.2.3"},
+		{ref: "registry.example.com/a/b/c:tag_1", registry: "registry.example.com", repository: "a/b/c", name: "registry.example.com/a/b/c", tag: "tag_1"},
+		{ref: "Registry.Example.com/app", registry: "Registry.Example.com", repository: "app", name: "Registry.Example.com/app", tag: "latest"},
+		{ref: "localhost:5000", registry: "docker.io", repository: "library/localhost", name: "localhost", tag: "5000"},
+		{ref: "app@" + testDigest, registry: "docker.io", repository: "library/app", name: "app", digest: testDigest},
+		{ref: "app:v1@" + testDigest, registry: "docker.io", repository: "library/app", name: "app", tag: "v1", digest: testDigest},
+		{ref: "localhost:5000/app@" + testDigest, registry: "localhost:5000", repository: "app", name: "localhost:5000/app", digest: testDigest},
+		{ref: "a-b_c__d/e.f--g:t", registry: "docker.io", repository: "a-b_c__d/e.f--g", name: "a-b_c__d/e.f--g", tag: "t"},
+		{ref: "", err: ErrReferenceInvalidFormat},
+		{ref: ":tag", err: ErrReferenceInvalidFormat},
+		{ref: "app:", err: ErrReferenceInvalidFormat},
+		{ref: "app:-tag", err: ErrReferenceInvalidFormat},
+		{ref: "app:" + strings.Repeat("t", 129), err: ErrReferenceInvalidFormat},
+		{ref: "-app", err: ErrReferenceInvalidFormat},
+		{ref: "app_", err: ErrReferenceInvalidFormat},
+		{ref: "a/../b", err: ErrReferenceInvalidFormat},
+		{ref: "team//app", err: ErrReferenceInvalidFormat},
+		{ref: "localhost:port/app", err: ErrReferenceInvalidFormat},
+		{ref: "App", err: ErrNameContainsUppercase},
+		{ref: "team/App:v1", err: ErrNameContainsUppercase},
+		{ref: "app@sha256:abc", err: ErrReferenceInvalidFormat},
+		{ref: "app@sha256:" + strings.Repeat("f", 63), err: ErrDigestInvalidFormat},
+		{ref: "app@" + testDigest + ":tag", err: ErrReferenceInvalidFormat},
+		{ref: strings.Repeat("a", 256), err: ErrNameTooLong},
+	}
+
+	for _, test := range tests {
+		info, err := ParseImageReference(test.ref)
+		if test.err != nil {
+			if err != test.err {
+				t.Errorf("%q: expected error %v; received %v", test.ref, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.ref, err)
+			continue
+		}
+		if info.Registry != test.registry {
+			t.Errorf("%q: expected registry %q; received %q", test.ref, test.registry, info.Registry)
+		}
+		if info.Repository != test.repository {
+			t.Errorf("%q: expected repository %q; received %q", test.ref, test.repository, info.Repository)
+		}
+		if info.Name != test.name {
+			t.Errorf("%q: expected name %q; received %q", test.ref, test.name, info.Name)
+		}
+		if info.Tag != test.tag {
+			t.Errorf("%q: expected tag %q; received %q", test.ref, test.tag, info.Tag)
+		}
+		if info.Digest != test.digest {
+			t.Errorf("%q: expected digest %q; received %q", test.ref, test.digest, info.Digest)
+		}
+	}
+}
+
+func TestImageInfoString(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"busybox", "busybox:latest"},
+		{"localhost:5000/team/app:v1", "localhost:5000/team/app:v1"},
+		{"app@" + testDigest, "app@" + testDigest},
+		{"app:v1@" + testDigest, "app:v1@" + testDigest},
+	}
+
+	for _, test := range tests {
+		if s := ParseImageName(test.ref).String(); s != test.expected {
+			t.Errorf("expected %q; received %q", test.expected, s)
+		}
+	}
+}
+
+func TestParseImageNameFallback(t *testing.T) {
+	info := ParseImageName("Not A Reference")
+	if info.Name != "Not A Reference" || info.Tag != DefaultTag || info.Registry != DefaultRegistry {
+		t.Fatalf("expected fallback to the name as written; received %+v", info)
+	}
+}
+
+func TestNormalizeRegistry(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"", "docker.io"},
+		{"docker.io", "docker.io"},
+		{"index.docker.io", "docker.io"},
+		{"https://index.docker.io/v1/", "docker.io"},
+		{"registry-1.docker.io", "docker.io"},
+		{"localhost:5000", "localhost:5000"},
+		{"http://registry.example.com/", "registry.example.com"},
+	}
+
+	for _, test := range tests {
+		if h := NormalizeRegistry(test.host); h != test.expected {
+			t.Errorf("%q: expected %q; received %q", test.host, test.expected, h)
+		}
+	}
+}
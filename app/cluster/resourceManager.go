@@ -40,7 +40,11 @@ func (r *ResourceManager) PlaceContainer(c *Container,
 		logger.Infof("memory score: %f, cpu score: %f, total score: %f", memoryScore, cpuScore, total)
 
 		if cpuScore <= 100 && memoryScore <= 100 {
-			scores = append(scores, &score{r: e, score: total})
+			scores = append(scores, &score{
+				r:              e,
+				score:          total,
+				missingVolumes: len(c.Image.NamedVolumes()) - len(e.Volumes),
+			})
 		}
 	}
 
@@ -7,6 +7,10 @@ import (
 type score struct {
 	r     *EngineSnapshot
 	score float64
+
+	// missingVolumes is the number of named volumes of the container the
+	// engine does not hold; engines holding them are preferred
+	missingVolumes int
 }
 
 type scores []*score
@@ -29,5 +33,8 @@ func (s scores) Less(i, j int) bool {
 		jp = s[j]
 	)
 
+	if ip.missingVolumes != jp.missingVolumes {
+		return ip.missingVolumes < jp.missingVolumes
+	}
 	return ip.score < jp.score
 }
@@ -24,3 +24,29 @@ func TestSortScores(t *testing.T) {
 		t.Fatalf("expected last score to be 9.0 received %f", last.score)
 	}
 }
+
+func TestPlaceContainerPrefersVolumes(t *testing.T) {
+	var (
+		r = NewResourceManager()
+		c = &Container{Image: &Image{Cpus: 1, Memory: 128, Volumes: []string{"data:/data", "/srv:/srv"}}}
+	)
+
+	engines := []*EngineSnapshot{
+		{ID: "idle", Cpus: 4, Memory: 4096},
+		{ID: "busy", Cpus: 4, Memory: 4096, ReservedCpus: 2, ReservedMemory: 2048, Volumes: []string{"data"}},
+	}
+
+	e, err := r.PlaceContainer(c, engines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != "busy" {
+		t.Fatalf("expected the engine holding the volume; received %s", e.ID)
+	}
+
+	// the volume does not make an engine without resources eligible
+	engines[1].ReservedCpus = 4
+	if e, err = r.PlaceContainer(c, engines); err != nil || e.ID != "idle" {
+		t.Fatalf("expected the idle engine; received %v %v", e, err)
+	}
+}
@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SecretResolver returns the value of the named secret for a container of
+// the team
+type SecretResolver func(name, team string) (string, error)
+
+// SetSecretResolver sets the lookup used to resolve the secrets of an image
+func (e *Engine) SetSecretResolver(r SecretResolver) {
+	e.secretResolver = r
+}
+
+// secretEnv resolves the secrets of the image into environment variables;
+// the references are recorded in the LabelSecrets label so the values are
+// never read back
+func (e *Engine) secretEnv(i *Image) ([]string, error) {
+	if len(i.Secrets) == 0 {
+		return nil, nil
+	}
+	if e.secretResolver == nil {
+		return nil, fmt.Errorf("engine %s cannot resolve secrets", e.ID)
+	}
+
+	env := []string{}
+	for k, name := range i.Secrets {
+		if _, ok := i.Environment[k]; ok {
+			return nil, fmt.Errorf("environment variable %s is set both directly and from secret %s", k, name)
+		}
+
+		value, err := e.secretResolver(name, i.Team)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve secret %s: %s", name, err)
+		}
+		env = append(env, fmt.Sprintf("%s=%s", k, value))
+	}
+	return env, nil
+}
+
+// parseSecretRefs reads the references written by formatSecretRefs
+func parseSecretRefs(v string) map[string]string {
+	refs := make(map[string]string)
+	for _, ref := range strings.Split(v, ",") {
+		parts := strings.SplitN(ref, "=", 2)
+		if len(parts) == 2 {
+			refs[parts[0]] = parts[1]
+		}
+	}
+	return refs
+}
+
+// redactEnv masks the values of the variables set from secrets for logging
+func redactEnv(env []string, secrets map[string]string) []string {
+	out := make([]string, len(env))
+	for idx, e := range env {
+		k := strings.SplitN(e, "=", 2)[0]
+		if _, ok := secrets[k]; ok {
+			e = k + "=********"
+		}
+		out[idx] = e
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSecretEnv(t *testing.T) {
+	e := &Engine{ID: "engine-1"}
+	i := &Image{
+		Environment: map[string]string{"MODE": "dev"},
+		Secrets:     map[string]string{"DB_PASSWORD": "db", "API_KEY": "api"},
+	}
+
+	if _, err := e.secretEnv(i); err == nil {
+		t.Fatal("expected an error without a secret resolver")
+	}
+
+	e.SetSecretResolver(func(name, team string) (string, error) {
+		if name == "missing" || team != "" {
+			return "", fmt.Errorf("secret does not exist")
+		}
+		return name + "-value", nil
+	})
+
+	env, err := e.secretEnv(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(env)
+
+	expected := []string{"API_KEY=api-value", "DB_PASSWORD=db-value"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected %v; received %v", expected, env)
+	}
+
+	if refs := parseSecretRefs(formatSecretRefs(i.Secrets)); !reflect.DeepEqual(refs, i.Secrets) {
+		t.Fatalf("expected %v; received %v", i.Secrets, refs)
+	}
+
+	if env, err := e.secretEnv(&Image{}); err != nil || env != nil {
+		t.Fatalf("expected nothing for an image without secrets; received %v %v", env, err)
+	}
+	if _, err := e.secretEnv(&Image{Secrets: map[string]string{"KEY": "missing"}}); err == nil {
+		t.Fatal("expected an error for a missing secret")
+	}
+	if _, err := e.secretEnv(&Image{Team: "payments", Secrets: map[string]string{"KEY": "db"}}); err == nil {
+		t.Fatal("expected an error for a secret of another team")
+	}
+	if _, err := e.secretEnv(&Image{Environment: map[string]string{"KEY": "plain"}, Secrets: map[string]string{"KEY": "db"}}); err == nil {
+		t.Fatal("expected an error for a variable set twice")
+	}
+}
+
+func TestRedactEnv(t *testing.T) {
+	env := []string{"MODE=dev", "DB_PASSWORD=hunter2", "EMPTY"}
+	redacted := redactEnv(env, map[string]string{"DB_PASSWORD": "db"})
+
+	expected := []string{"MODE=dev", "DB_PASSWORD=********", "EMPTY"}
+	if !reflect.DeepEqual(redacted, expected) {
+		t.Fatalf("expected %v; received %v", expected, redacted)
+	}
+	if env[1] != "DB_PASSWORD=hunter2" {
+		t.Fatal("expected the env to be left unchanged")
+	}
+}
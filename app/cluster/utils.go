@@ -1,22 +1,14 @@
 package cluster
 
 import (
-    "fmt"
+    "encoding/json"
+    "sort"
     "strconv"
     "strings"
 
     "github.com/samalba/dockerclient"
 )
 
-type (
-    ImageInfo struct {
-        Name string
-        Tag  string
-    }
-)
-
-
-
 func parsePortInformation(info *dockerclient.ContainerInfo, c *Container) error {
     for pp, b := range info.NetworkSettings.Ports {
         parts := strings.Split(pp, "/")
@@ -74,29 +66,40 @@ func parsePortInformation(info *dockerclient.ContainerInfo, c *Container) error
     return nil
 }
 
+// userDataEnv is the container environment variable holding the json
+// encoded user data of the image
+const userDataEnv = "_dockerMan_user_data"
+
 func FromDockerContainer(id, image string, engine *Engine) (*Container, error) {
     info, err := engine.client.InspectContainer(id)
     if err != nil {
         return nil, err
     }
 
+    return containerFromInfo(id, image, info, engine)
+}
+
+// containerFromInfo reads the container and the image it was started from
+// out of the docker inspect data
+func containerFromInfo(id, image string, info *dockerclient.ContainerInfo, engine *Engine) (*Container, error) {
     var (
-        cType       = ""
+        digest      = ""
         state       = "stopped"
         networkMode = "bridge"
-        labels      = []string{}
         env         = make(map[string]string)
+        userData    map[string][]string
+        md          = readMetadata(info.Config.Env, info.Config.Labels)
     )
 
-    for _, e := range info.Config.Env {
+    for _, e := range md.env {
         vals := strings.SplitN(e, "=", 2)
         k, v := vals[0], vals[1]
 
         switch k {
-        case "_citadel_type":
-            cType = v
-        case "_citadel_labels":
-            labels = strings.Split(v, ",")
+        case userDataEnv:
+            if err := json.Unmarshal([]byte(v), &userData); err != nil {
+                return nil, err
+            }
         case "HOME", "DEBIAN_FRONTEND", "PATH":
             continue
         default:
@@ -104,82 +107,170 @@ func FromDockerContainer(id, image string, engine *Engine) (*Container, error) {
         }
     }
 
+    if ref, err := ParseImageReference(image); err == nil && ref.Digest != "" {
+        digest = ref.Digest
+    }
+
     if info.State.Running {
         state = "running"
     }
 
+    networks, addresses := readNetworks(id, info.NetworkSettings)
     if m := info.HostConfig.NetworkMode; m != "" {
-        networkMode = m
+        networkMode = attachedNetworkMode(m, networks)
+    } else if len(networks) > 0 {
+        networkMode = ""
     }
-    volDefs := info.Config.Volumes
+    // bind mounts are also declared as volumes of their destination
     vols := []string{}
-    for k, _ := range volDefs {
-        vols = append(vols, k)
+    bound := make(map[string]bool)
+    for _, b := range info.HostConfig.Binds {
+        vols = append(vols, b)
+        if parts := strings.Split(b, ":"); len(parts) > 1 {
+            bound[parts[1]] = true
+        }
+    }
+    anonymous := []string{}
+    for k := range info.Config.Volumes {
+        if !bound[k] {
+            anonymous = append(anonymous, k)
+        }
+    }
+    sort.Strings(anonymous)
+    vols = append(vols, anonymous...)
+
+    // links are stored as /target:/container/alias
+    var links map[string]string
+    for _, l := range info.HostConfig.Links {
+        parts := strings.SplitN(l, ":", 2)
+        if len(parts) != 2 {
+            continue
+        }
+        if links == nil {
+            links = make(map[string]string)
+        }
+        links[strings.TrimPrefix(parts[0], "/")] = parts[1][strings.LastIndex(parts[1], "/")+1:]
+    }
+
+    memory := info.Config.Memory
+    if memory == 0 {
+        memory = info.HostConfig.Memory
+    }
+
+    cpuShares := info.Config.CpuShares
+    if cpuShares == 0 {
+        cpuShares = info.HostConfig.CpuShares
+    }
+
+    cpuset := info.Config.Cpuset
+    if cpuset == "" {
+        cpuset = info.HostConfig.CpusetCpus
+    }
+
+    memorySwap := info.Config.MemorySwap
+    if memorySwap == 0 {
+        memorySwap = info.HostConfig.MemorySwap
+    }
+    if memorySwap > 0 {
+        memorySwap = memorySwap / 1024 / 1024
+    }
+
+    var ulimits []Ulimit
+    for _, u := range info.HostConfig.Ulimits {
+        ulimits = append(ulimits, Ulimit{
+            Name: u.Name,
+            Soft: int64(u.Soft),
+            Hard: int64(u.Hard),
+        })
     }
 
     container := &Container{
-        ID:     id,
-        Engine: engine,
-        Name:   info.Name,
-        State:  state,
+        ID:             id,
+        Engine:         engine,
+        Name:           info.Name,
+        State:          state,
+        ImageDigest:    digest,
+        IPAddresses:    addresses,
+        LegacyMetadata: md.legacy,
         Image: &Image{
             Name:        image,
-            Cpus:        float64(info.Config.CpuShares) / 100.0 * engine.Cpus,
-            Cpuset:      info.Config.Cpuset,
-            Memory:      float64(info.Config.Memory / 1024 / 1024),
+            Cpus:        float64(cpuShares) / 100.0 * engine.Cpus,
+            Cpuset:      cpuset,
+            Memory:      float64(memory / 1024 / 1024),
+            MemorySwap:  float64(memorySwap),
             Volumes:     vols,
+            Links:       links,
             Environment: env,
+            UserData:    userData,
+            Args:        info.Config.Cmd,
             Entrypoint:  info.Config.Entrypoint,
             Hostname:    info.Config.Hostname,
             Domainname:  info.Config.Domainname,
-            Type:        cType,
-            Labels:      labels,
+            User:        info.Config.User,
+            WorkingDir:  info.Config.WorkingDir,
+            Labels:      []string{},
             NetworkMode: networkMode,
+            Networks:    networks,
             Publish:     info.HostConfig.PublishAllPorts,
             Privileged:  info.HostConfig.Privileged,
             RestartPolicy: RestartPolicy{
                 Name:              info.HostConfig.RestartPolicy.Name,
                 MaximumRetryCount: info.HostConfig.RestartPolicy.MaximumRetryCount,
             },
+            Dns:          info.HostConfig.Dns,
+            DnsSearch:    info.HostConfig.DnsSearch,
+            ExtraHosts:   info.HostConfig.ExtraHosts,
+            CapAdd:       info.HostConfig.CapAdd,
+            CapDrop:      info.HostConfig.CapDrop,
+            Ulimits:      ulimits,
+            LogDriver:    info.HostConfig.LogConfig.Type,
+            LogOptions:   info.HostConfig.LogConfig.Config,
+            PidsLimit:    info.HostConfig.PidsLimit,
+            DockerLabels: md.labels,
         },
     }
+    md.apply(container.Image)
+
+    // never read back the values set from secrets
+    for k := range container.Image.Secrets {
+        delete(env, k)
+    }
 
     if err := parsePortInformation(info, container); err != nil {
         return nil, err
     }
-    container.Image.BindPorts = container.Ports
+    container.Image.BindPorts = portBindings(info.HostConfig.PortBindings)
 
     return container, nil
 }
 
-func ParseImageName(name string) *ImageInfo {
-    imageInfo := &ImageInfo{
-        Name: name,
-        Tag:  "latest",
-    }
-
-    // image type (top-level / user)
-    switch {
-    case strings.Index(name, "/") == -1:
-        if strings.Index(name, ":") != -1 {
-            parts := strings.Split(name, ":")
-            imageInfo.Name = parts[0]
-            imageInfo.Tag = parts[1]
+// portBindings returns the ports the container was configured to bind,
+// rather than the ones docker picked for it
+func portBindings(bindings map[string][]dockerclient.PortBinding) []*Port {
+    var ports []*Port
+    for key, hostPorts := range bindings {
+        parts := strings.SplitN(key, "/", 2)
+        containerPort, err := strconv.Atoi(parts[0])
+        if err != nil {
+            continue
         }
-    case strings.Index(name, "/") != -1:
-        parts := strings.Split(name, "/")
-        n := strings.Join(parts[:len(parts)-1], "/")
-        t := parts[len(parts)-1]
-        if strings.Index(t, ":") != -1 {
-            tparts := strings.Split(t, ":")
-            n = fmt.Sprintf("%s/%s", n, tparts[0])
-            t = tparts[1]
-        } else {
-            n = name
-            t = "latest"
+        proto := "tcp"
+        if len(parts) == 2 {
+            proto = parts[1]
+        }
+
+        for _, b := range hostPorts {
+            // an empty host port lets docker pick one
+            port, _ := strconv.Atoi(b.HostPort)
+            ports = append(ports, &Port{
+                HostIp:        b.HostIp,
+                Proto:         proto,
+                Port:          port,
+                ContainerPort: containerPort,
+            })
         }
-        imageInfo.Name = n
-        imageInfo.Tag = t
     }
-    return imageInfo
+    sort.Sort(portsByContainerPort(ports))
+
+    return ports
 }
@@ -0,0 +1,280 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samalba/dockerclient"
+)
+
+var (
+	ErrVolumeDoesNotExist = errors.New("volume does not exist")
+	ErrVolumeNameRequired = errors.New("volume name is required")
+)
+
+// Volume is a docker named volume on an engine
+type Volume struct {
+	Name       string `json:"name,omitempty"`
+	Driver     string `json:"driver,omitempty"`
+	Mountpoint string `json:"mountpoint,omitempty"`
+
+	// Containers are the ids of the containers mounting the volume
+	Containers []string `json:"containers,omitempty"`
+
+	Engine *Engine `json:"engine,omitempty"`
+}
+
+// VolumeConfig is a volume to create on one or more engines
+type VolumeConfig struct {
+	Name       string            `json:"name,omitempty"`
+	Driver     string            `json:"driver,omitempty"`
+	DriverOpts map[string]string `json:"driver_opts,omitempty"`
+
+	// Engine is the id of the engine to create the volume on; when empty
+	// the volume is created on every engine matching the labels
+	Engine string   `json:"engine,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// NamedVolumes returns the names of the named volumes mounted by the image
+func (i *Image) NamedVolumes() []string {
+	names := []string{}
+	for _, v := range i.Volumes {
+		if name := volumeName(v); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// volumeName returns the name of the volume of a name:path[:mode] volume
+// string; volumes are named unless their source is an absolute or relative
+// path
+func volumeName(v string) string {
+	parts := strings.Split(v, ":")
+	if len(parts) < 2 || parts[0] == "" || strings.HasPrefix(parts[0], "/") || strings.HasPrefix(parts[0], ".") {
+		return ""
+	}
+	return parts[0]
+}
+
+// Volumes returns the named volumes on the engine with the containers
+// mounting them
+func (e *Engine) Volumes() ([]*Volume, error) {
+	volumes, err := e.client.ListVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := e.volumeUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []*Volume{}
+	for _, v := range volumes {
+		out = append(out, e.volume(v, users[v.Name]))
+	}
+	sort.Sort(volumesByName(out))
+	return out, nil
+}
+
+// Volume returns the named volume on the engine
+func (e *Engine) Volume(name string) (*Volume, error) {
+	volumes, err := e.Volumes()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range volumes {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return nil, ErrVolumeDoesNotExist
+}
+
+// volumeNames returns the names of the named volumes on the engine
+func (e *Engine) volumeNames() (map[string]bool, error) {
+	volumes, err := e.client.ListVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(volumes))
+	for _, v := range volumes {
+		names[v.Name] = true
+	}
+	return names, nil
+}
+
+// volumeUsers maps volume names to the ids of the containers mounting them
+func (e *Engine) volumeUsers() (map[string][]string, error) {
+	containers, err := e.client.ListContainers(true, false, "")
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string][]string)
+	for _, c := range containers {
+		info, err := e.client.InspectContainer(c.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range info.Mounts {
+			if m.Name != "" {
+				users[m.Name] = append(users[m.Name], c.Id)
+			}
+		}
+	}
+	return users, nil
+}
+
+func (e *Engine) volume(v *dockerclient.Volume, containers []string) *Volume {
+	sort.Strings(containers)
+	return &Volume{
+		Name:       v.Name,
+		Driver:     v.Driver,
+		Mountpoint: v.Mountpoint,
+		Containers: containers,
+		Engine:     e,
+	}
+}
+
+// CreateVolume creates the named volume on the engine
+func (e *Engine) CreateVolume(config *VolumeConfig) (*Volume, error) {
+	if config.Name == "" {
+		return nil, ErrVolumeNameRequired
+	}
+
+	v, err := e.client.CreateVolume(&dockerclient.VolumeCreateRequest{
+		Name:       config.Name,
+		Driver:     config.Driver,
+		DriverOpts: config.DriverOpts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.volume(v, nil), nil
+}
+
+// RemoveVolume removes the named volume from the engine; docker refuses to
+// remove volumes mounted by a container
+func (e *Engine) RemoveVolume(name string) error {
+	return e.client.RemoveVolume(name)
+}
+
+// Volumes returns the named volumes of every engine in the cluster
+func (c *Cluster) Volumes(engineID string) ([]*Volume, error) {
+	engines, err := c.selectEngines(engineID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := []*Volume{}
+	for _, e := range engines {
+		v, err := e.Volumes()
+		if err != nil {
+			// skip engines that are not available
+			logger.Warnf("unable to list volumes on %s: %s", e.ID, err)
+			continue
+		}
+		volumes = append(volumes, v...)
+	}
+
+	sort.Sort(volumesByName(volumes))
+	return volumes, nil
+}
+
+// Volume returns the named volume on the engine or on every engine holding
+// it when engineID is empty
+func (c *Cluster) Volume(name, engineID string) ([]*Volume, error) {
+	volumes, err := c.Volumes(engineID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []*Volume{}
+	for _, v := range volumes {
+		if v.Name == name {
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrVolumeDoesNotExist
+	}
+	return out, nil
+}
+
+// CreateVolume creates the volume on the engine of the config or on every
+// engine matching its labels. The volumes created before an engine fails
+// are returned with the error.
+func (c *Cluster) CreateVolume(config *VolumeConfig) ([]*Volume, error) {
+	engines, err := c.selectEngines(config.Engine, config.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("no engines match labels %v", config.Labels)
+	}
+	sort.Sort(enginesByID(engines))
+
+	created := []*Volume{}
+	for _, e := range engines {
+		v, err := e.CreateVolume(config)
+		if err != nil {
+			return created, fmt.Errorf("%s: %s", e.ID, err)
+		}
+		created = append(created, v)
+	}
+	return created, nil
+}
+
+// RemoveVolume removes the named volume from the engine, or from every
+// engine holding it when engineID is empty
+func (c *Cluster) RemoveVolume(name, engineID string) ([]*Volume, error) {
+	engines, err := c.selectEngines(engineID, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(enginesByID(engines))
+
+	removed := []*Volume{}
+	for _, e := range engines {
+		names, err := e.volumeNames()
+		if err != nil {
+			return removed, fmt.Errorf("%s: %s", e.ID, err)
+		}
+		if !names[name] {
+			continue
+		}
+
+		if err := e.RemoveVolume(name); err != nil {
+			return removed, fmt.Errorf("%s: %s", e.ID, err)
+		}
+		removed = append(removed, &Volume{Name: name, Engine: e})
+	}
+
+	if len(removed) == 0 {
+		return nil, ErrVolumeDoesNotExist
+	}
+	return removed, nil
+}
+
+type volumesByName []*Volume
+
+func (v volumesByName) Len() int {
+	return len(v)
+}
+
+func (v volumesByName) Swap(i, j int) {
+	v[i], v[j] = v[j], v[i]
+}
+
+func (v volumesByName) Less(i, j int) bool {
+	if v[i].Name != v[j].Name {
+		return v[i].Name < v[j].Name
+	}
+	return v[i].Engine.ID < v[j].Engine.ID
+}
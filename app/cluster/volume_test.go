@@ -0,0 +1,23 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamedVolumes(t *testing.T) {
+	i := &Image{
+		Volumes: []string{
+			"/data",
+			"/srv/logs:/logs:ro",
+			"./conf:/etc/app",
+			"cache:/cache",
+			"db-data:/var/lib/db:rw",
+		},
+	}
+
+	expected := []string{"cache", "db-data"}
+	if names := i.NamedVolumes(); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v; received %v", expected, names)
+	}
+}
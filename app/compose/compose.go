@@ -0,0 +1,487 @@
+// Package compose translates fig / compose v1 files into cluster images.
+package compose
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+type (
+	// Project is the set of services defined by a compose file
+	Project struct {
+		Services map[string]*Service
+	}
+
+	// Service is a compose v1 service definition
+	Service struct {
+		Image         string       `yaml:"image,omitempty"`
+		Build         string       `yaml:"build,omitempty"`
+		Command       stringOrList `yaml:"command,omitempty"`
+		Entrypoint    stringOrList `yaml:"entrypoint,omitempty"`
+		Links         []string     `yaml:"links,omitempty"`
+		ExternalLinks []string     `yaml:"external_links,omitempty"`
+		Ports         []string     `yaml:"ports,omitempty"`
+		Volumes       []string     `yaml:"volumes,omitempty"`
+		Environment   mapOrList    `yaml:"environment,omitempty"`
+		Hostname      string       `yaml:"hostname,omitempty"`
+		Domainname    string       `yaml:"domainname,omitempty"`
+		MemLimit      string       `yaml:"mem_limit,omitempty"`
+		CpuShares     int64        `yaml:"cpu_shares,omitempty"`
+		Privileged    bool         `yaml:"privileged,omitempty"`
+		Restart       string       `yaml:"restart,omitempty"`
+		Net           string       `yaml:"net,omitempty"`
+		User          string       `yaml:"user,omitempty"`
+		WorkingDir    string       `yaml:"working_dir,omitempty"`
+		Dns           []string     `yaml:"dns,omitempty"`
+		DnsSearch     []string     `yaml:"dns_search,omitempty"`
+		ExtraHosts    []string     `yaml:"extra_hosts,omitempty"`
+		CapAdd        []string     `yaml:"cap_add,omitempty"`
+		CapDrop       []string     `yaml:"cap_drop,omitempty"`
+		Labels        mapOrList    `yaml:"labels,omitempty"`
+		LogDriver     string       `yaml:"log_driver,omitempty"`
+		LogOpt        mapOrList    `yaml:"log_opt,omitempty"`
+	}
+
+	stringOrList []string
+	mapOrList    map[string]string
+)
+
+func (s *stringOrList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err == nil {
+		args, err := splitCommand(str)
+		if err != nil {
+			return err
+		}
+		*s = args
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+func (m *mapOrList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	out := make(map[string]string)
+
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		for _, kv := range list {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) == 2 {
+				out[parts[0]] = parts[1]
+			} else {
+				out[parts[0]] = ""
+			}
+		}
+		*m = out
+		return nil
+	}
+
+	var values map[string]interface{}
+	if err := unmarshal(&values); err != nil {
+		return err
+	}
+	for k, v := range values {
+		if v == nil {
+			out[k] = ""
+			continue
+		}
+		out[k] = fmt.Sprint(v)
+	}
+	*m = out
+	return nil
+}
+
+// Parse reads a compose v1 file; keys that cannot be translated are rejected
+func Parse(data []byte) (*Project, error) {
+	services := make(map[string]*Service)
+	if err := yaml.UnmarshalStrict(data, &services); err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services defined")
+	}
+
+	for name, s := range services {
+		if !validName.MatchString(name) {
+			return nil, fmt.Errorf("invalid service name %q", name)
+		}
+		if s == nil || s.Image == "" {
+			if s != nil && s.Build != "" {
+				return nil, fmt.Errorf("service %s: build is not supported; build and push the image first", name)
+			}
+			return nil, fmt.Errorf("service %s: image is required", name)
+		}
+		if err := cluster.ValidateDockerLabels(s.Labels); err != nil {
+			return nil, fmt.Errorf("service %s: %s", name, err)
+		}
+		for _, l := range s.Links {
+			target, _ := splitLink(l)
+			if _, ok := services[target]; !ok {
+				return nil, fmt.Errorf("service %s links to undefined service %s", name, target)
+			}
+		}
+	}
+
+	return &Project{Services: services}, nil
+}
+
+// ValidateName returns an error if the name cannot be used in container names
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid application name %q", name)
+	}
+	return nil
+}
+
+// ContainerName is the name of the container of a service in an application
+func ContainerName(app, service string) string {
+	return fmt.Sprintf("%s_%s_1", app, service)
+}
+
+func splitLink(link string) (string, string) {
+	parts := strings.SplitN(link, ":", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], parts[0]
+}
+
+// StartOrder returns the services ordered so each starts after the services it links to
+func (p *Project) StartOrder() ([]string, error) {
+	var (
+		order      = []string{}
+		pending    = make(map[string]int)
+		dependents = make(map[string][]string)
+	)
+
+	for name, s := range p.Services {
+		pending[name] += 0
+		for _, l := range s.Links {
+			target, _ := splitLink(l)
+			pending[name]++
+			dependents[target] = append(dependents[target], name)
+		}
+	}
+
+	for len(pending) > 0 {
+		ready := []string{}
+		for name, n := range pending {
+			if n == 0 {
+				ready = append(ready, name)
+			}
+		}
+		if len(ready) == 0 {
+			cycle := []string{}
+			for name := range pending {
+				cycle = append(cycle, name)
+			}
+			sort.Strings(cycle)
+			return nil, fmt.Errorf("circular links between services %s", strings.Join(cycle, ", "))
+		}
+
+		sort.Strings(ready)
+		for _, name := range ready {
+			delete(pending, name)
+			order = append(order, name)
+			for _, d := range dependents[name] {
+				pending[d]--
+			}
+		}
+	}
+
+	return order, nil
+}
+
+// Groups maps each service to the first, by name, of the services it is
+// linked with directly or indirectly; linked services share an engine
+func (p *Project) Groups() map[string]string {
+	parent := make(map[string]string)
+
+	var find func(string) string
+	find = func(s string) string {
+		if parent[s] == s {
+			return s
+		}
+		parent[s] = find(parent[s])
+		return parent[s]
+	}
+
+	for name := range p.Services {
+		parent[name] = name
+	}
+	for name, s := range p.Services {
+		for _, l := range s.Links {
+			target, _ := splitLink(l)
+			a, b := find(name), find(target)
+			if a == b {
+				continue
+			}
+			if a < b {
+				parent[b] = a
+			} else {
+				parent[a] = b
+			}
+		}
+	}
+
+	groups := make(map[string]string)
+	for name := range p.Services {
+		groups[name] = find(name)
+	}
+	return groups
+}
+
+// Image translates a service of the application into a cluster image
+func (p *Project) Image(app, service string) (*cluster.Image, error) {
+	s, ok := p.Services[service]
+	if !ok {
+		return nil, fmt.Errorf("service %s is not defined", service)
+	}
+
+	image := &cluster.Image{
+		Name:          s.Image,
+		Args:          s.Command,
+		Entrypoint:    s.Entrypoint,
+		Environment:   s.Environment,
+		Hostname:      s.Hostname,
+		Domainname:    s.Domainname,
+		Volumes:       s.Volumes,
+		Privileged:    s.Privileged,
+		NetworkMode:   s.Net,
+		User:          s.User,
+		WorkingDir:    s.WorkingDir,
+		Dns:           s.Dns,
+		DnsSearch:     s.DnsSearch,
+		ExtraHosts:    s.ExtraHosts,
+		CapAdd:        s.CapAdd,
+		CapDrop:       s.CapDrop,
+		DockerLabels:  s.Labels,
+		LogDriver:     s.LogDriver,
+		LogOptions:    s.LogOpt,
+		ContainerName: ContainerName(app, service),
+		Links:         make(map[string]string),
+	}
+
+	for _, l := range s.Links {
+		target, alias := splitLink(l)
+		image.Links[ContainerName(app, target)] = alias
+	}
+	// external links name containers outside of the application
+	for _, l := range s.ExternalLinks {
+		target, alias := splitLink(l)
+		image.Links[target] = alias
+	}
+
+	for _, port := range s.Ports {
+		ports, err := parsePort(port)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %s", service, err)
+		}
+		image.BindPorts = append(image.BindPorts, ports...)
+	}
+
+	if s.MemLimit != "" {
+		mem, err := parseMemory(s.MemLimit)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %s", service, err)
+		}
+		image.Memory = mem
+	}
+
+	// cpu shares are relative to the 1024 shares of a full cpu
+	if s.CpuShares > 0 {
+		image.Cpus = float64(s.CpuShares) / 1024.0
+	}
+
+	if s.Restart != "" {
+		policy, err := parseRestart(s.Restart)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %s", service, err)
+		}
+		image.RestartPolicy = policy
+	}
+
+	return image, nil
+}
+
+// parsePort reads [[ip:]host_port:]container_port[/proto] where ports may be ranges
+func parsePort(spec string) ([]*cluster.Port, error) {
+	proto := "tcp"
+	if i := strings.Index(spec, "/"); i > -1 {
+		spec, proto = spec[:i], spec[i+1:]
+	}
+
+	var ip, hostPort, containerPort string
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		containerPort = parts[0]
+	case 2:
+		hostPort, containerPort = parts[0], parts[1]
+	case 3:
+		ip, hostPort, containerPort = parts[0], parts[1], parts[2]
+	default:
+		return nil, fmt.Errorf("invalid port %q", spec)
+	}
+
+	cStart, cEnd, err := parsePortRange(containerPort)
+	if err != nil {
+		return nil, err
+	}
+	hStart, hEnd := 0, 0
+	if hostPort != "" {
+		if hStart, hEnd, err = parsePortRange(hostPort); err != nil {
+			return nil, err
+		}
+		if hEnd-hStart != cEnd-cStart {
+			return nil, fmt.Errorf("port ranges %q do not match", spec)
+		}
+	}
+
+	ports := []*cluster.Port{}
+	for i := 0; i <= cEnd-cStart; i++ {
+		p := &cluster.Port{
+			Proto:         proto,
+			HostIp:        ip,
+			ContainerPort: cStart + i,
+		}
+		if hostPort != "" {
+			p.Port = hStart + i
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+func parsePortRange(r string) (int, int, error) {
+	parts := strings.SplitN(r, "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", r)
+	}
+	end := start
+	if len(parts) == 2 {
+		if end, err = strconv.Atoi(parts[1]); err != nil || end < start {
+			return 0, 0, fmt.Errorf("invalid port range %q", r)
+		}
+	}
+	return start, end, nil
+}
+
+// parseMemory converts a docker memory limit, bytes with an optional b, k, m or g unit, to MB
+func parseMemory(limit string) (float64, error) {
+	var (
+		s    = strings.ToLower(strings.TrimSpace(limit))
+		mult = 1.0
+	)
+
+	switch {
+	case strings.HasSuffix(s, "g"):
+		mult, s = 1024*1024*1024, strings.TrimSuffix(s, "g")
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1024*1024, strings.TrimSuffix(s, "m")
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1024, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "b"):
+		s = strings.TrimSuffix(s, "b")
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mem_limit %q", limit)
+	}
+	return v * mult / 1024 / 1024, nil
+}
+
+// parseRestart reads no, always or on-failure[:max_retries]
+func parseRestart(restart string) (cluster.RestartPolicy, error) {
+	parts := strings.SplitN(restart, ":", 2)
+	policy := cluster.RestartPolicy{Name: parts[0]}
+
+	switch policy.Name {
+	case "no", "always":
+		if len(parts) == 2 {
+			return policy, fmt.Errorf("invalid restart policy %q", restart)
+		}
+	case "on-failure":
+		if len(parts) == 2 {
+			n, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return policy, fmt.Errorf("invalid restart policy %q", restart)
+			}
+			policy.MaximumRetryCount = n
+		}
+	default:
+		return policy, fmt.Errorf("invalid restart policy %q", restart)
+	}
+
+	if policy.Name == "no" {
+		policy.Name = ""
+	}
+	return policy, nil
+}
+
+// splitCommand splits a command string into arguments the way a shell would
+// for plain words, single and double quotes and backslash escapes
+func splitCommand(cmd string) ([]string, error) {
+	var (
+		args    = []string{}
+		current = []rune{}
+		inWord  = false
+		quote   rune
+		escaped = false
+	)
+
+	for _, r := range cmd {
+		switch {
+		case escaped:
+			current = append(current, r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current = append(current, r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, string(current))
+				current = current[:0]
+				inWord = false
+			}
+		default:
+			current = append(current, r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote in command %q", cmd)
+	}
+	if inWord {
+		args = append(args, string(current))
+	}
+	return args, nil
+}
@@ -0,0 +1,227 @@
+package compose
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+const testCompose = `
+web:
+  image: team/web:1.0
+  command: ./run --port "8080" --name 'my app'
+  links:
+    - db
+    - cache:redis
+  ports:
+    - "80:8080"
+    - "127.0.0.1:9000-9001:9000-9001/udp"
+    - "7000"
+  environment:
+    - DEBUG=1
+    - EMPTY
+  mem_limit: 512m
+  restart: on-failure:3
+db:
+  image: postgres
+  volumes:
+    - /data/db:/var/lib/postgresql/data
+  environment:
+    POSTGRES_USER: app
+    POSTGRES_PORT: 5432
+cache:
+  image: redis
+worker:
+  image: team/worker
+  command: ["worker", "-v"]
+  links:
+    - db
+monitor:
+  image: team/monitor
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(testCompose))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Services) != 5 {
+		t.Fatalf("expected 5 services; received %d", len(p.Services))
+	}
+
+	web, err := p.Image("shop", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if web.ContainerName != "shop_web_1" {
+		t.Errorf("expected container name shop_web_1; received %s", web.ContainerName)
+	}
+	if expected := []string{"./run", "--port", "8080", "--name", "my app"}; !reflect.DeepEqual(web.Args, expected) {
+		t.Errorf("expected args %v; received %v", expected, web.Args)
+	}
+	if expected := map[string]string{"shop_db_1": "db", "shop_cache_1": "redis"}; !reflect.DeepEqual(web.Links, expected) {
+		t.Errorf("expected links %v; received %v", expected, web.Links)
+	}
+	if expected := map[string]string{"DEBUG": "1", "EMPTY": ""}; !reflect.DeepEqual(web.Environment, expected) {
+		t.Errorf("expected environment %v; received %v", expected, web.Environment)
+	}
+	if web.Memory != 512 {
+		t.Errorf("expected 512MB memory; received %f", web.Memory)
+	}
+	if web.RestartPolicy.Name != "on-failure" || web.RestartPolicy.MaximumRetryCount != 3 {
+		t.Errorf("unexpected restart policy %+v", web.RestartPolicy)
+	}
+
+	if len(web.BindPorts) != 4 {
+		t.Fatalf("expected 4 ports; received %d", len(web.BindPorts))
+	}
+	if b := web.BindPorts[0]; b.Port != 80 || b.ContainerPort != 8080 || b.Proto != "tcp" {
+		t.Errorf("unexpected port %+v", b)
+	}
+	if b := web.BindPorts[2]; b.HostIp != "127.0.0.1" || b.Port != 9001 || b.ContainerPort != 9001 || b.Proto != "udp" {
+		t.Errorf("unexpected port %+v", b)
+	}
+	if b := web.BindPorts[3]; b.Port != 0 || b.ContainerPort != 7000 {
+		t.Errorf("unexpected port %+v", b)
+	}
+
+	db, err := p.Image("shop", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Environment["POSTGRES_PORT"] != "5432" {
+		t.Errorf("expected POSTGRES_PORT 5432; received %q", db.Environment["POSTGRES_PORT"])
+	}
+	if len(db.Volumes) != 1 || db.Volumes[0] != "/data/db:/var/lib/postgresql/data" {
+		t.Errorf("unexpected volumes %v", db.Volumes)
+	}
+
+	worker, err := p.Image("shop", "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"worker", "-v"}; !reflect.DeepEqual(worker.Args, expected) {
+		t.Errorf("expected args %v; received %v", expected, worker.Args)
+	}
+}
+
+func TestStartOrder(t *testing.T) {
+	p, err := Parse([]byte(testCompose))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := p.StartOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"cache", "db", "monitor", "web", "worker"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("expected order %v; received %v", expected, order)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	p, err := Parse([]byte(testCompose))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := p.Groups()
+	for _, s := range []string{"web", "db", "cache", "worker"} {
+		if groups[s] != "cache" {
+			t.Errorf("expected %s in group cache; received %s", s, groups[s])
+		}
+	}
+	if groups["monitor"] != "monitor" {
+		t.Errorf("expected monitor in its own group; received %s", groups["monitor"])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"web:\n  build: .\n",
+		"web:\n  command: run\n",
+		"web:\n  image: app\n  links:\n    - db\n",
+		"web:\n  image: app\n  volumes_from:\n    - db\n",
+		"a:\n  image: app\n  links: [b]\nb:\n  image: app\n  links: [a]\n",
+		"web:\n  image: app\n  command: run 'unterminated\n",
+		"web:\n  image: app\n  labels:\n    com.dockerman.team: payments\n",
+	}
+
+	for _, data := range tests {
+		p, err := Parse([]byte(data))
+		if err == nil {
+			_, err = p.StartOrder()
+		}
+		if err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := map[string]float64{
+		"1g":       1024,
+		"256m":     256,
+		"1024k":    1,
+		"1048576":  1,
+		"2097152b": 2,
+	}
+
+	for limit, expected := range tests {
+		mem, err := parseMemory(limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mem != expected {
+			t.Errorf("%s: expected %f; received %f", limit, expected, mem)
+		}
+	}
+}
+
+func TestFromImage(t *testing.T) {
+	image := &cluster.Image{
+		Name:        "team/web:1",
+		Args:        []string{"serve", "--name", "my app"},
+		Environment: map[string]string{"MODE": "dev"},
+		Memory:      256,
+		Cpus:        0.5,
+		Volumes:     []string{"/srv/logs:/logs:ro"},
+		Links:       map[string]string{"db": "database"},
+		BindPorts: []*cluster.Port{
+			{Proto: "tcp", Port: 80, ContainerPort: 8080},
+			{HostIp: "127.0.0.1", Proto: "udp", ContainerPort: 53},
+		},
+		RestartPolicy: cluster.RestartPolicy{Name: "on-failure", MaximumRetryCount: 2},
+		User:          "app",
+		CapAdd:        []string{"NET_ADMIN"},
+		DockerLabels:  map[string]string{"com.example.team": "web"},
+		LogDriver:     "syslog",
+		LogOptions:    map[string]string{"tag": "web"},
+	}
+
+	data, err := Marshal("web", FromImage(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, data)
+	}
+	parsed, err := p.Image("app", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// compose always names the container after the application
+	parsed.ContainerName = ""
+	if !reflect.DeepEqual(parsed, image) {
+		t.Fatalf("expected %+v; received %+v\n%s", image, parsed, data)
+	}
+}
@@ -0,0 +1,91 @@
+package compose
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+	"gopkg.in/yaml.v2"
+)
+
+// FromImage translates a cluster image into a service. Links name
+// containers outside of the file so they become external links. Image
+// settings compose v1 has no key for, such as engine labels, cpusets,
+// ulimits and secret references, are lost.
+func FromImage(image *cluster.Image) *Service {
+	s := &Service{
+		Image:       image.Name,
+		Command:     image.Args,
+		Entrypoint:  image.Entrypoint,
+		Volumes:     image.Volumes,
+		Environment: image.Environment,
+		Hostname:    image.Hostname,
+		Domainname:  image.Domainname,
+		Privileged:  image.Privileged,
+		Net:         image.NetworkMode,
+		User:        image.User,
+		WorkingDir:  image.WorkingDir,
+		Dns:         image.Dns,
+		DnsSearch:   image.DnsSearch,
+		ExtraHosts:  image.ExtraHosts,
+		CapAdd:      image.CapAdd,
+		CapDrop:     image.CapDrop,
+		Labels:      image.DockerLabels,
+		LogDriver:   image.LogDriver,
+		LogOpt:      image.LogOptions,
+	}
+
+	for target, alias := range image.Links {
+		s.ExternalLinks = append(s.ExternalLinks, fmt.Sprintf("%s:%s", target, alias))
+	}
+	sort.Strings(s.ExternalLinks)
+
+	for _, p := range image.BindPorts {
+		s.Ports = append(s.Ports, formatPort(p))
+	}
+
+	if image.Memory > 0 {
+		s.MemLimit = fmt.Sprintf("%dm", int64(image.Memory))
+	}
+	if image.Cpus > 0 {
+		s.CpuShares = int64(image.Cpus * 1024.0)
+	}
+
+	switch image.RestartPolicy.Name {
+	case "":
+	case "on-failure":
+		s.Restart = image.RestartPolicy.Name
+		if n := image.RestartPolicy.MaximumRetryCount; n > 0 {
+			s.Restart = fmt.Sprintf("%s:%d", s.Restart, n)
+		}
+	default:
+		s.Restart = image.RestartPolicy.Name
+	}
+
+	return s
+}
+
+// Marshal returns a compose file with the single named service
+func Marshal(name string, s *Service) ([]byte, error) {
+	return yaml.Marshal(map[string]*Service{name: s})
+}
+
+// formatPort writes the port in the [[ip:]host_port:]container_port[/proto] form parsePort reads
+func formatPort(p *cluster.Port) string {
+	spec := fmt.Sprint(p.ContainerPort)
+	switch {
+	case p.HostIp != "":
+		host := ""
+		if p.Port > 0 {
+			host = fmt.Sprint(p.Port)
+		}
+		spec = fmt.Sprintf("%s:%s:%s", p.HostIp, host, spec)
+	case p.Port > 0:
+		spec = fmt.Sprintf("%d:%s", p.Port, spec)
+	}
+
+	if p.Proto != "" && p.Proto != "tcp" {
+		spec += "/" + p.Proto
+	}
+	return spec
+}
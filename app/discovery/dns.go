@@ -0,0 +1,285 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+const (
+	dnsTypeA   = 1
+	dnsTypeSRV = 33
+	dnsClassIN = 1
+
+	dnsRcodeFormatError   = 1
+	dnsRcodeServerFailure = 2
+	dnsRcodeNameError     = 3
+	dnsRcodeNotImpl       = 4
+
+	// dnsTTL is short as the registry follows containers starting and stopping
+	dnsTTL = 5
+)
+
+var errMalformedQuery = errors.New("malformed dns query")
+
+// DNSServer answers A queries for <service>.<domain> with the hosts of the
+// service and SRV queries for _<service>._<proto>.<domain> with its ports
+type DNSServer struct {
+	Domain   string
+	Registry *Registry
+
+	// LookupIP resolves the hosts of engines addressed by name
+	LookupIP func(host string) ([]net.IP, error)
+}
+
+// NewDNSServer returns a server answering for names under the domain
+func NewDNSServer(domain string, registry *Registry) *DNSServer {
+	return &DNSServer{
+		Domain:   strings.ToLower(strings.Trim(domain, ".")),
+		Registry: registry,
+		LookupIP: net.LookupIP,
+	}
+}
+
+// ListenAndServe answers dns queries over udp on the address
+func (s *DNSServer) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 512)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		resp := s.answer(buf[:n])
+		if resp == nil {
+			continue
+		}
+		if _, err := conn.WriteTo(resp, peer); err != nil {
+			logger.Warnf("error answering dns query from %s: %s", peer, err)
+		}
+	}
+}
+
+type dnsQuestion struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+
+	// raw is the question as received, echoed in the response
+	raw []byte
+}
+
+// answer returns the response to the query or nil if it cannot be answered
+func (s *DNSServer) answer(query []byte) []byte {
+	if len(query) < 12 || query[2]&0x80 != 0 {
+		return nil
+	}
+
+	q, err := parseQuestion(query)
+	if err != nil {
+		return dnsResponse(query, nil, dnsRcodeFormatError, nil)
+	}
+	if query[2]&0x78 != 0 || q.qclass != dnsClassIN {
+		return dnsResponse(query, q, dnsRcodeNotImpl, nil)
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(q.name, "."))
+	if name != s.Domain && !strings.HasSuffix(name, "."+s.Domain) {
+		return dnsResponse(query, q, dnsRcodeNameError, nil)
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."+s.Domain), ".")
+
+	var (
+		records [][]byte
+		found   bool
+	)
+	switch {
+	case name == s.Domain:
+		found = true
+	case len(labels) == 1:
+		endpoints := s.Registry.Lookup(labels[0])
+		found = len(endpoints) > 0
+		if q.qtype == dnsTypeA {
+			records, err = s.aRecords(endpoints)
+		}
+	case len(labels) == 2 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_"):
+		var (
+			service = strings.TrimPrefix(labels[0], "_")
+			proto   = strings.TrimPrefix(labels[1], "_")
+		)
+		endpoints := []*Endpoint{}
+		for _, e := range s.Registry.Lookup(service) {
+			if e.Proto == proto {
+				endpoints = append(endpoints, e)
+			}
+		}
+		found = len(endpoints) > 0
+		if q.qtype == dnsTypeSRV {
+			records = srvRecords(endpoints, s.Domain)
+		}
+	case len(labels) == 2:
+		// the target of a srv record; the container id under the service
+		for _, e := range s.Registry.Lookup(labels[1]) {
+			if strings.HasPrefix(e.Container, labels[0]) {
+				found = true
+				if q.qtype == dnsTypeA {
+					records, err = s.aRecords([]*Endpoint{e})
+				}
+				break
+			}
+		}
+	}
+
+	if !found {
+		return dnsResponse(query, q, dnsRcodeNameError, nil)
+	}
+	if err != nil {
+		logger.Warnf("error answering dns query for %s: %s", name, err)
+		return dnsResponse(query, q, dnsRcodeServerFailure, nil)
+	}
+	return dnsResponse(query, q, 0, records)
+}
+
+// parseQuestion reads the single question of a query
+func parseQuestion(query []byte) (*dnsQuestion, error) {
+	if binary.BigEndian.Uint16(query[4:6]) != 1 {
+		return nil, errMalformedQuery
+	}
+
+	var (
+		labels = []string{}
+		i      = 12
+	)
+	for {
+		if i >= len(query) {
+			return nil, errMalformedQuery
+		}
+		n := int(query[i])
+		i++
+		if n == 0 {
+			break
+		}
+		// compression is never used in a question
+		if n&0xc0 != 0 || i+n > len(query) {
+			return nil, errMalformedQuery
+		}
+		labels = append(labels, string(query[i:i+n]))
+		i += n
+	}
+	if i+4 > len(query) {
+		return nil, errMalformedQuery
+	}
+
+	return &dnsQuestion{
+		name:   strings.Join(labels, ".") + ".",
+		qtype:  binary.BigEndian.Uint16(query[i : i+2]),
+		qclass: binary.BigEndian.Uint16(query[i+2 : i+4]),
+		raw:    query[12 : i+4],
+	}, nil
+}
+
+// dnsResponse builds the response to the query with the answer records;
+// the records name the question through a pointer to it
+func dnsResponse(query []byte, q *dnsQuestion, rcode byte, records [][]byte) []byte {
+	resp := make([]byte, 12, 512)
+	copy(resp, query[:2])
+	// response, authoritative, copy the recursion desired bit
+	resp[2] = 0x84 | query[2]&0x01
+	resp[3] = rcode
+	if q != nil {
+		binary.BigEndian.PutUint16(resp[4:6], 1)
+		resp = append(resp, q.raw...)
+	}
+
+	count := 0
+	for _, r := range records {
+		// tcp is not served, so only send the records that fit
+		if len(resp)+len(r) > 512 {
+			resp[2] |= 0x02
+			break
+		}
+		resp = append(resp, r...)
+		count++
+	}
+	binary.BigEndian.PutUint16(resp[6:8], uint16(count))
+	return resp
+}
+
+// record returns a resource record for the question name
+func record(rtype uint16, data []byte) []byte {
+	r := []byte{0xc0, 12}
+	r = appendUint16(r, rtype)
+	r = appendUint16(r, dnsClassIN)
+	r = append(r, 0, 0, 0, dnsTTL)
+	r = appendUint16(r, uint16(len(data)))
+	return append(r, data...)
+}
+
+// aRecords returns an A record for every distinct ipv4 address of the
+// endpoints, resolving the hosts that are names. An error is only returned
+// when no address is found as a host could not be resolved.
+func (s *DNSServer) aRecords(endpoints []*Endpoint) ([][]byte, error) {
+	var (
+		records = [][]byte{}
+		seen    = make(map[string]bool)
+		lookErr error
+	)
+	for _, e := range endpoints {
+		ips := []net.IP{net.ParseIP(e.Host)}
+		if ips[0] == nil {
+			resolved, err := s.LookupIP(e.Host)
+			if err != nil {
+				lookErr = err
+				continue
+			}
+			ips = resolved
+		}
+
+		for _, ip := range ips {
+			ip = ip.To4()
+			if ip == nil || seen[ip.String()] {
+				continue
+			}
+			seen[ip.String()] = true
+			records = append(records, record(dnsTypeA, ip))
+		}
+	}
+	if len(records) == 0 && lookErr != nil {
+		return nil, lookErr
+	}
+	return records, nil
+}
+
+// srvRecords returns a SRV record for every endpoint targeting the name of
+// its container under the service
+func srvRecords(endpoints []*Endpoint, domain string) [][]byte {
+	records := [][]byte{}
+	for _, e := range endpoints {
+		id := e.Container
+		if len(id) > 12 {
+			id = id[:12]
+		}
+
+		data := []byte{0, 0, 0, 0}
+		data = appendUint16(data, uint16(e.Port))
+		for _, l := range strings.Split(id+"."+e.Service+"."+domain, ".") {
+			data = append(data, byte(len(l)))
+			data = append(data, l...)
+		}
+		data = append(data, 0)
+
+		records = append(records, record(dnsTypeSRV, data))
+	}
+	return records
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
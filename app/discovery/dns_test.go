@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+func query(name string, qtype uint16) []byte {
+	q := []byte{0x12, 0x34, 0x01, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, l := range strings.Split(strings.Trim(name, "."), ".") {
+		q = append(q, byte(len(l)))
+		q = append(q, l...)
+	}
+	q = append(q, 0)
+	q = appendUint16(q, qtype)
+	return appendUint16(q, dnsClassIN)
+}
+
+// answers returns the rcode and the data of the answer records
+func answers(t *testing.T, q, resp []byte) (int, [][]byte) {
+	if len(resp) < len(q) || resp[0] != 0x12 || resp[1] != 0x34 || resp[2]&0x80 == 0 {
+		t.Fatalf("invalid response %v", resp)
+	}
+
+	var (
+		count = int(binary.BigEndian.Uint16(resp[6:8]))
+		i     = len(q)
+		data  = [][]byte{}
+	)
+	for n := 0; n < count; n++ {
+		// name pointer, type, class, ttl
+		i += 10
+		l := int(binary.BigEndian.Uint16(resp[i : i+2]))
+		i += 2
+		data = append(data, resp[i:i+l])
+		i += l
+	}
+	return int(resp[3] & 0x0f), data
+}
+
+func TestDNSServer(t *testing.T) {
+	r := NewRegistry()
+	r.Update(testContainers())
+	s := NewDNSServer("dockerman.", r)
+
+	q := query("web.dockerman", dnsTypeA)
+	rcode, data := answers(t, q, s.answer(q))
+	if rcode != 0 || len(data) != 2 {
+		t.Fatalf("expected two A records; received %d %v", rcode, data)
+	}
+	if ip := net.IP(data[0]).String(); ip != "10.0.0.1" {
+		t.Fatalf("expected 10.0.0.1; received %s", ip)
+	}
+
+	q = query("_web._tcp.DockerMan", dnsTypeSRV)
+	rcode, data = answers(t, q, s.answer(q))
+	if rcode != 0 || len(data) != 2 {
+		t.Fatalf("expected two SRV records; received %d %v", rcode, data)
+	}
+	if port := binary.BigEndian.Uint16(data[0][4:6]); port != 32768 {
+		t.Fatalf("expected port 32768; received %d", port)
+	}
+	target := string(data[0][6:])
+	if !strings.Contains(target, "aaaaaaaaaaaa") || !strings.Contains(target, "web") {
+		t.Fatalf("unexpected target %q", target)
+	}
+
+	q = query("aaaaaaaaaaaa.web.dockerman", dnsTypeA)
+	if rcode, data = answers(t, q, s.answer(q)); rcode != 0 || len(data) != 1 {
+		t.Fatalf("expected the A record of the srv target; received %d %v", rcode, data)
+	}
+
+	q = query("web.dockerman", 28)
+	if rcode, data = answers(t, q, s.answer(q)); rcode != 0 || len(data) != 0 {
+		t.Fatalf("expected no AAAA records; received %d %v", rcode, data)
+	}
+
+	for _, name := range []string{"missing.dockerman", "web.example.com", "_web._udp.dockerman"} {
+		q = query(name, dnsTypeA)
+		if rcode, _ = answers(t, q, s.answer(q)); rcode != dnsRcodeNameError {
+			t.Errorf("%s: expected a name error; received %d", name, rcode)
+		}
+	}
+
+	if resp := s.answer([]byte{1, 2, 3}); resp != nil {
+		t.Fatalf("expected no response to a short message; received %v", resp)
+	}
+}
+
+func TestDNSServerEngineHostname(t *testing.T) {
+	r := NewRegistry()
+	r.Update([]*cluster.Container{
+		{
+			ID:     "aaaaaaaaaaaaaaaa",
+			State:  "running",
+			Engine: &cluster.Engine{ID: "engine-1", Addr: "tcp://docker-1.internal:2375"},
+			Image:  &cluster.Image{Service: "web"},
+			Ports:  []*cluster.Port{{Proto: "tcp", Port: 32768, ContainerPort: 80}},
+		},
+	})
+	s := NewDNSServer("dockerman", r)
+	s.LookupIP = func(host string) ([]net.IP, error) {
+		if host != "docker-1.internal" {
+			t.Fatalf("unexpected lookup of %s", host)
+		}
+		return []net.IP{net.ParseIP("fd00::1"), net.ParseIP("10.0.0.7")}, nil
+	}
+
+	q := query("web.dockerman", dnsTypeA)
+	rcode, data := answers(t, q, s.answer(q))
+	if rcode != 0 || len(data) != 1 || net.IP(data[0]).String() != "10.0.0.7" {
+		t.Fatalf("expected the A record of the resolved engine; received %d %v", rcode, data)
+	}
+
+	s.LookupIP = func(host string) ([]net.IP, error) {
+		return nil, errors.New("no such host")
+	}
+	if rcode, data = answers(t, q, s.answer(q)); rcode != dnsRcodeServerFailure {
+		t.Fatalf("expected a server failure; received %d %v", rcode, data)
+	}
+}
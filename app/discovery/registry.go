@@ -0,0 +1,163 @@
+// Package discovery keeps the published endpoints of the services running in
+// the cluster so containers on different engines can find each other.
+package discovery
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+var (
+	logger = logrus.New()
+
+	// validService is a name that can be used as a dns label
+	validService = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+)
+
+// Endpoint is a published port of a running container
+type Endpoint struct {
+	Service   string `json:"service"`
+	Container string `json:"container"`
+	Engine    string `json:"engine"`
+
+	// Host and Port are the address the container is reached at
+	Host string `json:"host"`
+	Port int    `json:"port"`
+
+	ContainerPort int    `json:"container_port,omitempty"`
+	Proto         string `json:"proto,omitempty"`
+}
+
+// Registry maps service names to their endpoints
+type Registry struct {
+	mux      sync.RWMutex
+	services map[string][]*Endpoint
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		services: make(map[string][]*Endpoint),
+	}
+}
+
+// ServiceName returns the name the container is registered under; the
+// manifest service or else the container name. Names that are not valid
+// dns labels are not registered.
+func ServiceName(c *cluster.Container) string {
+	name := c.Image.Service
+	if name == "" {
+		name = strings.TrimPrefix(c.Name, "/")
+	}
+	name = strings.ToLower(strings.Replace(name, "_", "-", -1))
+	if !validService.MatchString(name) {
+		return ""
+	}
+	return name
+}
+
+// Update replaces the registry with the published ports of the running
+// containers
+func (r *Registry) Update(containers []*cluster.Container) {
+	services := make(map[string][]*Endpoint)
+
+	for _, c := range containers {
+		if c.State != "running" || c.Image == nil || c.Engine == nil {
+			continue
+		}
+		name := ServiceName(c)
+		if name == "" {
+			continue
+		}
+
+		for _, p := range c.Ports {
+			if p.Port == 0 {
+				continue
+			}
+			services[name] = append(services[name], &Endpoint{
+				Service:       name,
+				Container:     c.ID,
+				Engine:        c.Engine.ID,
+				Host:          Host(c, p),
+				Port:          p.Port,
+				ContainerPort: p.ContainerPort,
+				Proto:         p.Proto,
+			})
+		}
+	}
+
+	for _, endpoints := range services {
+		sort.Sort(byAddress(endpoints))
+	}
+
+	r.mux.Lock()
+	r.services = services
+	r.mux.Unlock()
+}
+
+// Lookup returns the endpoints of the service
+func (r *Registry) Lookup(service string) []*Endpoint {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	return r.services[strings.ToLower(service)]
+}
+
+// Services returns the endpoints of every service
+func (r *Registry) Services() map[string][]*Endpoint {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	out := make(map[string][]*Endpoint, len(r.services))
+	for k, v := range r.services {
+		out[k] = v
+	}
+	return out
+}
+
+// Host returns the host the published port of the container is reached at;
+// the host of its engine unless the port is bound to an address
+func Host(c *cluster.Container, p *cluster.Port) string {
+	switch p.HostIp {
+	case "", "0.0.0.0", "::":
+		return engineHost(c.Engine.Addr)
+	}
+	return p.HostIp
+}
+
+// engineHost returns the host of the docker api address of an engine;
+// engines on a unix socket are local to the controller
+func engineHost(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.Scheme == "unix" || u.Host == "" {
+		return "127.0.0.1"
+	}
+	host, _, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return u.Host
+	}
+	return host
+}
+
+type byAddress []*Endpoint
+
+func (e byAddress) Len() int {
+	return len(e)
+}
+
+func (e byAddress) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+}
+
+func (e byAddress) Less(i, j int) bool {
+	if e[i].Host != e[j].Host {
+		return e[i].Host < e[j].Host
+	}
+	return e[i].Port < e[j].Port
+}
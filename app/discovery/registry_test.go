@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+func testContainers() []*cluster.Container {
+	var (
+		e1 = &cluster.Engine{ID: "engine-1", Addr: "tcp://10.0.0.1:2375"}
+		e2 = &cluster.Engine{ID: "engine-2", Addr: "unix:///var/run/docker.sock"}
+	)
+
+	return []*cluster.Container{
+		{
+			ID:     "aaaaaaaaaaaaaaaa",
+			Name:   "/web_1",
+			State:  "running",
+			Engine: e1,
+			Image:  &cluster.Image{Service: "Web"},
+			Ports:  []*cluster.Port{{Proto: "tcp", Port: 32768, ContainerPort: 80}},
+		},
+		{
+			ID:     "bbbbbbbbbbbbbbbb",
+			Name:   "/other",
+			State:  "running",
+			Engine: e2,
+			Image:  &cluster.Image{Service: "web"},
+			Ports:  []*cluster.Port{{HostIp: "10.0.0.2", Proto: "tcp", Port: 8080, ContainerPort: 80}},
+		},
+		{
+			ID:     "cccccccccccccccc",
+			Name:   "/db_master",
+			State:  "running",
+			Engine: e2,
+			Image:  &cluster.Image{},
+			Ports:  []*cluster.Port{{Proto: "tcp", Port: 5432, ContainerPort: 5432}},
+		},
+		{
+			ID:     "dddddddddddddddd",
+			Name:   "/stopped",
+			State:  "stopped",
+			Engine: e1,
+			Image:  &cluster.Image{},
+			Ports:  []*cluster.Port{{Proto: "tcp", Port: 9000, ContainerPort: 9000}},
+		},
+		{
+			ID:     "eeeeeeeeeeeeeeee",
+			Name:   "/unpublished",
+			State:  "running",
+			Engine: e1,
+			Image:  &cluster.Image{},
+		},
+	}
+}
+
+func TestRegistryUpdate(t *testing.T) {
+	r := NewRegistry()
+	r.Update(testContainers())
+
+	web := r.Lookup("WEB")
+	if len(web) != 2 {
+		t.Fatalf("expected two web endpoints; received %d", len(web))
+	}
+	if web[0].Host != "10.0.0.1" || web[0].Port != 32768 || web[1].Host != "10.0.0.2" || web[1].Port != 8080 {
+		t.Fatalf("unexpected web endpoints %+v %+v", web[0], web[1])
+	}
+
+	db := r.Lookup("db-master")
+	if len(db) != 1 || db[0].Host != "127.0.0.1" || db[0].Engine != "engine-2" {
+		t.Fatalf("unexpected db endpoints %v", db)
+	}
+
+	if len(r.Services()) != 2 {
+		t.Fatalf("expected only the running published services; received %v", r.Services())
+	}
+
+	r.Update(nil)
+	if len(r.Lookup("web")) != 0 {
+		t.Fatal("expected the registry to follow stopped containers")
+	}
+}
+
+func TestServiceName(t *testing.T) {
+	tests := map[string]string{
+		"/web":      "web",
+		"/App_Web1": "app-web1",
+		"/-web":     "",
+		"/web.1":    "",
+	}
+
+	for name, expected := range tests {
+		c := &cluster.Container{Name: name, Image: &cluster.Image{}}
+		if s := ServiceName(c); s != expected {
+			t.Errorf("%s: expected %q; received %q", name, expected, s)
+		}
+	}
+}
@@ -1,52 +1,659 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/negroni"
-	"github.com/gorilla/context"
+	gcontext "github.com/gorilla/context"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/securecookie"
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/access"
+	"github.com/yleemj/dockerMan/app/auth"
 	"github.com/yleemj/dockerMan/app/cluster"
+	"github.com/yleemj/dockerMan/app/compose"
+	"github.com/yleemj/dockerMan/app/discovery"
 	"github.com/yleemj/dockerMan/app/manager"
+	"github.com/yleemj/dockerMan/app/manifest"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v2"
 )
 
 var (
 	listenAddr        string
 	mongodbAddr       string
 	mongodbDatabase   string
+	authKey           string
 	disableUsageInfo  bool
 	showVersion       bool
+	imageGCInterval   time.Duration
+	imageGCMinAge     time.Duration
+	imageGCProtect    string
+	deployCompose     string
+	deployName        string
+	planManifest      string
+	applyManifest     string
+	pruneManifest     bool
+	migrateMetadata   bool
+	migrateDryRun     bool
+	discoveryInterval time.Duration
+	dnsAddr           string
+	dnsDomain         string
+	proxyListenAddr   string
+	backupDir         string
+	sessionKey        string
+	buildContextLimit int64
+	secureCookies     bool
+	accessToken       string
+	bootstrapAdmin    string
+	controllerURL     string
+	trustedProxyList  string
+	trustedProxies    []*net.IPNet
 	controllerManager *manager.Manager
 	logger            = logrus.New()
+
+	errTeamRequired  = errors.New("team is required; your account is in several teams")
+	errNoTeam        = errors.New("your account is not in a team")
+	errNotTeamMember = errors.New("your account is not in the team")
 )
 
 const (
 	STORE_KEY = "dockerMan"
 	VERSION   = "0.0.1"
+
+	auditBodyLimit = 64 * 1024
+)
+
+type (
+	contextKey int
+
+	imagePullRequest struct {
+		Image  string   `json:"image,omitempty"`
+		Labels []string `json:"labels,omitempty"`
+	}
+
+	imageGCRequest struct {
+		MinAge    string   `json:"min_age,omitempty"`
+		Protected []string `json:"protected,omitempty"`
+		DryRun    bool     `json:"dry_run,omitempty"`
+		Labels    []string `json:"labels,omitempty"`
+	}
+
+	networkConnectRequest struct {
+		Network string   `json:"network,omitempty"`
+		Aliases []string `json:"aliases,omitempty"`
+	}
+
+	loginRequest struct {
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+	}
+
+	accountInfo struct {
+		*dockerMan.Account
+		Permissions []string `json:"permissions"`
+	}
+
+	roleAssignment struct {
+		Role string `json:"role,omitempty"`
+	}
+
+	teamAssignment struct {
+		Teams []string `json:"teams"`
+	}
+
+	tokenRequest struct {
+		// Username is a service account to create the token for; the
+		// signed in account if empty
+		Username    string `json:"username,omitempty"`
+		Description string `json:"description,omitempty"`
+
+		// ExpiresIn is a duration such as 720h; the token never expires
+		// if empty
+		ExpiresIn string `json:"expires_in,omitempty"`
+	}
+
+	passwordChangeRequest struct {
+		CurrentPassword string `json:"current_password,omitempty"`
+		Password        string `json:"password,omitempty"`
+	}
+)
+
+const (
+	auditRecordKey contextKey = iota
 )
 
 func init() {
 	flag.StringVar(&listenAddr, "listen", ":8080", "listen address")
 	flag.StringVar(&mongodbAddr, "mongodb-addr", "127.0.0.1:27017", "mongodb address")
 	flag.StringVar(&mongodbDatabase, "mongodb-database", "dockerMan", "mongodb database")
+	flag.StringVar(&authKey, "auth-key", "", "key used to encrypt stored credentials")
 	flag.BoolVar(&disableUsageInfo, "disable-usage-info", false, "disable anonymous usage info")
 	flag.BoolVar(&showVersion, "version", false, "show version and exit")
+	flag.DurationVar(&imageGCInterval, "image-gc-interval", 0, "interval between image garbage collections (0 disables)")
+	flag.DurationVar(&imageGCMinAge, "image-gc-min-age", 7*24*time.Hour, "minimum age of unused images removed by scheduled collections")
+	flag.StringVar(&imageGCProtect, "image-gc-protect", "", "comma separated images never removed by scheduled collections")
+	flag.StringVar(&trustedProxyList, "trusted-proxies", "", "comma separated addresses or networks of proxies whose X-Forwarded-For header is used as the client address")
+	flag.DurationVar(&discoveryInterval, "discovery-interval", 10*time.Second, "interval between refreshes of the service registry")
+	flag.StringVar(&dnsAddr, "dns-addr", "", "udp address of the service discovery dns responder (empty disables)")
+	flag.StringVar(&dnsDomain, "dns-domain", "dockerman", "domain the dns responder answers for")
+	flag.StringVar(&proxyListenAddr, "proxy-listen", "", "listen address of the reverse proxy to the routed containers (empty disables)")
+	flag.Int64Var(&buildContextLimit, "build-context-limit", 512, "maximum size of an uploaded build context in MB")
+	flag.StringVar(&sessionKey, "session-key", "", "key session cookies are signed with (default: random, sessions end when the controller restarts)")
+	flag.BoolVar(&secureCookies, "secure-cookies", false, "only send session cookies over https")
+	flag.StringVar(&bootstrapAdmin, "bootstrap-admin", "", "create the first account with this username and exit; the password is read from DOCKERMAN_ADMIN_PASSWORD or stdin")
+	flag.StringVar(&backupDir, "backup-dir", "", "directory volume backups are stored in (empty disables backups)")
+	flag.StringVar(&deployCompose, "deploy", "", "deploy the fig/compose file to a running controller and exit")
+	flag.StringVar(&deployName, "deploy-name", "", "application name for -deploy (default: the file's directory name)")
+	flag.StringVar(&planManifest, "plan", "", "show the changes the manifest makes on a running controller and exit")
+	flag.StringVar(&applyManifest, "apply", "", "apply the manifest to a running controller and exit")
+	flag.BoolVar(&pruneManifest, "prune", false, "with -plan or -apply, remove containers not managed by the manifest")
+	flag.BoolVar(&migrateMetadata, "migrate-metadata", false, "move the metadata of containers from env vars to labels on a running controller and exit")
+	flag.BoolVar(&migrateDryRun, "migrate-dry-run", false, "with -migrate-metadata, only list the containers to migrate")
+	flag.StringVar(&accessToken, "token", "", "access token sent to the controller by -deploy, -plan, -apply and -migrate-metadata")
+	flag.StringVar(&controllerURL, "controller", "http://127.0.0.1:8080", "controller url used by -deploy, -plan, -apply and -migrate-metadata")
 }
 
-func destroy(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+// auditResponseWriter keeps the status and error message of a response
+// so it can be recorded in the audit log
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	errMsg bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= http.StatusBadRequest && w.errMsg.Len() < auditBodyLimit {
+		w.errMsg.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// flush sends any buffered response data to the client for streamed responses
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// sessionUsername returns the account of the access token or session of
+// the request
+func sessionUsername(r *http.Request) string {
+	if username := auth.TokenUsername(r); username != "" {
+		return username
+	}
+	session, err := controllerManager.Store().Get(r, controllerManager.StoreKey)
+	if err != nil {
+		return ""
+	}
+	username, _ := session.Values["username"].(string)
+	return username
+}
+
+// remoteAddr returns the client address of the request. X-Forwarded-For is
+// only used when the request comes from a trusted proxy; the client is the
+// last address in it not added by a trusted proxy.
+func remoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+
+	fwd := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(fwd) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(fwd[i])
+		if addr == "" {
+			continue
+		}
+		host = addr
+		if !isTrustedProxy(addr) {
+			break
+		}
+	}
+	return host
+}
+
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses a comma separated list of addresses and
+// networks in CIDR notation
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy network %q: %s", p, err)
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+// redactBody masks the values of secret looking fields in a json body
+func redactBody(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+
+	redactValue(v)
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(b)
+}
+
+func redactValue(v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			switch lk := strings.ToLower(k); {
+			case lk == "token", lk == "secret", lk == "value", strings.HasSuffix(lk, "password"):
+				t[k] = "********"
+			default:
+				redactValue(val)
+			}
+		}
+	case []interface{}:
+		for _, val := range t {
+			redactValue(val)
+		}
+	}
+}
+
+// auditRecord holds what a handler reports for its audit event; audit puts
+// it in the request context, which lives only as long as the request
+type auditRecord struct {
+	containers []*cluster.Container
+	errors     []string
+}
+
+func withAuditRecord(r *http.Request, rec *auditRecord) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), auditRecordKey, rec))
+}
+
+func requestAuditRecord(r *http.Request) *auditRecord {
+	if rec, ok := r.Context().Value(auditRecordKey).(*auditRecord); ok {
+		return rec
+	}
+	return &auditRecord{}
+}
+
+// setAuditContainers records the containers a handler acted on for the audit log
+func setAuditContainers(r *http.Request, containers ...*cluster.Container) {
+	requestAuditRecord(r).containers = containers
+}
+
+// setAuditErrors records the errors of a handler acting on several engines
+// for the audit log
+func setAuditErrors(r *http.Request, errs []string) {
+	requestAuditRecord(r).errors = errs
+}
+
+// audited records every call to a mutating api handler in the audit log
+func audited(action string, h http.HandlerFunc) http.HandlerFunc {
+	return audit(action, h, true)
+}
+
+// auditedUpload audits a handler whose request body is an upload, such as
+// a build context; the body is streamed to the handler and not recorded
+func auditedUpload(action string, h http.HandlerFunc) http.HandlerFunc {
+	return audit(action, h, false)
+}
+
+func audit(action string, h http.HandlerFunc, keepBody bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// only json bodies are kept; other uploads are streamed to the
+		// handler untouched
+		var body []byte
+		ct := r.Header.Get("Content-Type")
+		if keepBody && r.Body != nil && (ct == "" || strings.HasPrefix(ct, "application/json")) {
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = b
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		aw := &auditResponseWriter{ResponseWriter: w}
+		rec := &auditRecord{}
+		r = withAuditRecord(r, rec)
+		h(aw, r)
+
+		if aw.status == 0 {
+			aw.status = http.StatusOK
+		}
+		evt := &dockerMan.AuditEvent{
+			Username:   sessionUsername(r),
+			Time:       start,
+			RemoteAddr: remoteAddr(r),
+			Action:     action,
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Body:       redactBody(body),
+			Status:     aw.status,
+			Success:    aw.status < http.StatusBadRequest,
+			Error:      strings.TrimSpace(aw.errMsg.String()),
+		}
+		if len(evt.Body) > auditBodyLimit {
+			evt.Body = evt.Body[:auditBodyLimit]
+		}
+		if len(rec.errors) > 0 {
+			evt.Error = strings.Join(rec.errors, "; ")
+		}
+
+		for _, c := range rec.containers {
+			if c == nil {
+				continue
+			}
+			evt.Containers = append(evt.Containers, c.ID)
+			if c.Engine != nil {
+				evt.Engines = append(evt.Engines, c.Engine.ID)
+			}
+		}
+		if len(evt.Containers) == 0 {
+			if id := mux.Vars(r)["id"]; id != "" {
+				evt.Containers = []string{id}
+			}
+		}
+
+		if err := controllerManager.SaveAuditEvent(evt); err != nil {
+			logger.Errorf("error saving audit event for %s: %s", action, err)
+		}
+	}
+}
+
+// callerTeams returns the teams of the signed in account; all is true when
+// it sees the containers of every team
+func callerTeams(r *http.Request) ([]string, bool, error) {
+	return controllerManager.TeamScope(sessionUsername(r))
+}
+
+// visibleContainers returns the containers of the teams of the signed in
+// account
+func visibleContainers(r *http.Request, containers []*cluster.Container) ([]*cluster.Container, error) {
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return containers, nil
+	}
+	return manager.TeamContainers(containers, teams), nil
+}
+
+// visibleContainer returns the container if the signed in account sees it;
+// otherwise it writes the error and returns nil. Containers of other teams
+// do not exist for the account.
+func visibleContainer(w http.ResponseWriter, r *http.Request, id string) *cluster.Container {
 	container, err := controllerManager.Container(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if container != nil {
+		visible, err := visibleContainers(r, []*cluster.Container{container})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil
+		}
+		if len(visible) == 0 {
+			container = nil
+		}
+	}
+	if container == nil {
+		http.Error(w, "container does not exist", http.StatusNotFound)
+	}
+	return container
+}
+
+// visibleBackup returns the backup if the signed in account sees the team
+// of its container; otherwise it writes the error and returns nil
+func visibleBackup(w http.ResponseWriter, r *http.Request, id string) *dockerMan.Backup {
+	backup, err := controllerManager.Backup(id)
+	if err != nil {
+		backupError(w, err)
+		return nil
+	}
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if !all && !manager.InTeams(backup.Team, teams) {
+		backupError(w, manager.ErrBackupDoesNotExist)
+		return nil
+	}
+	return backup
+}
+
+// visibleApplication returns the application if the signed in account sees
+// its team; otherwise it writes the error and returns nil
+func visibleApplication(w http.ResponseWriter, r *http.Request, name string) *dockerMan.Application {
+	app, err := controllerManager.Application(name)
+	if err != nil {
+		applicationError(w, err)
+		return nil
+	}
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if !all && !manager.InTeams(app.Team, teams) {
+		applicationError(w, manager.ErrApplicationDoesNotExist)
+		return nil
+	}
+	return app
+}
+
+// visibleRoute returns the route if the signed in account sees its team;
+// otherwise it writes the error and returns nil
+func visibleRoute(w http.ResponseWriter, r *http.Request, name string) *dockerMan.Route {
+	route, err := controllerManager.Route(name)
+	if err != nil {
+		routeError(w, err)
+		return nil
+	}
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if !all && !manager.InTeams(route.Team, teams) {
+		routeError(w, manager.ErrRouteDoesNotExist)
+		return nil
+	}
+	return route
+}
+
+// visibleVolumes returns the volumes of the teams of the signed in account
+func visibleVolumes(r *http.Request, volumes []*cluster.Volume) ([]*cluster.Volume, error) {
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return volumes, nil
+	}
+	return controllerManager.TeamVolumes(volumes, teams)
+}
+
+// visibleNetworks returns the builtin networks and the networks of the
+// teams of the signed in account
+func visibleNetworks(r *http.Request, networks []*cluster.Network) ([]*cluster.Network, error) {
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return networks, nil
+	}
+	return controllerManager.TeamNetworks(networks, teams)
+}
+
+// visibleSecret returns the secret if the signed in account sees its team;
+// otherwise it writes the error and returns nil
+func visibleSecret(w http.ResponseWriter, r *http.Request, name string) *dockerMan.Secret {
+	secret, err := controllerManager.Secret(name)
+	if err != nil {
+		secretError(w, err)
+		return nil
+	}
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if !all && !manager.InTeams(secret.Team, teams) {
+		secretError(w, manager.ErrSecretDoesNotExist)
+		return nil
+	}
+	return secret
+}
+
+// visibleEndpoints returns the endpoints of the containers the signed in
+// account sees
+func visibleEndpoints(r *http.Request, endpoints []*discovery.Endpoint) ([]*discovery.Endpoint, error) {
+	containers, err := visibleContainers(r, controllerManager.Containers(true))
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		ids[c.ID] = true
+	}
+
+	out := []*discovery.Endpoint{}
+	for _, e := range endpoints {
+		if ids[e.Container] {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// runTeam returns the team owning the containers the signed in account
+// launches; the requested one, or its only team. Accounts seeing every team
+// may launch containers without one.
+func runTeam(r *http.Request, requested string) (string, error) {
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		return "", err
+	}
+
+	if requested != "" {
+		if !all && !manager.InTeams(requested, teams) {
+			return "", errNotTeamMember
+		}
+		return requested, nil
+	}
+
+	switch {
+	case len(teams) == 1:
+		return teams[0], nil
+	case all:
+		return "", nil
+	case len(teams) == 0:
+		return "", errNoTeam
+	default:
+		return "", errTeamRequired
+	}
+}
+
+func teamError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrTeamDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrTeamExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errNotTeamMember, errNoTeam:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errTeamRequired, manager.ErrTeamInvalidName:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func destroy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	container := visibleContainer(w, r, id)
+	if container == nil {
 		return
 	}
+	setAuditContainers(r, container)
 
 	if err := controllerManager.Destroy(container); err != nil {
 		logger.Errorf("error destroying %s: %s", container.ID, err)
@@ -63,15 +670,29 @@ func run(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	p := r.FormValue("pull")
 	c := r.FormValue("count")
+	d := r.FormValue("resolve_digest")
 	count := 1
-	pull := false
+	pullPolicy := ""
+	resolveDigest := false
 	if p != "" {
+		// pull=true/false predates pull policies and maps to always or the
+		// image's own policy
 		pv, err := strconv.ParseBool(p)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		pull = pv
+		if pv {
+			pullPolicy = cluster.PullAlways
+		}
+	}
+	if d != "" {
+		dv, err := strconv.ParseBool(d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resolveDigest = dv
 	}
 	if c != "" {
 		cc, err := strconv.Atoi(c)
@@ -88,10 +709,35 @@ func run(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	launched, err := controllerManager.Run(image, count, pull)
+	if image == nil {
+		http.Error(w, "image is required", http.StatusBadRequest)
+		return
+	}
+
+	if pullPolicy != "" && image.PullPolicy == "" {
+		image.PullPolicy = pullPolicy
+	}
+	// the owner is whoever launches the containers, never what the body says
+	image.Owner = sessionUsername(r)
+	team, err := runTeam(r, image.Team)
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+	image.Team = team
+
+	launched, err := controllerManager.Run(image, count, resolveDigest)
+	setAuditContainers(r, launched...)
 	if err != nil {
 		logger.Warnf("error running container: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		switch err {
+		case cluster.ErrUnknownPullPolicy, cluster.ErrReservedLabel, cluster.ErrNetworkNameRequired:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case manager.ErrNotTeamResource:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -106,13 +752,13 @@ func run(w http.ResponseWriter, r *http.Request) {
 func stopContainer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	container, err := controllerManager.Container(id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	container := visibleContainer(w, r, id)
+	if container == nil {
 		return
 	}
+	setAuditContainers(r, container)
 
-	if err := controllerManager.ClusterManager().Stop(container); err != nil {
+	if err := controllerManager.Stop(container); err != nil {
 		logger.Errorf("error stopping %s: %s", container.ID, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -126,13 +772,13 @@ func stopContainer(w http.ResponseWriter, r *http.Request) {
 func restartContainer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	container, err := controllerManager.Container(id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	container := visibleContainer(w, r, id)
+	if container == nil {
 		return
 	}
+	setAuditContainers(r, container)
 
-	if err := controllerManager.ClusterManager().Restart(container, 10); err != nil {
+	if err := controllerManager.Restart(container, 10); err != nil {
 		logger.Errorf("error restarting %s: %s", container.ID, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -168,7 +814,11 @@ func inspectEngine(w http.ResponseWriter, r *http.Request) {
 func containers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	containers := controllerManager.Containers(true)
+	containers, err := visibleContainers(r, controllerManager.Containers(true))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	if err := json.NewEncoder(w).Encode(containers); err != nil {
 		logger.Error(err)
 	}
@@ -179,9 +829,8 @@ func inspectContainer(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 	id := vars["id"]
-	container, err := controllerManager.Container(id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	container := visibleContainer(w, r, id)
+	if container == nil {
 		return
 	}
 	if err := json.NewEncoder(w).Encode(container); err != nil {
@@ -189,28 +838,2262 @@ func inspectContainer(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func clusterInfo(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", "application/json")
-
-	info := controllerManager.ClusterInfo()
-	if err := json.NewEncoder(w).Encode(info); err != nil {
-		logger.Error(err)
+// exportContainer returns the definition of the container as a
+// cluster image in json or yaml, or as a compose file
+func exportContainer(w http.ResponseWriter, r *http.Request) {
+	container := visibleContainer(w, r, mux.Vars(r)["id"])
+	if container == nil {
+		return
 	}
-}
 
-func main() {
-	mHost := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
-	mPort := os.Getenv("MONGO_PORT_27017_TCP_PORT")
-	mDb := os.Getenv("MONGO_DATABASE")
+	image, err := controllerManager.ExportContainer(container)
+	if err != nil {
+		logger.Errorf("error exporting container %s: %s", container.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	if mHost != "" && mPort != "" {
-		mongodbAddr = fmt.Sprintf("%s:%s", mHost, mPort)
-		fmt.Printf("mongo addr config: %s:%s", mHost, mPort)
+	var data []byte
+	switch format := r.FormValue("format"); format {
+	case "", "json":
+		w.Header().Set("content-type", "application/json")
+		data, err = json.MarshalIndent(image, "", "  ")
+	case "yaml":
+		w.Header().Set("content-type", "application/x-yaml")
+		data, err = imageYAML(image)
+	case "compose":
+		name := strings.TrimPrefix(container.Name, "/")
+		if compose.ValidateName(name) != nil {
+			name = "service"
+		}
+		w.Header().Set("content-type", "application/x-yaml")
+		data, err = compose.Marshal(name, compose.FromImage(image))
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q; expected json, yaml or compose", format), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	fmt.Println("mongodb addr is " + mongodbAddr)
-	if mDb != "" {
-		mongodbDatabase = mDb
+	w.Write(data)
+}
+
+// imageYAML writes the image with the keys of its json encoding
+func imageYAML(image *cluster.Image) ([]byte, error) {
+	buf, err := json.Marshal(image)
+	if err != nil {
+		return nil, err
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(v)
+}
+
+func images(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	var (
+		registry   = r.FormValue("registry")
+		repository = r.FormValue("repository")
+		images     = []*cluster.ClusterImage{}
+	)
+	for _, i := range controllerManager.Images() {
+		if i.Matches(registry, repository) {
+			images = append(images, i)
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(images); err != nil {
+		logger.Error(err)
+	}
+}
+
+func pullImage(w http.ResponseWriter, r *http.Request) {
+	var req *imagePullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req == nil || req.Image == "" {
+		http.Error(w, "image is required", http.StatusBadRequest)
+		return
+	}
+
+	status, err := controllerManager.PullImage(req.Image, req.Labels)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	logger.Infof("pulling image %s on engines with labels %v", req.Image, req.Labels)
+
+	// the progress is held back until an engine has pulled the image so a
+	// pull failing on every engine is answered with an error status
+	var (
+		enc     = json.NewEncoder(w)
+		pending = []*cluster.PullStatus{}
+		errs    = []string{}
+		pulled  = false
+	)
+	for s := range status {
+		if s.Status == cluster.PullStatusError {
+			errs = append(errs, fmt.Sprintf("%s: %s", s.Engine, s.Error))
+		}
+
+		if !pulled {
+			pending = append(pending, s)
+			if s.Status != cluster.PullStatusPulled {
+				continue
+			}
+			pulled = true
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			encodePullStatus(enc, pending)
+		} else {
+			encodePullStatus(enc, []*cluster.PullStatus{s})
+		}
+		flush(w)
+	}
+	setAuditErrors(r, errs)
+
+	if !pulled {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		encodePullStatus(enc, pending)
+	}
+}
+
+func encodePullStatus(enc *json.Encoder, status []*cluster.PullStatus) {
+	for _, s := range status {
+		if err := enc.Encode(s); err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+func collectImages(w http.ResponseWriter, r *http.Request) {
+	req := &imageGCRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := &cluster.ImageGCOptions{
+		MinAge:    imageGCMinAge,
+		Protected: req.Protected,
+		DryRun:    req.DryRun,
+		Labels:    req.Labels,
+	}
+	if req.MinAge != "" {
+		d, err := time.ParseDuration(req.MinAge)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.MinAge = d
+	}
+
+	reports, err := controllerManager.CollectImages(opts)
+	if err != nil {
+		logger.Errorf("error collecting images: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(reports); err != nil {
+		logger.Error(err)
+	}
+}
+
+func imageGCReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	limit := 20
+	if l := r.FormValue("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit = v
+	}
+
+	reports, err := controllerManager.ImageGCReports(limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(reports); err != nil {
+		logger.Error(err)
+	}
+}
+
+func networkError(w http.ResponseWriter, err error) {
+	switch err {
+	case cluster.ErrNetworkDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case cluster.ErrNetworkNameRequired:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case manager.ErrNotTeamResource:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case manager.ErrTeamNameTaken:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func networks(w http.ResponseWriter, r *http.Request) {
+	networks, err := visibleNetworks(r, controllerManager.Networks())
+	if err != nil {
+		networkError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(networks); err != nil {
+		logger.Error(err)
+	}
+}
+
+// createNetwork creates a network owned by the team in the request on the
+// engine in the request or on every engine of the team matching its labels
+func createNetwork(w http.ResponseWriter, r *http.Request) {
+	var config *cluster.NetworkConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if config == nil {
+		networkError(w, cluster.ErrNetworkNameRequired)
+		return
+	}
+
+	team, err := runTeam(r, r.FormValue("team"))
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+
+	created, err := controllerManager.CreateNetwork(config, team)
+	for _, n := range created {
+		logger.Infof("created network %s on %s", n.Name, n.Engine.ID)
+	}
+	if err != nil {
+		logger.Errorf("error creating network %s: %s", config.Name, err)
+		networkError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(created); err != nil {
+		logger.Error(err)
+	}
+}
+
+func removeNetwork(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	networks, err := visibleNetworks(r, controllerManager.Networks())
+	if err != nil {
+		networkError(w, err)
+		return
+	}
+	visible := false
+	for _, n := range networks {
+		if (n.Name == name || n.ID == name) && !cluster.IsBuiltinNetwork(n.Name) {
+			visible = true
+			break
+		}
+	}
+	if !visible {
+		networkError(w, cluster.ErrNetworkDoesNotExist)
+		return
+	}
+
+	removed, err := controllerManager.RemoveNetwork(name, r.FormValue("engine"))
+	for _, n := range removed {
+		logger.Infof("removed network %s from %s", n.Name, n.Engine.ID)
+	}
+	if err != nil {
+		logger.Errorf("error removing network %s: %s", name, err)
+		networkError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func connectNetwork(w http.ResponseWriter, r *http.Request) {
+	container := visibleContainer(w, r, mux.Vars(r)["id"])
+	if container == nil {
+		return
+	}
+	setAuditContainers(r, container)
+
+	var req *networkConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req == nil || req.Network == "" {
+		networkError(w, cluster.ErrNetworkNameRequired)
+		return
+	}
+
+	if err := controllerManager.ConnectNetwork(container, req.Network, req.Aliases); err != nil {
+		logger.Errorf("error connecting %s to network %s: %s", container.ID, req.Network, err)
+		networkError(w, err)
+		return
+	}
+
+	logger.Infof("connected container %s to network %s", container.ID, req.Network)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func disconnectNetwork(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	container := visibleContainer(w, r, vars["id"])
+	if container == nil {
+		return
+	}
+	setAuditContainers(r, container)
+
+	if err := controllerManager.DisconnectNetwork(container, vars["network"]); err != nil {
+		logger.Errorf("error disconnecting %s from network %s: %s", container.ID, vars["network"], err)
+		networkError(w, err)
+		return
+	}
+
+	logger.Infof("disconnected container %s from network %s", container.ID, vars["network"])
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func volumeError(w http.ResponseWriter, err error) {
+	switch err {
+	case cluster.ErrVolumeDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case cluster.ErrVolumeNameRequired, cluster.ErrEngineNotEligible:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case manager.ErrNotTeamResource:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case manager.ErrTeamNameTaken:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func volumes(w http.ResponseWriter, r *http.Request) {
+	volumes, err := controllerManager.Volumes(r.FormValue("engine"))
+	if err != nil {
+		volumeError(w, err)
+		return
+	}
+	if volumes, err = visibleVolumes(r, volumes); err != nil {
+		volumeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(volumes); err != nil {
+		logger.Error(err)
+	}
+}
+
+// inspectVolume returns the volume on every engine holding it with the
+// containers mounting it
+func inspectVolume(w http.ResponseWriter, r *http.Request) {
+	volumes, err := controllerManager.Volume(mux.Vars(r)["name"], r.FormValue("engine"))
+	if err != nil {
+		volumeError(w, err)
+		return
+	}
+	if volumes, err = visibleVolumes(r, volumes); err != nil {
+		volumeError(w, err)
+		return
+	}
+	if len(volumes) == 0 {
+		volumeError(w, cluster.ErrVolumeDoesNotExist)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(volumes); err != nil {
+		logger.Error(err)
+	}
+}
+
+// createVolume creates a named volume on the engine in the request or on
+// every engine matching its labels, within the engine pool of the team in
+// the team parameter
+func createVolume(w http.ResponseWriter, r *http.Request) {
+	var config *cluster.VolumeConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if config == nil {
+		volumeError(w, cluster.ErrVolumeNameRequired)
+		return
+	}
+	team, err := runTeam(r, r.FormValue("team"))
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+
+	created, err := controllerManager.CreateVolume(config, team)
+	for _, v := range created {
+		logger.Infof("created volume %s on %s", v.Name, v.Engine.ID)
+	}
+	if err != nil {
+		logger.Errorf("error creating volume %s: %s", config.Name, err)
+		volumeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(created); err != nil {
+		logger.Error(err)
+	}
+}
+
+// removeVolume removes the named volume from the engine in the request, or
+// from every engine it is visible on to the signed in account
+func removeVolume(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	volumes, err := controllerManager.Volume(name, r.FormValue("engine"))
+	if err != nil {
+		volumeError(w, err)
+		return
+	}
+	if volumes, err = visibleVolumes(r, volumes); err != nil {
+		volumeError(w, err)
+		return
+	}
+	if len(volumes) == 0 {
+		volumeError(w, cluster.ErrVolumeDoesNotExist)
+		return
+	}
+
+	for _, v := range volumes {
+		if _, err := controllerManager.RemoveVolume(name, v.Engine.ID); err != nil {
+			logger.Errorf("error removing volume %s: %s", name, err)
+			volumeError(w, err)
+			return
+		}
+		logger.Infof("removed volume %s from %s", name, v.Engine.ID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// services returns the published endpoints of every service of the teams
+// of the signed in account
+func services(w http.ResponseWriter, r *http.Request) {
+	services := make(map[string][]*discovery.Endpoint)
+	for name, endpoints := range controllerManager.Services() {
+		visible, err := visibleEndpoints(r, endpoints)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(visible) > 0 {
+			services[name] = visible
+		}
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(services); err != nil {
+		logger.Error(err)
+	}
+}
+
+// inspectService returns the published endpoints of the service
+func inspectService(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	endpoints, err := visibleEndpoints(r, controllerManager.Service(name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(endpoints) == 0 {
+		http.Error(w, "service does not exist", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(endpoints); err != nil {
+		logger.Error(err)
+	}
+}
+
+// redactRegistry clears the secrets of a registry before it is returned
+func redactRegistry(registry *dockerMan.Registry) *dockerMan.Registry {
+	registry.Password = ""
+	registry.Token = ""
+	return registry
+}
+
+func registryError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrRegistryDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrRegistryExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case manager.ErrNoAuthKey:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	registries, err := controllerManager.Registries()
+	if err != nil {
+		registryError(w, err)
+		return
+	}
+	for _, reg := range registries {
+		redactRegistry(reg)
+	}
+	if err := json.NewEncoder(w).Encode(registries); err != nil {
+		logger.Error(err)
+	}
+}
+
+func inspectRegistry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+	registry, err := controllerManager.Registry(id)
+	if err != nil {
+		registryError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(redactRegistry(registry)); err != nil {
+		logger.Error(err)
+	}
+}
+
+func saveRegistry(w http.ResponseWriter, r *http.Request) {
+	var registry *dockerMan.Registry
+	if err := json.NewDecoder(r.Body).Decode(&registry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if registry == nil || registry.Host == "" {
+		http.Error(w, "host is required", http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusCreated
+	if id := mux.Vars(r)["id"]; id != "" {
+		registry.ID = id
+		status = http.StatusOK
+	} else {
+		registry.ID = ""
+	}
+
+	if err := controllerManager.SaveRegistry(registry); err != nil {
+		logger.Errorf("error saving registry %s: %s", registry.Host, err)
+		registryError(w, err)
+		return
+	}
+
+	logger.Infof("saved registry %s (%s)", registry.Host, registry.ID)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(redactRegistry(registry)); err != nil {
+		logger.Error(err)
+	}
+}
+
+func deleteRegistry(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if err := controllerManager.DeleteRegistry(id); err != nil {
+		registryError(w, err)
+		return
+	}
+
+	logger.Infof("deleted registry %s", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func secretError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrSecretDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrSecretExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case manager.ErrSecretInvalidName, manager.ErrSecretValueEmpty, manager.ErrNoAuthKey:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case manager.ErrNotTeamResource:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func secrets(w http.ResponseWriter, r *http.Request) {
+	secrets, err := controllerManager.Secrets()
+	if err != nil {
+		secretError(w, err)
+		return
+	}
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !all {
+		secrets = manager.TeamSecrets(secrets, teams)
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(secrets); err != nil {
+		logger.Error(err)
+	}
+}
+
+func inspectSecret(w http.ResponseWriter, r *http.Request) {
+	secret := visibleSecret(w, r, mux.Vars(r)["name"])
+	if secret == nil {
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(secret); err != nil {
+		logger.Error(err)
+	}
+}
+
+func saveSecret(w http.ResponseWriter, r *http.Request) {
+	var secret *dockerMan.Secret
+	if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if secret == nil {
+		http.Error(w, "secret is required", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		err    error
+		status = http.StatusCreated
+	)
+	if name := mux.Vars(r)["name"]; name != "" {
+		if visibleSecret(w, r, name) == nil {
+			return
+		}
+		secret.Name = name
+		status = http.StatusOK
+		err = controllerManager.UpdateSecret(secret)
+	} else {
+		if secret.Team, err = runTeam(r, secret.Team); err != nil {
+			teamError(w, err)
+			return
+		}
+		err = controllerManager.CreateSecret(secret)
+	}
+	if err != nil {
+		logger.Errorf("error saving secret %s: %s", secret.Name, err)
+		secretError(w, err)
+		return
+	}
+
+	logger.Infof("saved secret %s", secret.Name)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(secret); err != nil {
+		logger.Error(err)
+	}
+}
+
+func deleteSecret(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if visibleSecret(w, r, name) == nil {
+		return
+	}
+	if err := controllerManager.DeleteSecret(name); err != nil {
+		secretError(w, err)
+		return
+	}
+
+	logger.Infof("deleted secret %s", name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func routeError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrRouteDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrRouteExists, manager.ErrRouteConflict:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case manager.ErrRouteInvalid:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func routes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	routes, err := controllerManager.Routes()
+	if err != nil {
+		routeError(w, err)
+		return
+	}
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	visible := []*dockerMan.Route{}
+	for _, route := range routes {
+		if all || manager.InTeams(route.Team, teams) {
+			visible = append(visible, route)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(visible); err != nil {
+		logger.Error(err)
+	}
+}
+
+func inspectRoute(w http.ResponseWriter, r *http.Request) {
+	route := visibleRoute(w, r, mux.Vars(r)["name"])
+	if route == nil {
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(route); err != nil {
+		logger.Error(err)
+	}
+}
+
+func saveRoute(w http.ResponseWriter, r *http.Request) {
+	var route *dockerMan.Route
+	if err := json.NewDecoder(r.Body).Decode(&route); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if route == nil {
+		http.Error(w, "route is required", http.StatusBadRequest)
+		return
+	}
+
+	team, err := runTeam(r, route.Team)
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+	route.Team = team
+
+	status := http.StatusCreated
+	if name := mux.Vars(r)["name"]; name != "" {
+		if visibleRoute(w, r, name) == nil {
+			return
+		}
+		route.Name = name
+		status = http.StatusOK
+		err = controllerManager.UpdateRoute(route)
+	} else {
+		err = controllerManager.CreateRoute(route)
+	}
+	if err != nil {
+		logger.Errorf("error saving route %s: %s", route.Name, err)
+		routeError(w, err)
+		return
+	}
+
+	logger.Infof("saved route %s", route.Name)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(route); err != nil {
+		logger.Error(err)
+	}
+}
+
+func deleteRoute(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if visibleRoute(w, r, name) == nil {
+		return
+	}
+	if err := controllerManager.DeleteRoute(name); err != nil {
+		routeError(w, err)
+		return
+	}
+
+	logger.Infof("deleted route %s", name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func backupError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrBackupDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrBackupsDisabled, cluster.ErrNoVolumes, cluster.ErrEngineNotEligible:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// backupContainer archives the volumes of the container; stop the
+// container first for a consistent backup
+func backupContainer(w http.ResponseWriter, r *http.Request) {
+	container := visibleContainer(w, r, mux.Vars(r)["id"])
+	if container == nil {
+		return
+	}
+	setAuditContainers(r, container)
+
+	backup, err := controllerManager.BackupContainer(container, sessionUsername(r))
+	if err != nil {
+		logger.Errorf("error backing up %s: %s", container.ID, err)
+		backupError(w, err)
+		return
+	}
+
+	logger.Infof("backed up volumes of %s to %s", container.ID, backup.ID)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(backup); err != nil {
+		logger.Error(err)
+	}
+}
+
+func backups(w http.ResponseWriter, r *http.Request) {
+	backups, err := controllerManager.Backups()
+	if err != nil {
+		backupError(w, err)
+		return
+	}
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !all {
+		visible := []*dockerMan.Backup{}
+		for _, b := range backups {
+			if manager.InTeams(b.Team, teams) {
+				visible = append(visible, b)
+			}
+		}
+		backups = visible
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(backups); err != nil {
+		logger.Error(err)
+	}
+}
+
+func inspectBackup(w http.ResponseWriter, r *http.Request) {
+	backup := visibleBackup(w, r, mux.Vars(r)["id"])
+	if backup == nil {
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(backup); err != nil {
+		logger.Error(err)
+	}
+}
+
+// backupArchive downloads the tar archive of the backup
+func backupArchive(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if visibleBackup(w, r, id) == nil {
+		return
+	}
+
+	archive, err := controllerManager.BackupArchive(id)
+	if err != nil {
+		backupError(w, err)
+		return
+	}
+	defer archive.Close()
+
+	w.Header().Set("content-type", "application/x-tar")
+	w.Header().Set("content-disposition", fmt.Sprintf("attachment; filename=%q", id+".tar"))
+	if _, err := io.Copy(w, archive); err != nil {
+		logger.Error(err)
+	}
+}
+
+func deleteBackup(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if visibleBackup(w, r, id) == nil {
+		return
+	}
+	if err := controllerManager.DeleteBackup(id); err != nil {
+		backupError(w, err)
+		return
+	}
+
+	logger.Infof("deleted backup %s", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreBackup starts a new container with the volumes of the backup, on
+// the engine in the engine parameter or where it is placed
+func restoreBackup(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if visibleBackup(w, r, id) == nil {
+		return
+	}
+
+	container, err := controllerManager.RestoreBackup(id, r.FormValue("engine"), sessionUsername(r))
+	if err != nil {
+		logger.Errorf("error restoring backup %s: %s", id, err)
+		backupError(w, err)
+		return
+	}
+	setAuditContainers(r, container)
+
+	logger.Infof("restored backup %s to %s on %s", id, container.ID, container.Engine.ID)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(container); err != nil {
+		logger.Error(err)
+	}
+}
+
+func accountError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrAccountDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrAccountExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case manager.ErrInvalidCredentials:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case manager.ErrAccountInvalidName, manager.ErrPasswordTooShort, manager.ErrRoleDoesNotExist:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// currentAccount returns the signed in account with the permissions of its
+// role
+func currentAccount(w http.ResponseWriter, r *http.Request) {
+	account, err := controllerManager.Account(sessionUsername(r))
+	if err != nil {
+		accountError(w, err)
+		return
+	}
+
+	info := &accountInfo{
+		Account:     account,
+		Permissions: []string{},
+	}
+	if role, err := controllerManager.Role(account.Role); err == nil {
+		info.Permissions = role.Permissions
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		logger.Error(err)
+	}
+}
+
+// setAccountRole assigns the role in the request to the account
+func setAccountRole(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	var req *roleAssignment
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req == nil {
+		http.Error(w, "role is required", http.StatusBadRequest)
+		return
+	}
+	if username == sessionUsername(r) {
+		http.Error(w, "you cannot change your own role", http.StatusBadRequest)
+		return
+	}
+
+	if err := controllerManager.SetAccountRole(username, req.Role); err != nil {
+		accountError(w, err)
+		return
+	}
+
+	logger.Infof("assigned role %s to %s", req.Role, username)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func roleError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrRoleDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrRoleExists, manager.ErrRoleInUse:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case manager.ErrRoleBuiltin, manager.ErrRoleInvalidName, manager.ErrRoleInvalidPermission:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func roles(w http.ResponseWriter, r *http.Request) {
+	roles, err := controllerManager.Roles()
+	if err != nil {
+		roleError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(roles); err != nil {
+		logger.Error(err)
+	}
+}
+
+func inspectRole(w http.ResponseWriter, r *http.Request) {
+	role, err := controllerManager.Role(mux.Vars(r)["name"])
+	if err != nil {
+		roleError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(role); err != nil {
+		logger.Error(err)
+	}
+}
+
+// saveRole creates a custom role on POST and replaces its permissions on
+// PUT
+func saveRole(w http.ResponseWriter, r *http.Request) {
+	var role *dockerMan.Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if role == nil {
+		http.Error(w, "role is required", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		err    error
+		status = http.StatusCreated
+	)
+	if name := mux.Vars(r)["name"]; name != "" {
+		role.Name = name
+		status = http.StatusOK
+		err = controllerManager.UpdateRole(role)
+	} else {
+		err = controllerManager.CreateRole(role)
+	}
+	if err != nil {
+		logger.Errorf("error saving role %s: %s", role.Name, err)
+		roleError(w, err)
+		return
+	}
+
+	logger.Infof("saved role %s", role.Name)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(role); err != nil {
+		logger.Error(err)
+	}
+}
+
+func deleteRole(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := controllerManager.DeleteRole(name); err != nil {
+		roleError(w, err)
+		return
+	}
+
+	logger.Infof("deleted role %s", name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func teams(w http.ResponseWriter, r *http.Request) {
+	teams, err := controllerManager.Teams()
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(teams); err != nil {
+		logger.Error(err)
+	}
+}
+
+func inspectTeam(w http.ResponseWriter, r *http.Request) {
+	team, err := controllerManager.Team(mux.Vars(r)["name"])
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(team); err != nil {
+		logger.Error(err)
+	}
+}
+
+// saveTeam creates a team on POST and replaces it on PUT
+func saveTeam(w http.ResponseWriter, r *http.Request) {
+	var team *dockerMan.Team
+	if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if team == nil {
+		http.Error(w, "team is required", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		err    error
+		status = http.StatusCreated
+	)
+	if name := mux.Vars(r)["name"]; name != "" {
+		team.Name = name
+		status = http.StatusOK
+		err = controllerManager.UpdateTeam(team)
+	} else {
+		err = controllerManager.CreateTeam(team)
+	}
+	if err != nil {
+		logger.Errorf("error saving team %s: %s", team.Name, err)
+		teamError(w, err)
+		return
+	}
+
+	logger.Infof("saved team %s", team.Name)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(team); err != nil {
+		logger.Error(err)
+	}
+}
+
+func deleteTeam(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := controllerManager.DeleteTeam(name); err != nil {
+		teamError(w, err)
+		return
+	}
+
+	logger.Infof("deleted team %s", name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setAccountTeams replaces the teams of the account with those in the
+// request
+func setAccountTeams(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	var req *teamAssignment
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req == nil {
+		http.Error(w, "teams are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := controllerManager.SetAccountTeams(username, req.Teams); err != nil {
+		if err == manager.ErrTeamDoesNotExist {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		accountError(w, err)
+		return
+	}
+
+	logger.Infof("assigned teams %v to %s", req.Teams, username)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// login checks the credentials and signs the session in as the account
+func login(w http.ResponseWriter, r *http.Request) {
+	var req *loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req == nil {
+		http.Error(w, "username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	account, err := controllerManager.Authenticate(req.Username, req.Password)
+	if err != nil {
+		logger.Warnf("failed login for %s from %s", req.Username, remoteAddr(r))
+		accountError(w, err)
+		return
+	}
+
+	session, _ := controllerManager.Store().Get(r, controllerManager.StoreKey)
+	session.Values["username"] = account.Username
+	session.Values["generation"] = account.SessionGeneration
+	if err := session.Save(r, w); err != nil {
+		logger.Errorf("error saving session: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Infof("%s logged in from %s", account.Username, remoteAddr(r))
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(account); err != nil {
+		logger.Error(err)
+	}
+}
+
+func logout(w http.ResponseWriter, r *http.Request) {
+	session, _ := controllerManager.Store().Get(r, controllerManager.StoreKey)
+	delete(session.Values, "username")
+	delete(session.Values, "generation")
+	session.Options.MaxAge = -1
+	if err := session.Save(r, w); err != nil {
+		logger.Errorf("error saving session: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changePassword replaces the password of the signed in account; the
+// other sessions of the account are signed out
+func changePassword(w http.ResponseWriter, r *http.Request) {
+	var req *passwordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req == nil {
+		http.Error(w, "current and new password are required", http.StatusBadRequest)
+		return
+	}
+
+	username := sessionUsername(r)
+	generation, err := controllerManager.ChangePassword(username, req.CurrentPassword, req.Password)
+	if err != nil {
+		accountError(w, err)
+		return
+	}
+
+	// keep the session the password was changed in
+	if auth.TokenUsername(r) == "" {
+		session, _ := controllerManager.Store().Get(r, controllerManager.StoreKey)
+		session.Values["generation"] = generation
+		if err := session.Save(r, w); err != nil {
+			logger.Errorf("error saving session: %s", err)
+		}
+	}
+
+	logger.Infof("changed password of %s", username)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func accounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := controllerManager.Accounts()
+	if err != nil {
+		accountError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(accounts); err != nil {
+		logger.Error(err)
+	}
+}
+
+func createAccount(w http.ResponseWriter, r *http.Request) {
+	var account *dockerMan.Account
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if account == nil {
+		accountError(w, manager.ErrAccountInvalidName)
+		return
+	}
+
+	if err := controllerManager.CreateAccount(account); err != nil {
+		accountError(w, err)
+		return
+	}
+
+	logger.Infof("created account %s", account.Username)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(account); err != nil {
+		logger.Error(err)
+	}
+}
+
+func deleteAccount(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == sessionUsername(r) {
+		http.Error(w, "you cannot delete your own account", http.StatusBadRequest)
+		return
+	}
+
+	if err := controllerManager.DeleteAccount(username); err != nil {
+		accountError(w, err)
+		return
+	}
+
+	logger.Infof("deleted account %s", username)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func tokenError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrTokenDoesNotExist, manager.ErrAccountDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrUsernameRequired:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// tokenManageable returns true if the signed in account may manage the
+// tokens of the account; its own, and those of service accounts when it
+// may manage accounts
+func tokenManageable(r *http.Request, username string) (bool, error) {
+	current := sessionUsername(r)
+	if current == "" || username == "" {
+		return false, manager.ErrUsernameRequired
+	}
+	if username == current {
+		return true, nil
+	}
+	account, err := controllerManager.Account(username)
+	if err != nil {
+		return false, err
+	}
+	if !account.ServiceAccount {
+		return false, nil
+	}
+	return controllerManager.Permitted(current, manager.PermAccountsManage)
+}
+
+// tokens returns the access tokens of the signed in account or of the
+// service account in the username parameter, without their secrets
+func tokens(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("username")
+	if username == "" {
+		username = sessionUsername(r)
+	}
+	ok, err := tokenManageable(r, username)
+	if err != nil {
+		tokenError(w, err)
+		return
+	}
+	if !ok {
+		http.Error(w, "only the tokens of your account or of service accounts can be listed", http.StatusForbidden)
+		return
+	}
+
+	tokens, err := controllerManager.Tokens(username)
+	if err != nil {
+		tokenError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		logger.Error(err)
+	}
+}
+
+// createToken creates an access token; the token is only in this response
+func createToken(w http.ResponseWriter, r *http.Request) {
+	var req *tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req == nil {
+		http.Error(w, "token request is required", http.StatusBadRequest)
+		return
+	}
+
+	var expires time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid expires_in %q", req.ExpiresIn), http.StatusBadRequest)
+			return
+		}
+		expires = time.Now().Add(d)
+	}
+
+	username := req.Username
+	if username == "" {
+		username = sessionUsername(r)
+	}
+	ok, err := tokenManageable(r, username)
+	if err != nil {
+		tokenError(w, err)
+		return
+	}
+	if !ok {
+		http.Error(w, "tokens can only be created for your account or for service accounts", http.StatusForbidden)
+		return
+	}
+
+	token, err := controllerManager.CreateToken(username, req.Description, expires)
+	if err != nil {
+		logger.Errorf("error creating token for %s: %s", username, err)
+		tokenError(w, err)
+		return
+	}
+
+	logger.Infof("created access token %s for %s", token.ID, username)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(token); err != nil {
+		logger.Error(err)
+	}
+}
+
+func revokeToken(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	token, err := controllerManager.Token(id)
+	if err != nil {
+		tokenError(w, err)
+		return
+	}
+	ok, err := tokenManageable(r, token.Username)
+	if err != nil && err != manager.ErrAccountDoesNotExist {
+		tokenError(w, err)
+		return
+	}
+	if !ok {
+		http.Error(w, "only the tokens of your account or of service accounts can be revoked", http.StatusForbidden)
+		return
+	}
+
+	if err := controllerManager.RevokeToken(id); err != nil {
+		tokenError(w, err)
+		return
+	}
+
+	logger.Infof("revoked access token %s of %s", id, token.Username)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// multipartContext builds a tar build context from the files of a multipart
+// upload; the file in the dockerfile field becomes the Dockerfile
+func multipartContext(r *http.Request) (io.Reader, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the filename is read from the header as part.FileName drops directories
+		_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		if err != nil {
+			return nil, err
+		}
+		name := params["filename"]
+		if part.FormName() == "dockerfile" {
+			name = "Dockerfile"
+		}
+		if name == "" {
+			continue
+		}
+		name = path.Clean(strings.TrimPrefix(name, "/"))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("invalid path in build context: %s", name)
+		}
+
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// streamBuildOutput relays the docker build messages to the client and
+// returns false if the build reported an error
+func streamBuildOutput(w http.ResponseWriter, out io.Reader) bool {
+	var (
+		ok  = true
+		dec = json.NewDecoder(out)
+		enc = json.NewEncoder(w)
+	)
+
+	for {
+		var msg map[string]interface{}
+		if err := dec.Decode(&msg); err != nil {
+			if err != io.EOF {
+				logger.Errorf("error reading build output: %s", err)
+				enc.Encode(map[string]string{"error": err.Error()})
+				ok = false
+			}
+			break
+		}
+		if _, exists := msg["error"]; exists {
+			ok = false
+		}
+		if err := enc.Encode(msg); err != nil {
+			logger.Error(err)
+		}
+		flush(w)
+	}
+
+	return ok
+}
+
+func buildImage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		push bool
+		q    = r.URL.Query()
+		opts = &cluster.BuildOptions{
+			Tag:        q.Get("t"),
+			Dockerfile: q.Get("dockerfile"),
+		}
+	)
+
+	for k, v := range map[string]*bool{"nocache": &opts.NoCache, "pull": &opts.Pull, "push": &push} {
+		if q.Get(k) == "" {
+			continue
+		}
+		if *v, err = strconv.ParseBool(q.Get(k)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if l := q.Get("labels"); l != "" {
+		opts.Labels = strings.Split(l, ",")
+	}
+	// build args are a json object, as in the docker API
+	if a := q.Get("buildargs"); a != "" {
+		if err := json.Unmarshal([]byte(a), &opts.BuildArgs); err != nil {
+			http.Error(w, fmt.Sprintf("invalid buildargs: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if push && opts.Tag == "" {
+		http.Error(w, "a tag is required to push", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, buildContextLimit<<20)
+	opts.Context = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if opts.Context, err = multipartContext(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	engine, out, err := controllerManager.BuildImage(opts)
+	if err != nil {
+		logger.Errorf("error building image %s: %s", opts.Tag, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer out.Close()
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	enc.Encode(map[string]string{"engine": engine.ID})
+
+	if !streamBuildOutput(w, out) || !push {
+		return
+	}
+
+	enc.Encode(map[string]string{"status": fmt.Sprintf("pushing %s from %s", opts.Tag, engine.ID)})
+	flush(w)
+	if err := controllerManager.PushImage(engine, opts.Tag); err != nil {
+		logger.Errorf("error pushing image %s: %s", opts.Tag, err)
+		enc.Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	enc.Encode(map[string]string{"status": fmt.Sprintf("pushed %s", opts.Tag)})
+}
+
+func templateError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrTemplateDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrTemplateConflict:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case manager.ErrTemplateInvalid, cluster.ErrUnknownPullPolicy, cluster.ErrReservedLabel:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case manager.ErrNotTeamResource:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func templateVersion(r *http.Request) (int, error) {
+	v := r.FormValue("version")
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func templates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	templates, err := controllerManager.Templates()
+	if err != nil {
+		templateError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(templates); err != nil {
+		logger.Error(err)
+	}
+}
+
+func inspectTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	version, err := templateVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	template, err := controllerManager.Template(mux.Vars(r)["name"], version)
+	if err != nil {
+		templateError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(template); err != nil {
+		logger.Error(err)
+	}
+}
+
+func templateVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	templates, err := controllerManager.TemplateVersions(mux.Vars(r)["name"])
+	if err != nil {
+		templateError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(templates); err != nil {
+		logger.Error(err)
+	}
+}
+
+func saveTemplate(w http.ResponseWriter, r *http.Request) {
+	var template *dockerMan.Template
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if template == nil {
+		http.Error(w, manager.ErrTemplateInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+	if name := mux.Vars(r)["name"]; name != "" {
+		template.Name = name
+	}
+	template.CreatedBy = sessionUsername(r)
+
+	if err := controllerManager.SaveTemplate(template); err != nil {
+		logger.Errorf("error saving template %s: %s", template.Name, err)
+		templateError(w, err)
+		return
+	}
+
+	logger.Infof("saved template %s version %d", template.Name, template.Version)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(template); err != nil {
+		logger.Error(err)
+	}
+}
+
+func deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	version, err := templateVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if err := controllerManager.DeleteTemplate(name, version); err != nil {
+		templateError(w, err)
+		return
+	}
+
+	logger.Infof("deleted template %s", name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func runTemplate(w http.ResponseWriter, r *http.Request) {
+	overrides := &dockerMan.TemplateOverrides{}
+	if err := json.NewDecoder(r.Body).Decode(overrides); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	team, err := runTeam(r, overrides.Team)
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+	overrides.Team = team
+
+	name := mux.Vars(r)["name"]
+	launched, err := controllerManager.RunTemplate(name, overrides, sessionUsername(r))
+	setAuditContainers(r, launched...)
+	if err != nil {
+		logger.Warnf("error running template %s: %s", name, err)
+		templateError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(launched); err != nil {
+		logger.Error(err)
+	}
+}
+
+func applicationError(w http.ResponseWriter, err error) {
+	switch err {
+	case manager.ErrApplicationDoesNotExist:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case manager.ErrApplicationExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case manager.ErrNotTeamResource:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func applications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	apps, err := controllerManager.Applications()
+	if err != nil {
+		applicationError(w, err)
+		return
+	}
+	teams, all, err := callerTeams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	visible := []*dockerMan.Application{}
+	for _, app := range apps {
+		if all || manager.InTeams(app.Team, teams) {
+			visible = append(visible, app)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(visible); err != nil {
+		logger.Error(err)
+	}
+}
+
+func inspectApplication(w http.ResponseWriter, r *http.Request) {
+	app := visibleApplication(w, r, mux.Vars(r)["name"])
+	if app == nil {
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(app); err != nil {
+		logger.Error(err)
+	}
+}
+
+// deployApplication deploys the fig/compose file in the request body as
+// the application given by the name parameter, owned by the team parameter
+func deployApplication(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	team, err := runTeam(r, r.FormValue("team"))
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project, err := compose.Parse(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app, err := controllerManager.DeployApplication(name, project, string(data), sessionUsername(r), team)
+	if err != nil {
+		logger.Errorf("error deploying application %s: %s", name, err)
+		applicationError(w, err)
+		return
+	}
+
+	logger.Infof("deployed application %s with %d services", app.Name, len(app.Services))
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(app); err != nil {
+		logger.Error(err)
+	}
+}
+
+func stopApplication(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if visibleApplication(w, r, name) == nil {
+		return
+	}
+	if err := controllerManager.StopApplication(name); err != nil {
+		logger.Errorf("error stopping application %s: %s", name, err)
+		applicationError(w, err)
+		return
+	}
+
+	logger.Infof("stopped application %s", name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func removeApplication(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if visibleApplication(w, r, name) == nil {
+		return
+	}
+	if err := controllerManager.RemoveApplication(name); err != nil {
+		logger.Errorf("error removing application %s: %s", name, err)
+		applicationError(w, err)
+		return
+	}
+
+	logger.Infof("removed application %s", name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deploy posts a compose file to a running controller; it backs the -deploy flag
+func deploy(file, name, controller string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		name = filepath.Base(filepath.Dir(abs))
+	}
+
+	u := fmt.Sprintf("%s/api/applications?name=%s", strings.TrimSuffix(controller, "/"), url.QueryEscape(name))
+	resp, err := controllerPost(u, "application/x-yaml", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("deploy failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	fmt.Println(string(body))
+	return nil
+}
+
+func readManifest(w http.ResponseWriter, r *http.Request) (*manifest.Manifest, bool) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	mf, err := manifest.Parse(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return mf, true
+}
+
+// planManifestChanges returns the changes the manifest in the request body
+// makes to the containers of the team parameter without applying them
+func planManifestChanges(w http.ResponseWriter, r *http.Request) {
+	mf, ok := readManifest(w, r)
+	if !ok {
+		return
+	}
+	team, err := runTeam(r, r.FormValue("team"))
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+
+	plan := controllerManager.PlanManifest(mf, r.FormValue("prune") == "true", team)
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		logger.Error(err)
+	}
+}
+
+// applyManifestChanges applies the manifest in the request body to the
+// containers of the team parameter; the plan is returned with the result of
+// each change
+func applyManifestChanges(w http.ResponseWriter, r *http.Request) {
+	mf, ok := readManifest(w, r)
+	if !ok {
+		return
+	}
+	team, err := runTeam(r, r.FormValue("team"))
+	if err != nil {
+		teamError(w, err)
+		return
+	}
+
+	plan, started, err := controllerManager.ApplyManifest(mf, r.FormValue("prune") == "true", team)
+	setAuditContainers(r, started...)
+
+	w.Header().Set("content-type", "application/json")
+	if err != nil {
+		logger.Errorf("error applying manifest: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		logger.Infof("applied manifest: %d changes, %d unchanged", len(plan.Changes), plan.Unchanged)
+	}
+
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		logger.Error(err)
+	}
+}
+
+// sendManifest posts a manifest to the plan or apply endpoint of a running
+// controller and prints the changes; it backs the -plan and -apply flags
+func sendManifest(file, action, controller string, prune bool) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	u := fmt.Sprintf("%s/api/manifest/%s?prune=%t", strings.TrimSuffix(controller, "/"), action, prune)
+	resp, err := controllerPost(u, "application/x-yaml", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var plan *manifest.Plan
+	if err := json.Unmarshal(body, &plan); err != nil {
+		return fmt.Errorf("%s failed: %s: %s", action, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	for _, c := range plan.Changes {
+		fmt.Println(c)
+	}
+	fmt.Printf("%d changes, %d unchanged\n", len(plan.Changes), plan.Unchanged)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s failed: %s", action, resp.Status)
+	}
+	return nil
+}
+
+// migrateContainerMetadata recreates the containers whose metadata is stored
+// in env vars so it is stored in labels
+func migrateContainerMetadata(w http.ResponseWriter, r *http.Request) {
+	migrations, err := controllerManager.MigrateMetadata(r.FormValue("dry_run") == "true")
+
+	w.Header().Set("content-type", "application/json")
+	if err != nil {
+		logger.Errorf("error migrating container metadata: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	if err := json.NewEncoder(w).Encode(migrations); err != nil {
+		logger.Error(err)
+	}
+}
+
+// migrate asks a running controller to migrate the container metadata and
+// prints the result; it backs the -migrate-metadata flag
+func migrate(controller string, dryRun bool) error {
+	u := fmt.Sprintf("%s/api/containers/migrate?dry_run=%t", strings.TrimSuffix(controller, "/"), dryRun)
+	resp, err := controllerPost(u, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var migrations []*manager.MetadataMigration
+	if err := json.Unmarshal(body, &migrations); err != nil {
+		return fmt.Errorf("migration failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	failed := 0
+	for _, m := range migrations {
+		switch {
+		case m.Error != "":
+			failed++
+			fmt.Printf("%s %s: %s\n", m.Container, m.Name, m.Error)
+		case dryRun:
+			fmt.Printf("%s %s\n", m.Container, m.Name)
+		default:
+			fmt.Printf("%s %s -> %s\n", m.Container, m.Name, m.Migrated)
+		}
+	}
+	fmt.Printf("%d containers, %d failed\n", len(migrations), failed)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("migration failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// controllerPost sends a request to the controller with the access token
+func controllerPost(u, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest("POST", u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if accessToken != "" {
+		req.Header.Set("X-Access-Token", accessToken)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// bootstrap creates the first account of the controller
+func bootstrap(username string) error {
+	password := os.Getenv("DOCKERMAN_ADMIN_PASSWORD")
+	if password == "" {
+		fmt.Printf("password for %s: ", username)
+		p, err := readPassword()
+		fmt.Println()
+		if err != nil {
+			return err
+		}
+		password = p
+	}
+
+	return controllerManager.BootstrapAccount(&dockerMan.Account{
+		Username: username,
+		Password: password,
+	})
+}
+
+// readPassword reads a line from stdin without echoing it on a terminal
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		p, err := term.ReadPassword(fd)
+		return string(p), err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func clusterInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	info := controllerManager.ClusterInfo()
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		logger.Error(err)
+	}
+}
+
+func parseAuditQuery(r *http.Request) (*dockerMan.AuditQuery, error) {
+	v := r.URL.Query()
+	q := &dockerMan.AuditQuery{
+		Username:  v.Get("user"),
+		Action:    v.Get("action"),
+		Container: v.Get("container"),
+		Engine:    v.Get("engine"),
+	}
+
+	var err error
+	if since := v.Get("since"); since != "" {
+		if q.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return nil, err
+		}
+	}
+	if until := v.Get("until"); until != "" {
+		if q.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return nil, err
+		}
+	}
+	if limit := v.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, err
+		}
+	}
+	if skip := v.Get("skip"); skip != "" {
+		if q.Skip, err = strconv.Atoi(skip); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func auditEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, total, err := controllerManager.AuditEvents(q)
+	if err != nil {
+		logger.Errorf("error getting audit events: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		logger.Error(err)
+	}
+}
+
+func main() {
+	mHost := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	mPort := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+	mDb := os.Getenv("MONGO_DATABASE")
+	aKey := os.Getenv("DOCKERMAN_AUTH_KEY")
+	sKey := os.Getenv("DOCKERMAN_SESSION_KEY")
+	token := os.Getenv("DOCKERMAN_TOKEN")
+
+	if mHost != "" && mPort != "" {
+		mongodbAddr = fmt.Sprintf("%s:%s", mHost, mPort)
+		fmt.Printf("mongo addr config: %s:%s", mHost, mPort)
+	}
+
+	fmt.Println("mongodb addr is " + mongodbAddr)
+	if mDb != "" {
+		mongodbDatabase = mDb
+	}
+	if aKey != "" {
+		authKey = aKey
+	}
+	if sKey != "" {
+		sessionKey = sKey
+	}
+	if token != "" {
+		accessToken = token
 	}
 
 	flag.Parse()
@@ -219,6 +3102,31 @@ func main() {
 		os.Exit(0)
 	}
 
+	if deployCompose != "" {
+		if err := deploy(deployCompose, deployName, controllerURL); err != nil {
+			logger.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if planManifest != "" || applyManifest != "" {
+		action, file := "plan", planManifest
+		if applyManifest != "" {
+			action, file = "apply", applyManifest
+		}
+		if err := sendManifest(file, action, controllerURL, pruneManifest); err != nil {
+			logger.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if migrateMetadata {
+		if err := migrate(controllerURL, migrateDryRun); err != nil {
+			logger.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	var (
 		mErr      error
 		globalMux = http.NewServeMux()
@@ -226,35 +3134,176 @@ func main() {
 
 	logger.Infof("dockerMan version %s", VERSION)
 
-	controllerManager, mErr = manager.NewManager(mongodbAddr, mongodbDatabase, VERSION, disableUsageInfo)
+	proxies, err := parseTrustedProxies(trustedProxyList)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	trustedProxies = proxies
+
+	controllerManager, mErr = manager.NewManager(mongodbAddr, mongodbDatabase, authKey, VERSION, disableUsageInfo)
 	if mErr != nil {
 		logger.Fatal(mErr)
 	}
 
+	if bootstrapAdmin != "" {
+		if err := bootstrap(bootstrapAdmin); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Infof("created account %s", bootstrapAdmin)
+		os.Exit(0)
+	}
+
+	if sessionKey != "" {
+		controllerManager.SetSessionKey([]byte(sessionKey), secureCookies)
+	} else {
+		logger.Warn("no -session-key set; sessions end when the controller restarts")
+		controllerManager.SetSessionKey(securecookie.GenerateRandomKey(32), secureCookies)
+	}
+
+	if backupDir != "" {
+		if err := controllerManager.SetBackupDir(backupDir); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	controllerManager.ScheduleServiceRefresh(discoveryInterval)
+	if dnsAddr != "" {
+		server := discovery.NewDNSServer(dnsDomain, controllerManager.ServiceRegistry())
+		go func() {
+			logger.Infof("service discovery dns listening on %s for %s", dnsAddr, dnsDomain)
+			if err := server.ListenAndServe(dnsAddr); err != nil {
+				logger.Fatal(err)
+			}
+		}()
+	}
+
+	if proxyListenAddr != "" {
+		go func() {
+			logger.Infof("reverse proxy listening on %s", proxyListenAddr)
+			if err := http.ListenAndServe(proxyListenAddr, controllerManager.Proxy()); err != nil {
+				logger.Fatal(err)
+			}
+		}()
+	}
+
+	if imageGCInterval > 0 {
+		protected := []string{}
+		if imageGCProtect != "" {
+			protected = strings.Split(imageGCProtect, ",")
+		}
+		controllerManager.ScheduleImageGC(imageGCInterval, &cluster.ImageGCOptions{
+			MinAge:    imageGCMinAge,
+			Protected: protected,
+		})
+	}
+
 	apiRouter := mux.NewRouter()
-	apiRouter.HandleFunc("/api/cluster/info", clusterInfo).Methods("GET")
-	apiRouter.HandleFunc("/api/containers", containers).Methods("GET")
-	apiRouter.HandleFunc("/api/containers", run).Methods("POST")
-	apiRouter.HandleFunc("/api/containers/{id}", inspectContainer).Methods("GET")
-	apiRouter.HandleFunc("/api/containers/{id}", destroy).Methods("DELETE")
-	apiRouter.HandleFunc("/api/containers/{id}/stop", stopContainer).Methods("GET")
-	apiRouter.HandleFunc("/api/containers/{id}/restart", restartContainer).Methods("GET")
-	apiRouter.HandleFunc("/api/engines", engines).Methods("GET")
-	apiRouter.HandleFunc("/api/engines/{id}", inspectEngine).Methods("GET")
+	apiAccess := access.NewAccessRequired(controllerManager, apiRouter)
+	apiAccess.Require(apiRouter.HandleFunc("/api/cluster/info", clusterInfo).Methods("GET"), manager.PermEnginesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers", containers).Methods("GET"), manager.PermContainersView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers", audited("run", run)).Methods("POST"), manager.PermContainersManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers/migrate", audited("migrate-metadata", migrateContainerMetadata)).Methods("POST"), manager.PermContainersAllTeams)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers/{id}", inspectContainer).Methods("GET"), manager.PermContainersView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers/{id}", audited("destroy", destroy)).Methods("DELETE"), manager.PermContainersManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers/{id}/networks", audited("connect-network", connectNetwork)).Methods("POST"), manager.PermNetworksManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers/{id}/networks/{network}", audited("disconnect-network", disconnectNetwork)).Methods("DELETE"), manager.PermNetworksManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers/{id}/export", exportContainer).Methods("GET"), manager.PermContainersView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers/{id}/backup", audited("backup", backupContainer)).Methods("POST"), manager.PermBackupsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers/{id}/stop", audited("stop", stopContainer)).Methods("POST"), manager.PermContainersManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/containers/{id}/restart", audited("restart", restartContainer)).Methods("POST"), manager.PermContainersManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/engines", engines).Methods("GET"), manager.PermEnginesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/engines/{id}", inspectEngine).Methods("GET"), manager.PermEnginesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/images", images).Methods("GET"), manager.PermImagesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/images/pull", audited("pull", pullImage)).Methods("POST"), manager.PermImagesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/images/build", auditedUpload("build", buildImage)).Methods("POST"), manager.PermImagesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/images/gc", imageGCReports).Methods("GET"), manager.PermImagesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/images/gc", audited("image-gc", collectImages)).Methods("POST"), manager.PermImagesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/networks", networks).Methods("GET"), manager.PermNetworksView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/networks", audited("create-network", createNetwork)).Methods("POST"), manager.PermNetworksManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/networks/{name}", audited("remove-network", removeNetwork)).Methods("DELETE"), manager.PermNetworksManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/volumes", volumes).Methods("GET"), manager.PermVolumesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/volumes", audited("create-volume", createVolume)).Methods("POST"), manager.PermVolumesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/volumes/{name}", inspectVolume).Methods("GET"), manager.PermVolumesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/volumes/{name}", audited("remove-volume", removeVolume)).Methods("DELETE"), manager.PermVolumesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/backups", backups).Methods("GET"), manager.PermBackupsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/backups/{id}", inspectBackup).Methods("GET"), manager.PermBackupsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/backups/{id}", audited("delete-backup", deleteBackup)).Methods("DELETE"), manager.PermBackupsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/backups/{id}/archive", backupArchive).Methods("GET"), manager.PermBackupsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/backups/{id}/restore", audited("restore-backup", restoreBackup)).Methods("POST"), manager.PermBackupsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/services", services).Methods("GET"), manager.PermServicesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/services/{name}", inspectService).Methods("GET"), manager.PermServicesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/templates", templates).Methods("GET"), manager.PermTemplatesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/templates", audited("create-template", saveTemplate)).Methods("POST"), manager.PermTemplatesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/templates/{name}", inspectTemplate).Methods("GET"), manager.PermTemplatesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/templates/{name}", audited("update-template", saveTemplate)).Methods("PUT"), manager.PermTemplatesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/templates/{name}", audited("delete-template", deleteTemplate)).Methods("DELETE"), manager.PermTemplatesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/templates/{name}/versions", templateVersions).Methods("GET"), manager.PermTemplatesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/templates/{name}/run", audited("run-template", runTemplate)).Methods("POST"), manager.PermContainersManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/applications", applications).Methods("GET"), manager.PermApplicationsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/applications", audited("deploy-application", deployApplication)).Methods("POST"), manager.PermApplicationsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/applications/{name}", inspectApplication).Methods("GET"), manager.PermApplicationsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/applications/{name}", audited("remove-application", removeApplication)).Methods("DELETE"), manager.PermApplicationsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/applications/{name}/stop", audited("stop-application", stopApplication)).Methods("POST"), manager.PermApplicationsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/manifest/plan", planManifestChanges).Methods("POST"), manager.PermApplicationsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/manifest/apply", audited("apply-manifest", applyManifestChanges)).Methods("POST"), manager.PermContainersAllTeams)
+	apiAccess.Require(apiRouter.HandleFunc("/api/registries", registries).Methods("GET"), manager.PermRegistriesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/registries", audited("create-registry", saveRegistry)).Methods("POST"), manager.PermRegistriesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/registries/{id}", inspectRegistry).Methods("GET"), manager.PermRegistriesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/registries/{id}", audited("update-registry", saveRegistry)).Methods("PUT"), manager.PermRegistriesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/registries/{id}", audited("delete-registry", deleteRegistry)).Methods("DELETE"), manager.PermRegistriesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/secrets", secrets).Methods("GET"), manager.PermSecretsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/secrets", audited("create-secret", saveSecret)).Methods("POST"), manager.PermSecretsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/secrets/{name}", inspectSecret).Methods("GET"), manager.PermSecretsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/secrets/{name}", audited("update-secret", saveSecret)).Methods("PUT"), manager.PermSecretsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/secrets/{name}", audited("delete-secret", deleteSecret)).Methods("DELETE"), manager.PermSecretsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/routes", routes).Methods("GET"), manager.PermRoutesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/routes", audited("create-route", saveRoute)).Methods("POST"), manager.PermRoutesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/routes/{name}", inspectRoute).Methods("GET"), manager.PermRoutesView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/routes/{name}", audited("update-route", saveRoute)).Methods("PUT"), manager.PermRoutesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/routes/{name}", audited("delete-route", deleteRoute)).Methods("DELETE"), manager.PermRoutesManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/audit", auditEvents).Methods("GET"), manager.PermAuditView)
+
+	apiAccess.Require(apiRouter.HandleFunc("/api/accounts", accounts).Methods("GET"), manager.PermAccountsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/accounts", audited("create-account", createAccount)).Methods("POST"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/accounts/{username}", audited("delete-account", deleteAccount)).Methods("DELETE"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/tokens", tokens).Methods("GET"), access.Any)
+	apiAccess.Require(apiRouter.HandleFunc("/api/tokens", audited("create-token", createToken)).Methods("POST"), access.Any)
+	apiAccess.Require(apiRouter.HandleFunc("/api/tokens/{id}", audited("revoke-token", revokeToken)).Methods("DELETE"), access.Any)
+	apiAccess.Require(apiRouter.HandleFunc("/api/account", currentAccount).Methods("GET"), access.Any)
+	apiAccess.Require(apiRouter.HandleFunc("/api/accounts/{username}/role", audited("set-role", setAccountRole)).Methods("PUT"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/accounts/{username}/teams", audited("set-teams", setAccountTeams)).Methods("PUT"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/teams", teams).Methods("GET"), manager.PermAccountsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/teams", audited("create-team", saveTeam)).Methods("POST"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/teams/{name}", inspectTeam).Methods("GET"), manager.PermAccountsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/teams/{name}", audited("update-team", saveTeam)).Methods("PUT"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/teams/{name}", audited("delete-team", deleteTeam)).Methods("DELETE"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/roles", roles).Methods("GET"), manager.PermAccountsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/roles", audited("create-role", saveRole)).Methods("POST"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/roles/{name}", inspectRole).Methods("GET"), manager.PermAccountsView)
+	apiAccess.Require(apiRouter.HandleFunc("/api/roles/{name}", audited("update-role", saveRole)).Methods("PUT"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/roles/{name}", audited("delete-role", deleteRole)).Methods("DELETE"), manager.PermAccountsManage)
+	apiAccess.Require(apiRouter.HandleFunc("/api/account/password", audited("change-password", changePassword)).Methods("POST"), access.Any)
+
+	// login router; not protected
+	authRouter := mux.NewRouter()
+	authRouter.HandleFunc("/auth/login", audited("login", login)).Methods("POST")
+	authRouter.HandleFunc("/auth/logout", logout).Methods("POST")
+	globalMux.Handle("/auth/", authRouter)
 
 	// global handler
 	globalMux.Handle("/", http.FileServer(http.Dir("static")))
 
 	// api router; protected by auth
 	apiAuthRouter := negroni.New()
-	//apiAuthRequired := auth.NewAuthRequired(controllerManager)
-	//apiAccessRequired := access.NewAccessRequired(controllerManager)
-	//apiAuthRouter.Use(negroni.HandlerFunc(apiAuthRequired.HandlerFuncWithNext))
-	//apiAuthRouter.Use(negroni.HandlerFunc(apiAccessRequired.HandlerFuncWithNext))
+	apiTokenAuth := auth.NewTokenAuth(controllerManager)
+	apiAuthRequired := auth.NewAuthRequired(controllerManager)
+	apiAuthRouter.Use(negroni.HandlerFunc(apiTokenAuth.HandlerFuncWithNext))
+	apiAuthRouter.Use(negroni.HandlerFunc(apiAuthRequired.HandlerFuncWithNext))
+	apiAuthRouter.Use(negroni.HandlerFunc(apiAccess.HandlerFuncWithNext))
 	apiAuthRouter.UseHandler(apiRouter)
 	globalMux.Handle("/api/", apiAuthRouter)
 
-	if err := http.ListenAndServe(listenAddr, context.ClearHandler(globalMux)); err != nil {
+	if err := http.ListenAndServe(listenAddr, gcontext.ClearHandler(globalMux)); err != nil {
 		logger.Fatal(err)
 	}
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := parseTrustedProxies(" 10.0.0.1, 192.168.0.0/16,,fd00::1 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"10.0.0.1/32", "192.168.0.0/16", "fd00::1/128"}
+	if len(networks) != len(expected) {
+		t.Fatalf("expected %v; received %v", expected, networks)
+	}
+	for i, n := range networks {
+		if n.String() != expected[i] {
+			t.Errorf("expected %s; received %s", expected[i], n)
+		}
+	}
+
+	for _, list := range []string{"proxy.internal", "10.0.0.0/33"} {
+		if _, err := parseTrustedProxies(list); err == nil {
+			t.Errorf("%s: expected an error", list)
+		}
+	}
+}
+
+func TestRemoteAddr(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.1,10.1.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { trustedProxies = nil }()
+	trustedProxies = proxies
+
+	tests := []struct {
+		remote    string
+		forwarded []string
+		addr      string
+	}{
+		// clients cannot claim an address without a trusted proxy
+		{"203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"10.0.0.1:5000", nil, "10.0.0.1"},
+		{"10.0.0.1:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		// the client is the last address not added by a trusted proxy
+		{"10.0.0.1:5000", []string{"192.0.2.9, 198.51.100.1, 10.1.2.3"}, "198.51.100.1"},
+		{"10.0.0.1:5000", []string{"192.0.2.9", "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:5000", []string{"10.1.2.3"}, "10.1.2.3"},
+		{"10.0.0.1:5000", []string{" , "}, "10.0.0.1"},
+		{"@", []string{"198.51.100.1"}, "@"},
+	}
+
+	for _, test := range tests {
+		r := &http.Request{RemoteAddr: test.remote, Header: http.Header{}}
+		if test.forwarded != nil {
+			r.Header["X-Forwarded-For"] = test.forwarded
+		}
+		if addr := remoteAddr(r); addr != test.addr {
+			t.Errorf("%s %v: expected %s; received %s", test.remote, test.forwarded, test.addr, addr)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	body := `{"username":"alice","password":"hunter2","auth":{"Password":"x","server":"hub"},` +
+		`"secrets":[{"name":"db","value":"s3cret"}],"token":"abc","current_password":"old"}`
+
+	var redacted map[string]interface{}
+	if err := json.Unmarshal([]byte(redactBody([]byte(body))), &redacted); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"username":         "alice",
+		"password":         "********",
+		"auth":             map[string]interface{}{"Password": "********", "server": "hub"},
+		"secrets":          []interface{}{map[string]interface{}{"name": "db", "value": "********"}},
+		"token":            "********",
+		"current_password": "********",
+	}
+	if !reflect.DeepEqual(redacted, expected) {
+		t.Fatalf("expected %v; received %v", expected, redacted)
+	}
+
+	// bodies that are not json are kept as they are
+	if b := redactBody([]byte("not json")); b != "not json" {
+		t.Fatalf("expected the body to be kept; received %s", b)
+	}
+}
+
+func TestAuditRecordInRequestContext(t *testing.T) {
+	var rec *auditRecord
+	h := func(w http.ResponseWriter, r *http.Request) {
+		// handlers see a copy of the request, as mux hands them
+		r = r.WithContext(r.Context())
+		setAuditContainers(r, &cluster.Container{ID: "abc"})
+		setAuditErrors(r, []string{"engine-1: failed"})
+		rec = requestAuditRecord(r)
+	}
+
+	r, _ := http.NewRequest("POST", "/api/containers", nil)
+	holder := &auditRecord{}
+	h(nil, withAuditRecord(r, holder))
+	if rec != holder || len(holder.containers) != 1 || len(holder.errors) != 1 {
+		t.Fatalf("expected the values in the request holder; received %+v", holder)
+	}
+
+	// without a holder, as outside of audit, the values are dropped
+	setAuditContainers(r, &cluster.Container{ID: "abc"})
+}
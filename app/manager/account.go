@@ -0,0 +1,212 @@
+package manager
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/yleemj/dockerMan"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	minPasswordLength = 8
+)
+
+var (
+	ErrAccountDoesNotExist = errors.New("account does not exist")
+	ErrAccountExists       = errors.New("account already exists")
+	ErrAccountInvalidName  = errors.New("usernames may only contain letters, digits, '_', '.' and '-'")
+	ErrPasswordTooShort    = errors.New("passwords must be at least 8 characters")
+	ErrInvalidCredentials  = errors.New("invalid username or password")
+	ErrAccountsExist       = errors.New("accounts already exist")
+
+	validUsername = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// SetSessionKey replaces the key the session cookies are signed with;
+// sessions signed with the previous key are no longer valid. Secure
+// cookies are only sent over https.
+func (m *Manager) SetSessionKey(key []byte, secure bool) {
+	s := sessions.NewCookieStore(key)
+	s.Options.HttpOnly = true
+	s.Options.SameSite = http.SameSiteStrictMode
+	s.Options.Secure = secure
+	m.store = s
+}
+
+// Accounts returns the accounts without their password hashes
+func (m *Manager) Accounts() ([]*dockerMan.Account, error) {
+	accounts := []*dockerMan.Account{}
+	if err := m.mgoDB.C(tblNameAccounts).Find(nil).Sort("_id").All(&accounts); err != nil {
+		return nil, err
+	}
+	for _, a := range accounts {
+		a.PasswordHash = ""
+	}
+	return accounts, nil
+}
+
+func (m *Manager) Account(username string) (*dockerMan.Account, error) {
+	var account *dockerMan.Account
+	if err := m.mgoDB.C(tblNameAccounts).FindId(username).One(&account); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrAccountDoesNotExist
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+// CreateAccount stores a new account with its password hashed; service
+// accounts have no password. Accounts without a role are read-only.
+func (m *Manager) CreateAccount(account *dockerMan.Account) error {
+	if !validUsername.MatchString(account.Username) {
+		return ErrAccountInvalidName
+	}
+
+	if account.Role == "" {
+		account.Role = RoleReadOnly
+	}
+	if _, err := m.Role(account.Role); err != nil {
+		return err
+	}
+
+	hash := ""
+	if !account.ServiceAccount {
+		h, err := hashPassword(account.Password)
+		if err != nil {
+			return err
+		}
+		hash = h
+	}
+
+	if _, err := m.Account(account.Username); err != ErrAccountDoesNotExist {
+		if err == nil {
+			return ErrAccountExists
+		}
+		return err
+	}
+
+	account.Password = ""
+	account.PasswordHash = hash
+	account.Created = time.Now()
+
+	if err := m.mgoDB.C(tblNameAccounts).Insert(account); err != nil {
+		if mgo.IsDup(err) {
+			return ErrAccountExists
+		}
+		return err
+	}
+	return nil
+}
+
+// BootstrapAccount creates the first account as an admin; it fails once
+// any account exists so it cannot be used to take over a controller
+func (m *Manager) BootstrapAccount(account *dockerMan.Account) error {
+	n, err := m.mgoDB.C(tblNameAccounts).Count()
+	if err != nil {
+		return err
+	}
+	if err := bootstrapAdmin(account, n); err != nil {
+		return err
+	}
+	return m.CreateAccount(account)
+}
+
+// bootstrapAdmin makes the account an admin unless there are accounts
+func bootstrapAdmin(account *dockerMan.Account, accounts int) error {
+	if accounts > 0 {
+		return ErrAccountsExist
+	}
+	account.Role = RoleAdmin
+	return nil
+}
+
+// DeleteAccount removes the account and revokes its access tokens
+func (m *Manager) DeleteAccount(username string) error {
+	if err := m.mgoDB.C(tblNameAccounts).RemoveId(username); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrAccountDoesNotExist
+		}
+		return err
+	}
+	_, err := m.mgoDB.C(tblNameTokens).RemoveAll(bson.M{"username": username})
+	return err
+}
+
+// Authenticate returns the account if the password matches its hash
+func (m *Manager) Authenticate(username, password string) (*dockerMan.Account, error) {
+	account, err := m.Account(username)
+	if err != nil {
+		if err == ErrAccountDoesNotExist {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := checkPassword(account, password); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// checkPassword returns ErrInvalidCredentials unless the password matches
+// the hash of the account; service accounts have no password
+func checkPassword(account *dockerMan.Account, password string) error {
+	if account.ServiceAccount {
+		return ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// ChangePassword replaces the password of the account after checking the
+// current one. The sessions of the account are signed out by raising its
+// session generation, which is returned.
+func (m *Manager) ChangePassword(username, current, password string) (int, error) {
+	account, err := m.Authenticate(username, current)
+	if err != nil {
+		return 0, err
+	}
+
+	hash, generation, err := passwordChange(account, password)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.mgoDB.C(tblNameAccounts).UpdateId(username, bson.M{"$set": bson.M{
+		"password":           hash,
+		"session_generation": generation,
+	}}); err != nil {
+		return 0, err
+	}
+	return generation, nil
+}
+
+// passwordChange returns the hash of the new password of the account and
+// the session generation signing out its sessions
+func passwordChange(account *dockerMan.Account, password string) (string, int, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return "", 0, err
+	}
+	return hash, account.SessionGeneration + 1, nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
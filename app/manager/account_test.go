@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/yleemj/dockerMan"
+)
+
+func TestBootstrapAdmin(t *testing.T) {
+	account := &dockerMan.Account{Username: "admin", Role: RoleReadOnly}
+	if err := bootstrapAdmin(account, 0); err != nil {
+		t.Fatal(err)
+	}
+	if account.Role != RoleAdmin {
+		t.Fatalf("expected the first account to be an admin; received %s", account.Role)
+	}
+
+	// the bootstrap cannot take over a controller with accounts
+	account = &dockerMan.Account{Username: "mallory"}
+	if err := bootstrapAdmin(account, 1); err != ErrAccountsExist {
+		t.Fatalf("expected %v; received %v", ErrAccountsExist, err)
+	}
+	if account.Role != "" {
+		t.Fatalf("expected the role to be left unset; received %s", account.Role)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := &dockerMan.Account{Username: "alice", PasswordHash: hash}
+
+	if err := checkPassword(account, "correct horse"); err != nil {
+		t.Fatalf("expected the password to match; received %v", err)
+	}
+	if err := checkPassword(account, "battery staple"); err != ErrInvalidCredentials {
+		t.Fatalf("expected %v; received %v", ErrInvalidCredentials, err)
+	}
+
+	// service accounts only authenticate with tokens
+	service := &dockerMan.Account{Username: "ci", PasswordHash: hash, ServiceAccount: true}
+	if err := checkPassword(service, "correct horse"); err != ErrInvalidCredentials {
+		t.Fatalf("expected %v for a service account; received %v", ErrInvalidCredentials, err)
+	}
+}
+
+func TestPasswordChange(t *testing.T) {
+	account := &dockerMan.Account{Username: "alice", SessionGeneration: 3}
+
+	if _, _, err := passwordChange(account, "short"); err != ErrPasswordTooShort {
+		t.Fatalf("expected %v; received %v", ErrPasswordTooShort, err)
+	}
+
+	hash, generation, err := passwordChange(account, "a longer password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generation != 4 {
+		t.Fatalf("expected the session generation to be raised to 4; received %d", generation)
+	}
+	account.PasswordHash = hash
+	if err := checkPassword(account, "a longer password"); err != nil {
+		t.Fatalf("expected the new password to match; received %v", err)
+	}
+}
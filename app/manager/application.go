@@ -0,0 +1,199 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/cluster"
+	"github.com/yleemj/dockerMan/app/compose"
+	"gopkg.in/mgo.v2"
+)
+
+var (
+	ErrApplicationDoesNotExist = errors.New("application does not exist")
+	ErrApplicationExists       = errors.New("application already exists")
+)
+
+// DeployApplication starts the services of a compose project in link order
+// as containers of the team. Linked services are started on the same
+// engine; if any service fails to start the containers already started are
+// removed.
+func (m *Manager) DeployApplication(name string, project *compose.Project, source string, username string, team string) (*dockerMan.Application, error) {
+	if err := compose.ValidateName(name); err != nil {
+		return nil, err
+	}
+	defer m.servicesChanged()
+	if _, err := m.Application(name); err != ErrApplicationDoesNotExist {
+		if err == nil {
+			return nil, ErrApplicationExists
+		}
+		return nil, err
+	}
+
+	order, err := project.StartOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		groups      = project.Groups()
+		groupEngine = make(map[string]string)
+		app         = &dockerMan.Application{
+			Name:      name,
+			Services:  []*dockerMan.ApplicationService{},
+			Compose:   source,
+			Created:   time.Now(),
+			CreatedBy: username,
+			Team:      team,
+		}
+	)
+
+	for _, svc := range order {
+		image, err := project.Image(name, svc)
+		if err != nil {
+			m.removeApplicationContainers(app)
+			return nil, err
+		}
+		image.Owner = username
+		image.Team = team
+		if err := m.applyTeam(image); err != nil {
+			m.removeApplicationContainers(app)
+			return nil, err
+		}
+
+		var c *cluster.Container
+		if engineID, ok := groupEngine[groups[svc]]; ok {
+			c, err = m.clusterManager.StartOnEngine(engineID, image, "")
+		} else {
+			c, err = m.clusterManager.Start(image, "")
+		}
+		if err != nil {
+			logger.Errorf("error starting service %s of %s: %s", svc, name, err)
+			m.removeApplicationContainers(app)
+			return nil, fmt.Errorf("error starting service %s: %s", svc, err)
+		}
+
+		groupEngine[groups[svc]] = c.Engine.ID
+		app.Services = append(app.Services, &dockerMan.ApplicationService{
+			Name:      svc,
+			Container: c.ID,
+			Engine:    c.Engine.ID,
+			Image:     image,
+		})
+
+		logger.Infof("started service %s of %s as %s on %s", svc, name, c.ID, c.Engine.ID)
+	}
+
+	if err := m.mgoDB.C(tblNameApplications).Insert(app); err != nil {
+		m.removeApplicationContainers(app)
+		return nil, err
+	}
+
+	return app, nil
+}
+
+func (m *Manager) Applications() ([]*dockerMan.Application, error) {
+	apps := []*dockerMan.Application{}
+	if err := m.mgoDB.C(tblNameApplications).Find(nil).Sort("_id").All(&apps); err != nil {
+		return nil, err
+	}
+
+	states := m.containerStates()
+	for _, a := range apps {
+		setServiceStates(a, states)
+	}
+	return apps, nil
+}
+
+// Application returns the named application with the current state of its containers
+func (m *Manager) Application(name string) (*dockerMan.Application, error) {
+	var app *dockerMan.Application
+	if err := m.mgoDB.C(tblNameApplications).FindId(name).One(&app); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrApplicationDoesNotExist
+		}
+		return nil, err
+	}
+
+	setServiceStates(app, m.containerStates())
+	return app, nil
+}
+
+// StopApplication stops the containers of the application in reverse start order
+func (m *Manager) StopApplication(name string) error {
+	app, err := m.Application(name)
+	if err != nil {
+		return err
+	}
+	defer m.servicesChanged()
+
+	for i := len(app.Services) - 1; i >= 0; i-- {
+		svc := app.Services[i]
+		c, err := m.Container(svc.Container)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			continue
+		}
+		if err := m.clusterManager.Stop(c); err != nil {
+			return fmt.Errorf("error stopping service %s: %s", svc.Name, err)
+		}
+	}
+	return nil
+}
+
+// RemoveApplication destroys the containers of the application and forgets it
+func (m *Manager) RemoveApplication(name string) error {
+	app, err := m.Application(name)
+	if err != nil {
+		return err
+	}
+
+	if err := m.removeApplicationContainers(app); err != nil {
+		return err
+	}
+
+	return m.mgoDB.C(tblNameApplications).RemoveId(name)
+}
+
+func (m *Manager) removeApplicationContainers(app *dockerMan.Application) error {
+	var lastErr error
+	for i := len(app.Services) - 1; i >= 0; i-- {
+		svc := app.Services[i]
+		c, err := m.Container(svc.Container)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if c == nil {
+			continue
+		}
+		if err := m.Destroy(c); err != nil {
+			logger.Errorf("error removing service %s of %s: %s", svc.Name, app.Name, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// containerStates maps container ids to their state
+func (m *Manager) containerStates() map[string]string {
+	states := make(map[string]string)
+	for _, c := range m.Containers(true) {
+		states[c.ID] = c.State
+	}
+	return states
+}
+
+func setServiceStates(app *dockerMan.Application, states map[string]string) {
+	for _, svc := range app.Services {
+		state, ok := states[svc.Container]
+		if !ok {
+			state = "missing"
+		}
+		svc.State = state
+	}
+}
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/yleemj/dockerMan"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+func (m *Manager) SaveAuditEvent(evt *dockerMan.AuditEvent) error {
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	return m.mgoDB.C(tblNameAudit).Insert(evt)
+}
+
+// AuditEvents returns the audit events matching the query, newest first,
+// along with the total number of matching events
+func (m *Manager) AuditEvents(q *dockerMan.AuditQuery) ([]*dockerMan.AuditEvent, int, error) {
+	filter := bson.M{}
+	if q.Username != "" {
+		filter["username"] = q.Username
+	}
+	if q.Action != "" {
+		filter["action"] = q.Action
+	}
+	if q.Container != "" {
+		filter["containers"] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(q.Container)}
+	}
+	if q.Engine != "" {
+		filter["engines"] = q.Engine
+	}
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		t := bson.M{}
+		if !q.Since.IsZero() {
+			t["$gte"] = q.Since
+		}
+		if !q.Until.IsZero() {
+			t["$lte"] = q.Until
+		}
+		filter["time"] = t
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	query := m.mgoDB.C(tblNameAudit).Find(filter)
+	total, err := query.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events := []*dockerMan.AuditEvent{}
+	if err := query.Sort("-time").Skip(q.Skip).Limit(limit).All(&events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/cluster"
+	"gopkg.in/mgo.v2"
+)
+
+var (
+	ErrBackupsDisabled    = errors.New("backups are disabled; start the controller with -backup-dir")
+	ErrBackupDoesNotExist = errors.New("backup does not exist")
+)
+
+// SetBackupDir sets the directory volume backups are written to, creating
+// it if needed
+func (m *Manager) SetBackupDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	m.backupDir = dir
+	return nil
+}
+
+func (m *Manager) backupPath(id string) string {
+	return filepath.Join(m.backupDir, id+".tar")
+}
+
+// BackupContainer archives the volumes of the container into the backup
+// directory and stores the backup with the definition of the container
+func (m *Manager) BackupContainer(container *cluster.Container, username string) (*dockerMan.Backup, error) {
+	if m.backupDir == "" {
+		return nil, ErrBackupsDisabled
+	}
+
+	image, err := container.Engine.Export(container)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &dockerMan.Backup{
+		ID:            generateId(16),
+		Container:     container.ID,
+		ContainerName: container.Name,
+		Engine:        container.Engine.ID,
+		Team:          container.Image.Team,
+		Image:         image,
+		Created:       time.Now(),
+		CreatedBy:     username,
+	}
+
+	file := m.backupPath(backup.ID)
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, err := container.Engine.Backup(container, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file)
+		return nil, err
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	backup.Volumes = volumes
+	backup.Size = info.Size()
+
+	if err := m.mgoDB.C(tblNameBackups).Insert(backup); err != nil {
+		os.Remove(file)
+		return nil, err
+	}
+	return backup, nil
+}
+
+// Backups returns the backups, newest first
+func (m *Manager) Backups() ([]*dockerMan.Backup, error) {
+	backups := []*dockerMan.Backup{}
+	if err := m.mgoDB.C(tblNameBackups).Find(nil).Sort("-created").All(&backups); err != nil {
+		return nil, err
+	}
+	return backups, nil
+}
+
+func (m *Manager) Backup(id string) (*dockerMan.Backup, error) {
+	var backup *dockerMan.Backup
+	if err := m.mgoDB.C(tblNameBackups).FindId(id).One(&backup); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrBackupDoesNotExist
+		}
+		return nil, err
+	}
+	return backup, nil
+}
+
+// BackupArchive opens the tar archive of the backup
+func (m *Manager) BackupArchive(id string) (*os.File, error) {
+	if m.backupDir == "" {
+		return nil, ErrBackupsDisabled
+	}
+	if _, err := m.Backup(id); err != nil {
+		return nil, err
+	}
+	return os.Open(m.backupPath(id))
+}
+
+// DeleteBackup removes the archive and the record of the backup
+func (m *Manager) DeleteBackup(id string) error {
+	if m.backupDir == "" {
+		return ErrBackupsDisabled
+	}
+	if _, err := m.Backup(id); err != nil {
+		return err
+	}
+	if err := os.Remove(m.backupPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return m.mgoDB.C(tblNameBackups).RemoveId(id)
+}
+
+// RestoreBackup starts a container from the definition of the backed up
+// container with the archive extracted into its volumes. Named volumes get
+// the backup id as suffix so the original volumes are left untouched. The
+// container runs on the engine with the id, or where it is placed when
+// engineID is empty, and is owned by the account restoring it.
+func (m *Manager) RestoreBackup(id, engineID, username string) (*cluster.Container, error) {
+	archive, err := m.BackupArchive(id)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	backup, err := m.Backup(id)
+	if err != nil {
+		return nil, err
+	}
+	defer m.servicesChanged()
+
+	image := cluster.RestoreImage(backup.Image, id[:8])
+	// the restored container runs next to the original one, so it cannot
+	// reuse its name
+	image.ContainerName = ""
+	image.Team = backup.Team
+	image.Owner = username
+	if err := m.applyTeam(image); err != nil {
+		return nil, err
+	}
+
+	return m.clusterManager.Restore(image, engineID, archive)
+}
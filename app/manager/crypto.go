@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNoAuthKey     = errors.New("no auth key configured; unable to store secrets")
+	ErrInvalidCipher = errors.New("invalid encrypted value")
+)
+
+// encrypt seals the value with AES-GCM using a key derived from the manager's auth key
+func (m *Manager) encrypt(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	gcm, err := m.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a value sealed by encrypt
+func (m *Manager) decrypt(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	gcm, err := m.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", ErrInvalidCipher
+	}
+
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (m *Manager) cipher() (cipher.AEAD, error) {
+	if m.authKey == "" {
+		return nil, ErrNoAuthKey
+	}
+
+	key := sha256.Sum256([]byte(m.authKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,54 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/discovery"
+)
+
+// ServiceRegistry returns the registry of the published service endpoints
+func (m *Manager) ServiceRegistry() *discovery.Registry {
+	return m.services
+}
+
+// Services returns the endpoints of every service in the cluster
+func (m *Manager) Services() map[string][]*discovery.Endpoint {
+	return m.services.Services()
+}
+
+// Service returns the endpoints of the service
+func (m *Manager) Service(name string) []*discovery.Endpoint {
+	return m.services.Lookup(name)
+}
+
+// RefreshServices updates the service registry and the proxy backends from
+// the running containers
+func (m *Manager) RefreshServices() {
+	containers := m.clusterManager.ListContainers(false, false, "")
+	m.services.Update(containers)
+
+	routes := []*dockerMan.Route{}
+	if err := m.mgoDB.C(tblNameRoutes).Find(nil).All(&routes); err != nil {
+		logger.Errorf("error loading proxy routes: %s", err)
+		return
+	}
+	m.proxy.Update(routes, containers)
+}
+
+// servicesChanged refreshes the service registry in the background after
+// containers were started or stopped
+func (m *Manager) servicesChanged() {
+	go m.RefreshServices()
+}
+
+// ScheduleServiceRefresh refreshes the service registry and proxy backends
+// every interval to follow containers changed outside of the controller
+func (m *Manager) ScheduleServiceRefresh(interval time.Duration) {
+	m.RefreshServices()
+	go func() {
+		for range time.Tick(interval) {
+			m.RefreshServices()
+		}
+	}()
+}
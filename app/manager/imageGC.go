@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+// CollectImages runs an image garbage collection across the cluster and
+// keeps the per engine reports
+func (m *Manager) CollectImages(opts *cluster.ImageGCOptions) ([]*cluster.ImageGCReport, error) {
+	reports := m.clusterManager.CollectImages(opts)
+	for _, r := range reports {
+		if err := m.mgoDB.C(tblNameImageGC).Insert(r); err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+// ImageGCReports returns the most recent image garbage collection reports
+func (m *Manager) ImageGCReports(limit int) ([]*cluster.ImageGCReport, error) {
+	reports := []*cluster.ImageGCReport{}
+	if err := m.mgoDB.C(tblNameImageGC).Find(nil).Sort("-time").Limit(limit).All(&reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// ScheduleImageGC runs an image garbage collection every interval
+func (m *Manager) ScheduleImageGC(interval time.Duration, opts *cluster.ImageGCOptions) {
+	logger.Infof("scheduling image garbage collection every %s", interval)
+	go func() {
+		for range time.Tick(interval) {
+			reports, err := m.CollectImages(opts)
+			if err != nil {
+				logger.Errorf("error saving image gc reports: %s", err)
+				continue
+			}
+			for _, r := range reports {
+				logger.Infof("image gc on %s: removed %d images, reclaimed %d bytes, %d errors",
+					r.Engine, len(r.Removed), r.Reclaimed, len(r.Errors))
+			}
+		}
+	}()
+}
@@ -2,20 +2,37 @@ package manager
 
 import (
 	"crypto/tls"
+	"io"
 	"strings"
 	"sync"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/sessions"
+	"github.com/samalba/dockerclient"
 	"github.com/yleemj/dockerMan"
 	"github.com/yleemj/dockerMan/app/cluster"
+	"github.com/yleemj/dockerMan/app/discovery"
+	"github.com/yleemj/dockerMan/app/proxy"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 const (
-	tblNameConfig = "config"
-	storeKey      = "dockerMan"
+	tblNameConfig       = "config"
+	tblNameAudit        = "audit"
+	tblNameImageGC      = "image_gc"
+	tblNameRegistries   = "registries"
+	tblNameTemplates    = "templates"
+	tblNameApplications = "applications"
+	tblNameSecrets      = "secrets"
+	tblNameRoutes       = "routes"
+	tblNameBackups      = "backups"
+	tblNameAccounts     = "accounts"
+	tblNameTokens       = "tokens"
+	tblNameRoles        = "roles"
+	tblNameTeams        = "teams"
+	tblNameTeamNames    = "team_names"
+	storeKey            = "dockerMan"
 	// trackerHost        = "http://tracker.shipyard-project.com"
 	EngineHealthUp   = "up"
 	EngineHealthDown = "down"
@@ -37,22 +54,38 @@ type (
 		engines          []*dockerMan.Engine
 		store            *sessions.CookieStore
 		StoreKey         string
+		authKey          string
 		version          string
 		disableUsageInfo bool
+
+		registryAuthMux sync.RWMutex
+		registryAuth    map[string]*dockerclient.AuthConfig
+
+		// manifestMux serializes manifest applies
+		manifestMux sync.Mutex
+
+		// services are the published endpoints of the running containers
+		services *discovery.Registry
+
+		// proxy routes requests to the containers of the stored routes
+		proxy *proxy.Proxy
+
+		// backupDir is where volume backups are written; empty disables
+		// backups
+		backupDir string
 	}
 )
 
-func NewManager(addr string, database string, version string, disableUsageInfo bool) (*Manager, error) {
+func NewManager(addr string, database string, authKey string, version string, disableUsageInfo bool) (*Manager, error) {
 	session, err := mgo.Dial(addr)
 	if err != nil {
 		panic(err)
 	}
-	defer session.Close()
 
 	db := session.DB(database)
 
 	logger.Info("checking database")
-	logger.Info("database: %s", db)
+	logger.Infof("database: %s", db.Name)
 
 	//r.DbCreate(database).Run(session)
 
@@ -63,8 +96,11 @@ func NewManager(addr string, database string, version string, disableUsageInfo b
 		mgoDB:            db,
 		store:            store,
 		StoreKey:         storeKey,
+		authKey:          authKey,
 		version:          version,
 		disableUsageInfo: disableUsageInfo,
+		services:         discovery.NewRegistry(),
+		proxy:            proxy.New(),
 	}
 	m.init()
 	return m, nil
@@ -85,10 +121,14 @@ func (m *Manager) init() []*dockerMan.Engine {
 		logger.Fatalf("error getting configuration: %s", err)
 	}
 
-	logger.Infof("engines: %s", engines)
+	logger.Infof("engines: %v", engines)
 
 	m.engines = engines
 
+	if err := m.mgoDB.C(tblNameAudit).EnsureIndexKey("-time"); err != nil {
+		logger.Warnf("error creating audit index: %s", err)
+	}
+
 	var engs []*cluster.Engine
 	for _, d := range engines {
 		stat, err := d.Ping()
@@ -113,6 +153,21 @@ func (m *Manager) init() []*dockerMan.Engine {
 
 	m.clusterManager = clusterManager
 
+	if err := m.mgoDB.C(tblNameTemplates).EnsureIndex(mgo.Index{Key: []string{"name", "-version"}, Unique: true}); err != nil {
+		logger.Warnf("error creating template index: %s", err)
+	}
+	if err := m.mgoDB.C(tblNameRegistries).EnsureIndex(mgo.Index{Key: []string{"host"}, Unique: true}); err != nil {
+		logger.Warnf("error creating registry index: %s", err)
+	}
+	if err := m.loadRegistryAuth(); err != nil {
+		logger.Errorf("error loading registry credentials: %s", err)
+	}
+	if err := m.migrateAccountRoles(); err != nil {
+		logger.Errorf("error assigning roles to accounts: %s", err)
+	}
+	clusterManager.SetAuthResolver(m.registryAuthFor)
+	clusterManager.SetSecretResolver(m.resolveSecret)
+
 	return engines
 }
 
@@ -170,12 +225,38 @@ func (m *Manager) IdenticalContainers(container *cluster.Container, all bool) ([
 	return containers, nil
 }
 
+func (m *Manager) Images() []*cluster.ClusterImage {
+	return m.clusterManager.Images()
+}
+
+func (m *Manager) PullImage(image string, labels []string) (<-chan *cluster.PullStatus, error) {
+	return m.clusterManager.Pull(image, labels)
+}
+
+// BuildImage runs the build with the credentials of every registry
+func (m *Manager) BuildImage(opts *cluster.BuildOptions) (*cluster.Engine, io.ReadCloser, error) {
+	m.registryAuthMux.RLock()
+	opts.RegistryAuth = make(map[string]*dockerclient.AuthConfig, len(m.registryAuth))
+	for host, auth := range m.registryAuth {
+		opts.RegistryAuth[host] = auth
+	}
+	m.registryAuthMux.RUnlock()
+
+	return m.clusterManager.Build(opts)
+}
+
+func (m *Manager) PushImage(engine *cluster.Engine, image string) error {
+	return engine.Push(image)
+}
+
 func (m *Manager) ClusterInfo() *cluster.ClusterInfo {
 	info := m.clusterManager.ClusterInfo()
 	return info
 }
 
 func (m *Manager) Destroy(container *cluster.Container) error {
+	defer m.servicesChanged()
+
 	if err := m.clusterManager.Kill(container, 9); err != nil {
 		return err
 	}
@@ -185,22 +266,70 @@ func (m *Manager) Destroy(container *cluster.Container) error {
 	return nil
 }
 
-func (m *Manager) Run(image *cluster.Image, count int, pull bool) ([]*cluster.Container, error) {
+// Stop stops the container
+func (m *Manager) Stop(container *cluster.Container) error {
+	defer m.servicesChanged()
+
+	return m.clusterManager.Stop(container)
+}
+
+// Restart restarts the container, killing it after timeout seconds
+func (m *Manager) Restart(container *cluster.Container, timeout int) error {
+	defer m.servicesChanged()
+
+	return m.clusterManager.Restart(container, timeout)
+}
+
+// ExportContainer returns a definition that runs a copy of the container
+func (m *Manager) ExportContainer(container *cluster.Container) (*cluster.Image, error) {
+	return container.Engine.Export(container)
+}
+
+// Run launches count containers of the image. With resolveDigest the image
+// tag is resolved to a digest once so every replica runs the same build.
+func (m *Manager) Run(image *cluster.Image, count int, resolveDigest bool) ([]*cluster.Container, error) {
 	launched := []*cluster.Container{}
 
 	logger.Infof("Run Image: %s, count: %d", image.Name, count)
+	defer m.servicesChanged()
 
-	var wg sync.WaitGroup
+	if err := cluster.ValidatePullPolicy(image.PullPolicy); err != nil {
+		return nil, err
+	}
+	if err := cluster.ValidateDockerLabels(image.DockerLabels); err != nil {
+		return nil, err
+	}
+	if err := m.applyTeam(image); err != nil {
+		return nil, err
+	}
+
+	digest := ""
+	if resolveDigest {
+		d, err := m.clusterManager.ResolveDigest(image.Name)
+		if err != nil {
+			return nil, err
+		}
+		digest = d
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mux    sync.Mutex
+		runErr error
+	)
 	wg.Add(count)
-	var runErr error
 	for i := 0; i < count; i++ {
 		go func(wg *sync.WaitGroup) {
-			container, err := m.clusterManager.Start(image, pull)
+			defer wg.Done()
+			container, err := m.clusterManager.Start(image, digest)
+
+			mux.Lock()
+			defer mux.Unlock()
 			if err != nil {
 				runErr = err
+				return
 			}
 			launched = append(launched, container)
-			wg.Done()
 		}(&wg)
 	}
 	wg.Wait()
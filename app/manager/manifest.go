@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+	"github.com/yleemj/dockerMan/app/manifest"
+)
+
+// PlanManifest returns the changes that bring the containers of the team to
+// the manifest; a manifest only manages the containers of one team
+func (m *Manager) PlanManifest(mf *manifest.Manifest, prune bool, team string) *manifest.Plan {
+	containers := []*cluster.Container{}
+	for _, c := range m.Containers(true) {
+		if c.Image != nil && c.Image.Team == team {
+			containers = append(containers, c)
+		}
+	}
+	return manifest.Diff(mf, containers, prune)
+}
+
+// ApplyManifest plans and applies the manifest to the containers of the
+// team. Changed containers are replaced by starting the new container
+// before removing the old one. Applying stops at the first failed change;
+// the returned plan records the containers started and the error of the
+// failed change.
+func (m *Manager) ApplyManifest(mf *manifest.Manifest, prune bool, team string) (*manifest.Plan, []*cluster.Container, error) {
+	m.manifestMux.Lock()
+	defer m.manifestMux.Unlock()
+	defer m.servicesChanged()
+
+	var (
+		plan    = m.PlanManifest(mf, prune, team)
+		started = []*cluster.Container{}
+	)
+
+	for _, change := range plan.Changes {
+		if change.Action == manifest.ActionAdd || change.Action == manifest.ActionChange {
+			change.Image.Team = team
+			if err := m.applyTeam(change.Image); err != nil {
+				change.Error = err.Error()
+				return plan, started, fmt.Errorf("error starting %s: %s", change.Service, err)
+			}
+
+			// a replacement with a container name can only start once
+			// the container it replaces gave up the name
+			aside, err := m.renameAside(change)
+			if err != nil {
+				change.Error = err.Error()
+				return plan, started, fmt.Errorf("error renaming %s: %s", change.Container, err)
+			}
+
+			c, err := m.clusterManager.Start(change.Image, "")
+			if err != nil {
+				if aside != nil {
+					if rerr := m.clusterManager.Rename(aside, change.Image.ContainerName); rerr != nil {
+						logger.Errorf("manifest: unable to rename %s back: %s", aside.ID, rerr)
+					}
+				}
+				change.Error = err.Error()
+				return plan, started, fmt.Errorf("error starting %s: %s", change.Service, err)
+			}
+			change.Started = c.ID
+			started = append(started, c)
+
+			logger.Infof("manifest: started %s for %s on %s", c.ID, change.Service, c.Engine.ID)
+		}
+
+		if change.Action == manifest.ActionChange || change.Action == manifest.ActionRemove {
+			if err := m.removeContainer(change.Container); err != nil {
+				change.Error = err.Error()
+				return plan, started, fmt.Errorf("error removing %s: %s", change.Container, err)
+			}
+
+			logger.Infof("manifest: removed %s (%s)", change.Container, change.Reason)
+		}
+	}
+
+	return plan, started, nil
+}
+
+// renameAside renames the container a change replaces if the replacement
+// starts under its name; it returns the renamed container
+func (m *Manager) renameAside(change *manifest.Change) (*cluster.Container, error) {
+	if change.Action != manifest.ActionChange || change.Image.ContainerName == "" {
+		return nil, nil
+	}
+	c, err := m.Container(change.Container)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	if strings.TrimPrefix(c.Name, "/") != change.Image.ContainerName {
+		return nil, nil
+	}
+
+	if err := m.clusterManager.Rename(c, change.Image.ContainerName+"-replaced"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// removeContainer destroys the container unless it is already gone
+func (m *Manager) removeContainer(id string) error {
+	c, err := m.Container(id)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return nil
+	}
+
+	// stopped containers cannot be killed
+	if c.State != "running" {
+		return m.clusterManager.Remove(c)
+	}
+	return m.Destroy(c)
+}
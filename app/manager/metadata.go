@@ -0,0 +1,78 @@
+package manager
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MetadataMigration is the result of migrating the metadata of a container
+type MetadataMigration struct {
+	Container string `json:"container"`
+	Name      string `json:"name,omitempty"`
+	Engine    string `json:"engine"`
+
+	// Migrated is the id of the container that replaced it
+	Migrated string `json:"migrated,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// MigrateMetadata recreates the containers whose metadata is stored in env
+// vars so it is stored in docker labels, and points the application records
+// at the new containers. With dryRun the containers are only listed.
+func (m *Manager) MigrateMetadata(dryRun bool) ([]*MetadataMigration, error) {
+	migrations := []*MetadataMigration{}
+	if !dryRun {
+		defer m.servicesChanged()
+	}
+
+	for _, c := range m.Containers(true) {
+		if !c.LegacyMetadata {
+			continue
+		}
+
+		migration := &MetadataMigration{
+			Container: c.ID,
+			Name:      c.Name,
+			Engine:    c.Engine.ID,
+		}
+		migrations = append(migrations, migration)
+
+		if dryRun {
+			continue
+		}
+
+		migrated, err := c.Engine.MigrateMetadata(c)
+		if migrated != nil {
+			migration.Migrated = migrated.ID
+		}
+		if err != nil {
+			logger.Errorf("error migrating metadata of %s: %s", c.ID, err)
+			migration.Error = err.Error()
+			if migrated == nil {
+				continue
+			}
+		}
+
+		logger.Infof("migrated metadata of %s to %s", c.ID, migrated.ID)
+
+		if err := m.replaceApplicationContainer(c.ID, migrated.ID); err != nil {
+			return migrations, err
+		}
+	}
+
+	return migrations, nil
+}
+
+// replaceApplicationContainer points the application services run by the
+// old container at the new one
+func (m *Manager) replaceApplicationContainer(old, new string) error {
+	_, err := m.mgoDB.C(tblNameApplications).UpdateAll(
+		bson.M{"services.container": old},
+		bson.M{"$set": bson.M{"services.$.container": new}},
+	)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
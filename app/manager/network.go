@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+// Networks returns the networks of every engine
+func (m *Manager) Networks() []*cluster.Network {
+	return m.clusterManager.Networks()
+}
+
+// CreateNetwork creates the network on the engines selected by the config
+// in the engine pool of the team; the team owns the network name
+func (m *Manager) CreateNetwork(config *cluster.NetworkConfig, team string) ([]*cluster.Network, error) {
+	labels, err := m.teamLabels(team)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		if !hasLabel(config.Labels, l) {
+			config.Labels = append(config.Labels, l)
+		}
+	}
+
+	owner, err := m.nameTeam(teamNameNetwork, config.Name)
+	if err != nil {
+		return nil, err
+	}
+	if owner != "" && owner != team {
+		return nil, ErrTeamNameTaken
+	}
+
+	created, err := m.clusterManager.CreateNetwork(config)
+	if len(created) > 0 {
+		if cerr := m.claimName(teamNameNetwork, config.Name, team); cerr != nil {
+			return created, cerr
+		}
+	}
+	return created, err
+}
+
+// RemoveNetwork removes the network from the engine, or from every engine
+// when engineID is empty; the name loses its owner once no engine holds it
+func (m *Manager) RemoveNetwork(name, engineID string) ([]*cluster.Network, error) {
+	removed, err := m.clusterManager.RemoveNetwork(name, engineID)
+	if err != nil {
+		return removed, err
+	}
+	for _, n := range m.Networks() {
+		if n.Name == removed[0].Name {
+			return removed, nil
+		}
+	}
+	return removed, m.releaseName(teamNameNetwork, removed[0].Name)
+}
+
+// ConnectNetwork attaches the container to a network on its engine; only
+// the networks of the team of the container and the builtin ones
+func (m *Manager) ConnectNetwork(container *cluster.Container, network string, aliases []string) error {
+	if !cluster.IsBuiltinNetwork(network) {
+		if err := m.checkNameTeam(teamNameNetwork, network, container.Image.Team); err != nil {
+			return err
+		}
+	}
+	return container.Engine.ConnectNetwork(container, network, aliases)
+}
+
+// DisconnectNetwork detaches the container from a network on its engine
+func (m *Manager) DisconnectNetwork(container *cluster.Container, network string) error {
+	return container.Engine.DisconnectNetwork(container, network)
+}
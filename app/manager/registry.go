@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"errors"
+
+	"github.com/samalba/dockerclient"
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/cluster"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrRegistryDoesNotExist = errors.New("registry does not exist")
+	ErrRegistryExists       = errors.New("registry already exists")
+)
+
+func (m *Manager) Registries() ([]*dockerMan.Registry, error) {
+	registries := []*dockerMan.Registry{}
+	if err := m.mgoDB.C(tblNameRegistries).Find(nil).Sort("host").All(&registries); err != nil {
+		return nil, err
+	}
+	return registries, nil
+}
+
+func (m *Manager) Registry(id string) (*dockerMan.Registry, error) {
+	var registry *dockerMan.Registry
+	if err := m.mgoDB.C(tblNameRegistries).FindId(id).One(&registry); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrRegistryDoesNotExist
+		}
+		return nil, err
+	}
+	return registry, nil
+}
+
+// SaveRegistry creates or updates registry credentials; an empty password or
+// token on update keeps the stored one
+func (m *Manager) SaveRegistry(registry *dockerMan.Registry) error {
+	registry.Host = cluster.NormalizeRegistry(registry.Host)
+
+	var existing *dockerMan.Registry
+	err := m.mgoDB.C(tblNameRegistries).Find(bson.M{"host": registry.Host}).One(&existing)
+	switch {
+	case err == mgo.ErrNotFound:
+	case err != nil:
+		return err
+	case registry.ID == "" || existing.ID != registry.ID:
+		return ErrRegistryExists
+	}
+
+	if registry.ID == "" {
+		registry.ID = generateId(16)
+	} else {
+		current, err := m.Registry(registry.ID)
+		if err != nil {
+			return err
+		}
+		registry.EncryptedPassword = current.EncryptedPassword
+		registry.EncryptedToken = current.EncryptedToken
+	}
+
+	if registry.Password != "" {
+		if registry.EncryptedPassword, err = m.encrypt(registry.Password); err != nil {
+			return err
+		}
+	}
+	if registry.Token != "" {
+		if registry.EncryptedToken, err = m.encrypt(registry.Token); err != nil {
+			return err
+		}
+	}
+	registry.Password = ""
+	registry.Token = ""
+
+	if _, err := m.mgoDB.C(tblNameRegistries).UpsertId(registry.ID, registry); err != nil {
+		return err
+	}
+
+	return m.loadRegistryAuth()
+}
+
+func (m *Manager) DeleteRegistry(id string) error {
+	if err := m.mgoDB.C(tblNameRegistries).RemoveId(id); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrRegistryDoesNotExist
+		}
+		return err
+	}
+
+	return m.loadRegistryAuth()
+}
+
+// loadRegistryAuth decrypts the stored registry credentials into the cache
+// used by the engines when pulling
+func (m *Manager) loadRegistryAuth() error {
+	registries, err := m.Registries()
+	if err != nil {
+		return err
+	}
+
+	auth := make(map[string]*dockerclient.AuthConfig)
+	for _, r := range registries {
+		password, err := m.decrypt(r.EncryptedPassword)
+		if err != nil {
+			logger.Errorf("unable to decrypt password for registry %s: %s", r.Host, err)
+			continue
+		}
+		token, err := m.decrypt(r.EncryptedToken)
+		if err != nil {
+			logger.Errorf("unable to decrypt token for registry %s: %s", r.Host, err)
+			continue
+		}
+		auth[r.Host] = &dockerclient.AuthConfig{
+			Username:      r.Username,
+			Password:      password,
+			Email:         r.Email,
+			RegistryToken: token,
+		}
+	}
+
+	m.registryAuthMux.Lock()
+	m.registryAuth = auth
+	m.registryAuthMux.Unlock()
+
+	return nil
+}
+
+// registryAuthFor returns the credentials for the registry host, if any
+func (m *Manager) registryAuthFor(registry string) *dockerclient.AuthConfig {
+	m.registryAuthMux.RLock()
+	defer m.registryAuthMux.RUnlock()
+
+	return m.registryAuth[cluster.NormalizeRegistry(registry)]
+}
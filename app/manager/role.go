@@ -0,0 +1,278 @@
+package manager
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/yleemj/dockerMan"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	PermContainersView     = "containers:view"
+	PermContainersManage   = "containers:manage"
+	PermContainersAllTeams = "containers:all-teams"
+	PermEnginesView        = "engines:view"
+	PermImagesView         = "images:view"
+	PermImagesManage       = "images:manage"
+	PermNetworksView       = "networks:view"
+	PermNetworksManage     = "networks:manage"
+	PermVolumesView        = "volumes:view"
+	PermVolumesManage      = "volumes:manage"
+	PermBackupsView        = "backups:view"
+	PermBackupsManage      = "backups:manage"
+	PermServicesView       = "services:view"
+	PermTemplatesView      = "templates:view"
+	PermTemplatesManage    = "templates:manage"
+	PermApplicationsView   = "applications:view"
+	PermApplicationsManage = "applications:manage"
+	PermRegistriesView     = "registries:view"
+	PermRegistriesManage   = "registries:manage"
+	PermSecretsView        = "secrets:view"
+	PermSecretsManage      = "secrets:manage"
+	PermRoutesView         = "routes:view"
+	PermRoutesManage       = "routes:manage"
+	PermAuditView          = "audit:view"
+	PermAccountsView       = "accounts:view"
+	PermAccountsManage     = "accounts:manage"
+
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleReadOnly = "read-only"
+)
+
+var (
+	ErrRoleDoesNotExist      = errors.New("role does not exist")
+	ErrRoleExists            = errors.New("role already exists")
+	ErrRoleBuiltin           = errors.New("builtin roles cannot be changed")
+	ErrRoleInUse             = errors.New("role is assigned to accounts")
+	ErrRoleInvalidName       = errors.New("role names may only contain letters, digits, '_', '.' and '-'")
+	ErrRoleInvalidPermission = errors.New("role grants a permission that does not exist")
+
+	// Permissions are every permission a role can grant
+	Permissions = []string{
+		PermContainersView, PermContainersManage, PermContainersAllTeams,
+		PermEnginesView,
+		PermImagesView, PermImagesManage,
+		PermNetworksView, PermNetworksManage,
+		PermVolumesView, PermVolumesManage,
+		PermBackupsView, PermBackupsManage,
+		PermServicesView,
+		PermTemplatesView, PermTemplatesManage,
+		PermApplicationsView, PermApplicationsManage,
+		PermRegistriesView, PermRegistriesManage,
+		PermSecretsView, PermSecretsManage,
+		PermRoutesView, PermRoutesManage,
+		PermAuditView,
+		PermAccountsView, PermAccountsManage,
+	}
+
+	builtinRoles = map[string]*dockerMan.Role{
+		RoleAdmin: {
+			Name:        RoleAdmin,
+			Description: "every permission",
+			Permissions: Permissions,
+			Builtin:     true,
+		},
+		RoleOperator: {
+			Name:        RoleOperator,
+			Description: "view and run workloads; no registry or account management",
+			Permissions: []string{
+				PermContainersView, PermContainersManage,
+				PermEnginesView,
+				PermImagesView, PermImagesManage,
+				PermNetworksView, PermNetworksManage,
+				PermVolumesView, PermVolumesManage,
+				PermBackupsView, PermBackupsManage,
+				PermServicesView,
+				PermTemplatesView, PermTemplatesManage,
+				PermApplicationsView, PermApplicationsManage,
+				PermRegistriesView,
+				PermSecretsView, PermSecretsManage,
+				PermRoutesView, PermRoutesManage,
+				PermAuditView,
+			},
+			Builtin: true,
+		},
+		RoleReadOnly: {
+			Name:        RoleReadOnly,
+			Description: "view everything but accounts",
+			Permissions: []string{
+				PermContainersView,
+				PermEnginesView,
+				PermImagesView,
+				PermNetworksView,
+				PermVolumesView,
+				PermBackupsView,
+				PermServicesView,
+				PermTemplatesView,
+				PermApplicationsView,
+				PermRegistriesView,
+				PermSecretsView,
+				PermRoutesView,
+				PermAuditView,
+			},
+			Builtin: true,
+		},
+	}
+)
+
+// Roles returns the builtin and custom roles
+func (m *Manager) Roles() ([]*dockerMan.Role, error) {
+	roles := []*dockerMan.Role{}
+	if err := m.mgoDB.C(tblNameRoles).Find(nil).All(&roles); err != nil {
+		return nil, err
+	}
+	for _, r := range builtinRoles {
+		roles = append(roles, r)
+	}
+	sort.Sort(rolesByName(roles))
+	return roles, nil
+}
+
+func (m *Manager) Role(name string) (*dockerMan.Role, error) {
+	if r, ok := builtinRoles[name]; ok {
+		return r, nil
+	}
+
+	var role *dockerMan.Role
+	if err := m.mgoDB.C(tblNameRoles).FindId(name).One(&role); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrRoleDoesNotExist
+		}
+		return nil, err
+	}
+	return role, nil
+}
+
+// CreateRole stores a custom role
+func (m *Manager) CreateRole(role *dockerMan.Role) error {
+	if _, err := m.Role(role.Name); err != ErrRoleDoesNotExist {
+		if err == nil {
+			return ErrRoleExists
+		}
+		return err
+	}
+	return m.saveRole(role)
+}
+
+// UpdateRole replaces the permissions of a custom role
+func (m *Manager) UpdateRole(role *dockerMan.Role) error {
+	current, err := m.Role(role.Name)
+	if err != nil {
+		return err
+	}
+	if current.Builtin {
+		return ErrRoleBuiltin
+	}
+	return m.saveRole(role)
+}
+
+func (m *Manager) saveRole(role *dockerMan.Role) error {
+	if !validUsername.MatchString(role.Name) {
+		return ErrRoleInvalidName
+	}
+	for _, p := range role.Permissions {
+		if !validPermission(p) {
+			logger.Warnf("role %s grants unknown permission %s", role.Name, p)
+			return ErrRoleInvalidPermission
+		}
+	}
+	role.Builtin = false
+
+	_, err := m.mgoDB.C(tblNameRoles).UpsertId(role.Name, role)
+	return err
+}
+
+// DeleteRole removes a custom role that no account has
+func (m *Manager) DeleteRole(name string) error {
+	role, err := m.Role(name)
+	if err != nil {
+		return err
+	}
+	if role.Builtin {
+		return ErrRoleBuiltin
+	}
+
+	n, err := m.mgoDB.C(tblNameAccounts).Find(bson.M{"role": name}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrRoleInUse
+	}
+	return m.mgoDB.C(tblNameRoles).RemoveId(name)
+}
+
+// SetAccountRole assigns the role to the account
+func (m *Manager) SetAccountRole(username, role string) error {
+	if _, err := m.Role(role); err != nil {
+		return err
+	}
+	if err := m.mgoDB.C(tblNameAccounts).UpdateId(username, bson.M{"$set": bson.M{"role": role}}); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrAccountDoesNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+// Permitted returns true if the role of the account grants the permission
+func (m *Manager) Permitted(username, permission string) (bool, error) {
+	account, err := m.Account(username)
+	if err != nil {
+		return false, err
+	}
+	if account.Role == "" {
+		return false, nil
+	}
+
+	role, err := m.Role(account.Role)
+	if err != nil {
+		if err == ErrRoleDoesNotExist {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, p := range role.Permissions {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// migrateAccountRoles makes the accounts created before roles existed
+// admins so they keep the access they had
+func (m *Manager) migrateAccountRoles() error {
+	_, err := m.mgoDB.C(tblNameAccounts).UpdateAll(
+		bson.M{"role": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"role": RoleAdmin}},
+	)
+	return err
+}
+
+func validPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type rolesByName []*dockerMan.Role
+
+func (r rolesByName) Len() int {
+	return len(r)
+}
+
+func (r rolesByName) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+
+func (r rolesByName) Less(i, j int) bool {
+	return r[i].Name < r[j].Name
+}
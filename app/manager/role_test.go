@@ -0,0 +1,38 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/yleemj/dockerMan"
+)
+
+func hasPermission(role *dockerMan.Role, permission string) bool {
+	for _, p := range role.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBuiltinRoles(t *testing.T) {
+	for _, p := range Permissions {
+		if !hasPermission(builtinRoles[RoleAdmin], p) {
+			t.Errorf("expected admins to be granted %s", p)
+		}
+	}
+
+	// migrating metadata and applying manifests recreate the containers of
+	// every team, so only admins may
+	for _, p := range []string{PermContainersAllTeams, PermAccountsManage, PermRegistriesManage} {
+		if hasPermission(builtinRoles[RoleOperator], p) {
+			t.Errorf("expected operators not to be granted %s", p)
+		}
+	}
+
+	for _, p := range builtinRoles[RoleReadOnly].Permissions {
+		if p == PermContainersManage || p == PermImagesManage || p == PermAccountsView {
+			t.Errorf("expected read-only accounts not to be granted %s", p)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/proxy"
+	"gopkg.in/mgo.v2"
+)
+
+var (
+	ErrRouteDoesNotExist = errors.New("route does not exist")
+	ErrRouteExists       = errors.New("route already exists")
+	ErrRouteInvalid      = errors.New("route requires a valid name, an image or service and a path starting with /")
+	ErrRouteConflict     = errors.New("route overlaps the host and path of a route of another team")
+
+	validRouteName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// Proxy returns the handler routing requests to the containers of the routes
+func (m *Manager) Proxy() *proxy.Proxy {
+	return m.proxy
+}
+
+// Routes returns the proxy routes with their current backends
+func (m *Manager) Routes() ([]*dockerMan.Route, error) {
+	routes := []*dockerMan.Route{}
+	if err := m.mgoDB.C(tblNameRoutes).Find(nil).Sort("_id").All(&routes); err != nil {
+		return nil, err
+	}
+	for _, r := range routes {
+		r.Backends = m.proxy.Backends(r.Name)
+	}
+	return routes, nil
+}
+
+func (m *Manager) Route(name string) (*dockerMan.Route, error) {
+	var route *dockerMan.Route
+	if err := m.mgoDB.C(tblNameRoutes).FindId(name).One(&route); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrRouteDoesNotExist
+		}
+		return nil, err
+	}
+	route.Backends = m.proxy.Backends(route.Name)
+	return route, nil
+}
+
+func (m *Manager) CreateRoute(route *dockerMan.Route) error {
+	if _, err := m.Route(route.Name); err != ErrRouteDoesNotExist {
+		if err == nil {
+			return ErrRouteExists
+		}
+		return err
+	}
+	return m.saveRoute(route)
+}
+
+func (m *Manager) UpdateRoute(route *dockerMan.Route) error {
+	if _, err := m.Route(route.Name); err != nil {
+		return err
+	}
+	return m.saveRoute(route)
+}
+
+func (m *Manager) saveRoute(route *dockerMan.Route) error {
+	if !validRouteName.MatchString(route.Name) || (route.Image == "" && route.Service == "") || route.Port < 0 {
+		return ErrRouteInvalid
+	}
+	if route.Path != "" && !strings.HasPrefix(route.Path, "/") {
+		return ErrRouteInvalid
+	}
+	route.Host = strings.ToLower(route.Host)
+	route.Backends = nil
+
+	// the most specific route wins, so a team could take over part of the
+	// requests of another team's route
+	routes, err := m.Routes()
+	if err != nil {
+		return err
+	}
+	for _, r := range routes {
+		if r.Name != route.Name && r.Team != route.Team && proxy.Overlaps(r, route) {
+			return ErrRouteConflict
+		}
+	}
+	route.Updated = time.Now()
+
+	if _, err := m.mgoDB.C(tblNameRoutes).UpsertId(route.Name, route); err != nil {
+		return err
+	}
+	m.servicesChanged()
+	return nil
+}
+
+func (m *Manager) DeleteRoute(name string) error {
+	if err := m.mgoDB.C(tblNameRoutes).RemoveId(name); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrRouteDoesNotExist
+		}
+		return err
+	}
+	m.servicesChanged()
+	return nil
+}
@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/yleemj/dockerMan"
+	"gopkg.in/mgo.v2"
+)
+
+var (
+	ErrSecretDoesNotExist = errors.New("secret does not exist")
+	ErrSecretExists       = errors.New("secret already exists")
+	ErrSecretInvalidName  = errors.New("secret names may only contain letters, digits, '_', '.' and '-'")
+	ErrSecretValueEmpty   = errors.New("secret value is required")
+
+	validSecretName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// Secrets returns the stored secrets without their values
+func (m *Manager) Secrets() ([]*dockerMan.Secret, error) {
+	secrets := []*dockerMan.Secret{}
+	if err := m.mgoDB.C(tblNameSecrets).Find(nil).Sort("_id").All(&secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (m *Manager) Secret(name string) (*dockerMan.Secret, error) {
+	var secret *dockerMan.Secret
+	if err := m.mgoDB.C(tblNameSecrets).FindId(name).One(&secret); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrSecretDoesNotExist
+		}
+		return nil, err
+	}
+	return secret, nil
+}
+
+// CreateSecret stores a new secret with its value encrypted
+func (m *Manager) CreateSecret(secret *dockerMan.Secret) error {
+	if !validSecretName.MatchString(secret.Name) {
+		return ErrSecretInvalidName
+	}
+	if secret.Value == "" {
+		return ErrSecretValueEmpty
+	}
+
+	if _, err := m.Secret(secret.Name); err != ErrSecretDoesNotExist {
+		if err == nil {
+			return ErrSecretExists
+		}
+		return err
+	}
+
+	return m.saveSecret(secret)
+}
+
+// UpdateSecret replaces the description and value of a secret; an empty
+// value keeps the stored one. Running containers keep the value they were
+// started with.
+func (m *Manager) UpdateSecret(secret *dockerMan.Secret) error {
+	current, err := m.Secret(secret.Name)
+	if err != nil {
+		return err
+	}
+	secret.EncryptedValue = current.EncryptedValue
+	secret.Team = current.Team
+
+	return m.saveSecret(secret)
+}
+
+func (m *Manager) saveSecret(secret *dockerMan.Secret) error {
+	if secret.Value != "" {
+		encrypted, err := m.encrypt(secret.Value)
+		if err != nil {
+			return err
+		}
+		secret.EncryptedValue = encrypted
+	}
+	secret.Value = ""
+	secret.Updated = time.Now()
+
+	_, err := m.mgoDB.C(tblNameSecrets).UpsertId(secret.Name, secret)
+	return err
+}
+
+func (m *Manager) DeleteSecret(name string) error {
+	if err := m.mgoDB.C(tblNameSecrets).RemoveId(name); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrSecretDoesNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+// TeamSecrets returns the secrets of one of the teams
+func TeamSecrets(secrets []*dockerMan.Secret, teams []string) []*dockerMan.Secret {
+	out := []*dockerMan.Secret{}
+	for _, s := range secrets {
+		if InTeams(s.Team, teams) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// resolveSecret returns the decrypted value of a secret of the team; the
+// engines call it when starting containers that reference secrets
+func (m *Manager) resolveSecret(name, team string) (string, error) {
+	secret, err := m.Secret(name)
+	if err != nil {
+		return "", err
+	}
+	if secret.Team != team {
+		return "", ErrNotTeamResource
+	}
+	return m.decrypt(secret.EncryptedValue)
+}
@@ -0,0 +1,374 @@
+package manager
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/cluster"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrTeamDoesNotExist = errors.New("team does not exist")
+	ErrTeamExists       = errors.New("team already exists")
+	ErrTeamInvalidName  = errors.New("team names may only contain letters, digits, '_', '.' and '-'")
+	ErrNotTeamResource  = errors.New("the secret, volume or network belongs to another team")
+	ErrTeamNameTaken    = errors.New("the name is used by another team")
+)
+
+const (
+	teamNameVolume  = "volume"
+	teamNameNetwork = "network"
+)
+
+// teamName records the team owning the volumes or networks with a name;
+// docker keeps no owner for them
+type teamName struct {
+	ID   string `bson:"_id"`
+	Kind string `bson:"kind"`
+	Name string `bson:"name"`
+	Team string `bson:"team"`
+}
+
+func (m *Manager) Teams() ([]*dockerMan.Team, error) {
+	teams := []*dockerMan.Team{}
+	if err := m.mgoDB.C(tblNameTeams).Find(nil).Sort("_id").All(&teams); err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+func (m *Manager) Team(name string) (*dockerMan.Team, error) {
+	var team *dockerMan.Team
+	if err := m.mgoDB.C(tblNameTeams).FindId(name).One(&team); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrTeamDoesNotExist
+		}
+		return nil, err
+	}
+	return team, nil
+}
+
+func (m *Manager) CreateTeam(team *dockerMan.Team) error {
+	if _, err := m.Team(team.Name); err != ErrTeamDoesNotExist {
+		if err == nil {
+			return ErrTeamExists
+		}
+		return err
+	}
+	return m.saveTeam(team)
+}
+
+// UpdateTeam replaces the description and engine labels of a team; running
+// containers stay on their engines
+func (m *Manager) UpdateTeam(team *dockerMan.Team) error {
+	if _, err := m.Team(team.Name); err != nil {
+		return err
+	}
+	return m.saveTeam(team)
+}
+
+func (m *Manager) saveTeam(team *dockerMan.Team) error {
+	if !validUsername.MatchString(team.Name) {
+		return ErrTeamInvalidName
+	}
+	_, err := m.mgoDB.C(tblNameTeams).UpsertId(team.Name, team)
+	return err
+}
+
+// DeleteTeam removes the team and its members; its containers are only
+// visible to accounts seeing every team afterwards
+func (m *Manager) DeleteTeam(name string) error {
+	if err := m.mgoDB.C(tblNameTeams).RemoveId(name); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrTeamDoesNotExist
+		}
+		return err
+	}
+	_, err := m.mgoDB.C(tblNameAccounts).UpdateAll(
+		bson.M{"teams": name},
+		bson.M{"$pull": bson.M{"teams": name}},
+	)
+	return err
+}
+
+// SetAccountTeams replaces the teams of the account
+func (m *Manager) SetAccountTeams(username string, teams []string) error {
+	for _, t := range teams {
+		if _, err := m.Team(t); err != nil {
+			return err
+		}
+	}
+	if err := m.mgoDB.C(tblNameAccounts).UpdateId(username, bson.M{"$set": bson.M{"teams": teams}}); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrAccountDoesNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+// TeamScope returns the teams whose containers the account sees; all is
+// true when its role sees the containers of every team
+func (m *Manager) TeamScope(username string) (teams []string, all bool, err error) {
+	account, err := m.Account(username)
+	if err != nil {
+		return nil, false, err
+	}
+	all, err = m.Permitted(username, PermContainersAllTeams)
+	if err != nil {
+		return nil, false, err
+	}
+	return account.Teams, all, nil
+}
+
+// TeamContainers returns the containers owned by one of the teams
+func TeamContainers(containers []*cluster.Container, teams []string) []*cluster.Container {
+	out := []*cluster.Container{}
+	for _, c := range containers {
+		if c.Image != nil && InTeams(c.Image.Team, teams) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// InTeams returns true if the team is one of the teams; containers without
+// a team are in none
+func InTeams(team string, teams []string) bool {
+	if team == "" {
+		return false
+	}
+	for _, t := range teams {
+		if t == team {
+			return true
+		}
+	}
+	return false
+}
+
+// nameTeams maps the names of the kind to the team owning them
+func (m *Manager) nameTeams(kind string) (map[string]string, error) {
+	names := []*teamName{}
+	if err := m.mgoDB.C(tblNameTeamNames).Find(bson.M{"kind": kind}).All(&names); err != nil {
+		return nil, err
+	}
+	teams := make(map[string]string, len(names))
+	for _, n := range names {
+		teams[n.Name] = n.Team
+	}
+	return teams, nil
+}
+
+// nameTeam returns the team owning the name of the kind; none if the name
+// has no owner
+func (m *Manager) nameTeam(kind, name string) (string, error) {
+	var n *teamName
+	if err := m.mgoDB.C(tblNameTeamNames).FindId(kind + "/" + name).One(&n); err != nil {
+		if err == mgo.ErrNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	return n.Team, nil
+}
+
+// claimName records the team as the owner of the name of the kind; names
+// owned by another team cannot be claimed. Names created without a team
+// have no owner.
+func (m *Manager) claimName(kind, name, team string) error {
+	owner, err := m.nameTeam(kind, name)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != team {
+		return ErrTeamNameTaken
+	}
+	if team == "" || owner == team {
+		return nil
+	}
+	_, err = m.mgoDB.C(tblNameTeamNames).UpsertId(kind+"/"+name, &teamName{
+		ID:   kind + "/" + name,
+		Kind: kind,
+		Name: name,
+		Team: team,
+	})
+	return err
+}
+
+// releaseName removes the owner of the name of the kind
+func (m *Manager) releaseName(kind, name string) error {
+	if err := m.mgoDB.C(tblNameTeamNames).RemoveId(kind + "/" + name); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// TeamNetworks returns the networks of one of the teams and the networks
+// docker creates on every engine
+func (m *Manager) TeamNetworks(networks []*cluster.Network, teams []string) ([]*cluster.Network, error) {
+	owners, err := m.nameTeams(teamNameNetwork)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []*cluster.Network{}
+	for _, n := range networks {
+		if cluster.IsBuiltinNetwork(n.Name) || InTeams(owners[n.Name], teams) {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// TeamVolumes returns the volumes of one of the teams: the volumes created
+// for one of the teams and the volumes without an owner on an engine of the
+// pool of one of the teams that are mounted only by containers of the teams
+func (m *Manager) TeamVolumes(volumes []*cluster.Volume, teams []string) ([]*cluster.Volume, error) {
+	owners, err := m.nameTeams(teamNameVolume)
+	if err != nil {
+		return nil, err
+	}
+
+	pools := [][]string{}
+	for _, t := range teams {
+		labels, err := m.teamLabels(t)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, labels)
+	}
+
+	containerTeams := make(map[string]string)
+	for _, c := range m.Containers(true) {
+		if c.Image != nil {
+			containerTeams[c.ID] = c.Image.Team
+		}
+	}
+
+	out := []*cluster.Volume{}
+	for _, v := range volumes {
+		if owner, ok := owners[v.Name]; ok {
+			if InTeams(owner, teams) {
+				out = append(out, v)
+			}
+			continue
+		}
+
+		inPool := false
+		for _, labels := range pools {
+			if v.Engine != nil && v.Engine.HasLabels(labels) {
+				inPool = true
+				break
+			}
+		}
+		if !inPool {
+			continue
+		}
+
+		// a volume nobody mounts could be anyone's
+		mounted := len(v.Containers) > 0
+		for _, id := range v.Containers {
+			if !InTeams(containerTeams[id], teams) {
+				mounted = false
+				break
+			}
+		}
+		if mounted {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// applyTeam constrains the image to the engine pool of its team and checks
+// the secrets, named volumes and networks it uses are not another team's
+func (m *Manager) applyTeam(image *cluster.Image) error {
+	labels, err := m.teamLabels(image.Team)
+	if err != nil {
+		return err
+	}
+	if err := m.checkTeamResources(image); err != nil {
+		return err
+	}
+
+	for _, l := range labels {
+		if !hasLabel(image.Labels, l) {
+			image.Labels = append(image.Labels, l)
+		}
+	}
+	return nil
+}
+
+// checkTeamResources returns ErrNotTeamResource if the image references a
+// secret, named volume or network of another team
+func (m *Manager) checkTeamResources(image *cluster.Image) error {
+	for _, name := range image.Secrets {
+		secret, err := m.Secret(name)
+		if err != nil {
+			return err
+		}
+		if secret.Team != image.Team {
+			return ErrNotTeamResource
+		}
+	}
+
+	for _, name := range image.NamedVolumes() {
+		if err := m.checkNameTeam(teamNameVolume, name, image.Team); err != nil {
+			return err
+		}
+	}
+
+	networks := []string{image.NetworkMode}
+	for _, n := range image.Networks {
+		if n != nil {
+			networks = append(networks, n.Name)
+		}
+	}
+	for _, name := range networks {
+		if name == "" || name == "default" || cluster.IsBuiltinNetwork(name) || strings.HasPrefix(name, "container:") {
+			continue
+		}
+		if err := m.checkNameTeam(teamNameNetwork, name, image.Team); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNameTeam returns ErrNotTeamResource if the name of the kind is owned
+// by a team other than the given one
+func (m *Manager) checkNameTeam(kind, name, team string) error {
+	owner, err := m.nameTeam(kind, name)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != team {
+		return ErrNotTeamResource
+	}
+	return nil
+}
+
+// teamLabels returns the engine labels of the pool of the team; none
+// without a team
+func (m *Manager) teamLabels(name string) ([]string, error) {
+	if name == "" {
+		return nil, nil
+	}
+	team, err := m.Team(name)
+	if err != nil {
+		return nil, err
+	}
+	return team.EngineLabels, nil
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/yleemj/dockerMan"
+)
+
+func TestTeamSecrets(t *testing.T) {
+	secrets := []*dockerMan.Secret{
+		{Name: "db-password", Team: "payments"},
+		{Name: "api-key", Team: "search"},
+		{Name: "registry"},
+	}
+
+	visible := TeamSecrets(secrets, []string{"payments"})
+	if len(visible) != 1 || visible[0].Name != "db-password" {
+		t.Fatalf("expected only the payments secret, got %v", visible)
+	}
+
+	if visible := TeamSecrets(secrets, nil); len(visible) != 0 {
+		t.Fatalf("expected no secrets without a team, got %v", visible)
+	}
+}
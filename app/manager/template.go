@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/cluster"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrTemplateDoesNotExist = errors.New("template does not exist")
+	ErrTemplateConflict     = errors.New("template was updated concurrently; retry")
+	ErrTemplateInvalid      = errors.New("template requires a name and an image")
+)
+
+// Templates returns the latest version of every template
+func (m *Manager) Templates() ([]*dockerMan.Template, error) {
+	all := []*dockerMan.Template{}
+	if err := m.mgoDB.C(tblNameTemplates).Find(nil).Sort("name", "-version").All(&all); err != nil {
+		return nil, err
+	}
+
+	return latestTemplates(all), nil
+}
+
+// latestTemplates returns the first version of each name out of templates
+// sorted by name and newest version first
+func latestTemplates(all []*dockerMan.Template) []*dockerMan.Template {
+	templates := []*dockerMan.Template{}
+	for _, t := range all {
+		if n := len(templates); n > 0 && templates[n-1].Name == t.Name {
+			continue
+		}
+		templates = append(templates, t)
+	}
+	return templates
+}
+
+// Template returns a version of the named template; the latest if version is 0
+func (m *Manager) Template(name string, version int) (*dockerMan.Template, error) {
+	q := bson.M{"name": name}
+	if version > 0 {
+		q["version"] = version
+	}
+
+	var template *dockerMan.Template
+	if err := m.mgoDB.C(tblNameTemplates).Find(q).Sort("-version").One(&template); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrTemplateDoesNotExist
+		}
+		return nil, err
+	}
+	return template, nil
+}
+
+// TemplateVersions returns every version of the named template, newest first
+func (m *Manager) TemplateVersions(name string) ([]*dockerMan.Template, error) {
+	templates := []*dockerMan.Template{}
+	if err := m.mgoDB.C(tblNameTemplates).Find(bson.M{"name": name}).Sort("-version").All(&templates); err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, ErrTemplateDoesNotExist
+	}
+	return templates, nil
+}
+
+// SaveTemplate stores the template as the next version of its name
+func (m *Manager) SaveTemplate(template *dockerMan.Template) error {
+	if err := validateTemplate(template); err != nil {
+		return err
+	}
+
+	template.Version = 1
+	latest, err := m.Template(template.Name, 0)
+	switch err {
+	case nil:
+		template.Version = latest.Version + 1
+	case ErrTemplateDoesNotExist:
+	default:
+		return err
+	}
+
+	template.ID = generateId(16)
+	template.Created = time.Now()
+	// the containers are owned by whoever runs the template
+	template.Image.Owner = ""
+
+	if err := m.mgoDB.C(tblNameTemplates).Insert(template); err != nil {
+		if mgo.IsDup(err) {
+			return ErrTemplateConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func validateTemplate(template *dockerMan.Template) error {
+	if template.Name == "" || template.Image == nil || template.Image.Name == "" {
+		return ErrTemplateInvalid
+	}
+	if err := cluster.ValidatePullPolicy(template.Image.PullPolicy); err != nil {
+		return err
+	}
+	return cluster.ValidateDockerLabels(template.Image.DockerLabels)
+}
+
+// DeleteTemplate removes a version of the named template, or every version if version is 0
+func (m *Manager) DeleteTemplate(name string, version int) error {
+	q := bson.M{"name": name}
+	if version > 0 {
+		q["version"] = version
+	}
+
+	info, err := m.mgoDB.C(tblNameTemplates).RemoveAll(q)
+	if err != nil {
+		return err
+	}
+	if info.Removed == 0 {
+		return ErrTemplateDoesNotExist
+	}
+	return nil
+}
+
+// RunTemplate launches the named template with the overrides applied
+func (m *Manager) RunTemplate(name string, overrides *dockerMan.TemplateOverrides, username string) ([]*cluster.Container, error) {
+	if overrides == nil {
+		overrides = &dockerMan.TemplateOverrides{}
+	}
+
+	template, err := m.Template(name, overrides.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	image, count := applyOverrides(template, overrides, username)
+
+	logger.Infof("running template %s version %d", template.Name, template.Version)
+
+	return m.Run(image, count, overrides.ResolveDigest)
+}
+
+// applyOverrides returns the image and container count of the template with
+// the overrides applied, owned by the account running it
+func applyOverrides(template *dockerMan.Template, overrides *dockerMan.TemplateOverrides, username string) (*cluster.Image, int) {
+	// copy the image so overrides never leak into the stored template
+	image := *template.Image
+	image.Environment = make(map[string]string)
+	for k, v := range template.Image.Environment {
+		image.Environment[k] = v
+	}
+	for k, v := range overrides.Environment {
+		image.Environment[k] = v
+	}
+	if overrides.Args != nil {
+		image.Args = overrides.Args
+	}
+	image.Team = overrides.Team
+	image.Owner = username
+
+	count := 1
+	if template.Count > 0 {
+		count = template.Count
+	}
+	if overrides.Count > 0 {
+		count = overrides.Count
+	}
+
+	return &image, count
+}
@@ -0,0 +1,77 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	cases := []struct {
+		template *dockerMan.Template
+		err      error
+	}{
+		{&dockerMan.Template{Name: "web", Image: &cluster.Image{Name: "nginx"}}, nil},
+		{&dockerMan.Template{Image: &cluster.Image{Name: "nginx"}}, ErrTemplateInvalid},
+		{&dockerMan.Template{Name: "web"}, ErrTemplateInvalid},
+		{&dockerMan.Template{Name: "web", Image: &cluster.Image{}}, ErrTemplateInvalid},
+		{&dockerMan.Template{Name: "web", Image: &cluster.Image{Name: "nginx", PullPolicy: "sometimes"}}, cluster.ErrUnknownPullPolicy},
+		{&dockerMan.Template{Name: "web", Image: &cluster.Image{Name: "nginx", DockerLabels: map[string]string{cluster.LabelTeam: "admins"}}}, cluster.ErrReservedLabel},
+	}
+
+	for _, c := range cases {
+		if err := validateTemplate(c.template); err != c.err {
+			t.Errorf("expected %v for %+v; received %v", c.err, c.template, err)
+		}
+	}
+}
+
+func TestLatestTemplates(t *testing.T) {
+	all := []*dockerMan.Template{
+		{Name: "db", Version: 1},
+		{Name: "web", Version: 3},
+		{Name: "web", Version: 2},
+		{Name: "web", Version: 1},
+	}
+
+	latest := latestTemplates(all)
+	if len(latest) != 2 || latest[0] != all[0] || latest[1] != all[1] {
+		t.Fatalf("expected the latest version of each template; received %v", latest)
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	template := &dockerMan.Template{
+		Name:  "web",
+		Count: 2,
+		Image: &cluster.Image{
+			Name:        "nginx",
+			Owner:       "mallory",
+			Args:        []string{"serve"},
+			Environment: map[string]string{"MODE": "prod", "LANG": "C"},
+		},
+	}
+
+	image, count := applyOverrides(template, &dockerMan.TemplateOverrides{}, "alice")
+	if count != 2 || image.Team != "" || image.Owner != "alice" || !reflect.DeepEqual(image.Args, []string{"serve"}) {
+		t.Fatalf("expected the template values; received %d %+v", count, image)
+	}
+
+	image, count = applyOverrides(template, &dockerMan.TemplateOverrides{
+		Environment: map[string]string{"MODE": "dev"},
+		Args:        []string{"serve", "--debug"},
+		Count:       3,
+		Team:        "payments",
+	}, "bob")
+	expected := map[string]string{"MODE": "dev", "LANG": "C"}
+	if count != 3 || image.Team != "payments" || image.Owner != "bob" || !reflect.DeepEqual(image.Environment, expected) || !reflect.DeepEqual(image.Args, []string{"serve", "--debug"}) {
+		t.Fatalf("expected the overrides to be applied; received %d %+v", count, image)
+	}
+
+	// the stored template is left untouched
+	if template.Image.Environment["MODE"] != "prod" || len(template.Image.Args) != 1 || template.Image.Team != "" {
+		t.Fatalf("expected the template not to change; received %+v", template.Image)
+	}
+}
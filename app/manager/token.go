@@ -0,0 +1,149 @@
+package manager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yleemj/dockerMan"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// tokenUsageInterval limits how often the last used time of a token
+	// is written
+	tokenUsageInterval = time.Minute
+)
+
+var (
+	ErrTokenDoesNotExist = errors.New("access token does not exist")
+	ErrInvalidToken      = errors.New("invalid or expired access token")
+	ErrUsernameRequired  = errors.New("username is required")
+)
+
+// CreateToken creates an access token for the account. The token is only
+// returned here; it is stored hashed and cannot be read back.
+func (m *Manager) CreateToken(username, description string, expires time.Time) (*dockerMan.AccessToken, error) {
+	if _, err := m.Account(username); err != nil {
+		return nil, err
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &dockerMan.AccessToken{
+		ID:          id,
+		Username:    username,
+		Description: description,
+		Hash:        hashToken(secret),
+		Expires:     expires,
+		Created:     time.Now(),
+	}
+	if err := m.mgoDB.C(tblNameTokens).Insert(token); err != nil {
+		return nil, err
+	}
+
+	// the id prefix finds the token without scanning every hash
+	token.Token = id + "." + secret
+	return token, nil
+}
+
+// Tokens returns the access tokens of the account
+func (m *Manager) Tokens(username string) ([]*dockerMan.AccessToken, error) {
+	if username == "" {
+		return nil, ErrUsernameRequired
+	}
+
+	tokens := []*dockerMan.AccessToken{}
+	if err := m.mgoDB.C(tblNameTokens).Find(bson.M{"username": username}).Sort("-created").All(&tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (m *Manager) Token(id string) (*dockerMan.AccessToken, error) {
+	var token *dockerMan.AccessToken
+	if err := m.mgoDB.C(tblNameTokens).FindId(id).One(&token); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrTokenDoesNotExist
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (m *Manager) RevokeToken(id string) error {
+	if err := m.mgoDB.C(tblNameTokens).RemoveId(id); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrTokenDoesNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+// AuthenticateToken returns the account of a valid, unexpired access token
+// and records its use
+func (m *Manager) AuthenticateToken(value string) (*dockerMan.Account, error) {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := m.Token(parts[0])
+	if err != nil {
+		if err == ErrTokenDoesNotExist {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashToken(parts[1]))) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if !token.Expires.IsZero() && now.After(token.Expires) {
+		return nil, ErrInvalidToken
+	}
+
+	account, err := m.Account(token.Username)
+	if err != nil {
+		if err == ErrAccountDoesNotExist {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if now.Sub(token.LastUsed) > tokenUsageInterval {
+		if err := m.mgoDB.C(tblNameTokens).UpdateId(token.ID, bson.M{"$set": bson.M{"last_used": now}}); err != nil {
+			logger.Warnf("error recording use of token %s: %s", token.ID, err)
+		}
+	}
+	return account, nil
+}
+
+// hashToken hashes the secret of a token; the secrets are random so a
+// plain digest is enough
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+// Volumes returns the named volumes of the engine, or of every engine when
+// engineID is empty
+func (m *Manager) Volumes(engineID string) ([]*cluster.Volume, error) {
+	return m.clusterManager.Volumes(engineID)
+}
+
+// Volume returns the named volume on the engines holding it
+func (m *Manager) Volume(name, engineID string) ([]*cluster.Volume, error) {
+	return m.clusterManager.Volume(name, engineID)
+}
+
+// CreateVolume creates the volume on the engines selected by the config in
+// the engine pool of the team; the team owns the volume name. Names of
+// volumes that exist without an owner cannot be taken by a team as docker
+// hands back the existing volume.
+func (m *Manager) CreateVolume(config *cluster.VolumeConfig, team string) ([]*cluster.Volume, error) {
+	labels, err := m.teamLabels(team)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		if !hasLabel(config.Labels, l) {
+			config.Labels = append(config.Labels, l)
+		}
+	}
+
+	owner, err := m.nameTeam(teamNameVolume, config.Name)
+	if err != nil {
+		return nil, err
+	}
+	if owner != "" && owner != team {
+		return nil, ErrTeamNameTaken
+	}
+	if owner == "" && team != "" {
+		if _, err := m.clusterManager.Volume(config.Name, ""); err != cluster.ErrVolumeDoesNotExist {
+			if err == nil {
+				return nil, ErrTeamNameTaken
+			}
+			return nil, err
+		}
+	}
+
+	created, err := m.clusterManager.CreateVolume(config)
+	if len(created) > 0 {
+		if cerr := m.claimName(teamNameVolume, config.Name, team); cerr != nil {
+			return created, cerr
+		}
+	}
+	return created, err
+}
+
+// RemoveVolume removes the volume from the engine, or from every engine
+// holding it when engineID is empty; the name loses its owner once no
+// engine holds it
+func (m *Manager) RemoveVolume(name, engineID string) ([]*cluster.Volume, error) {
+	removed, err := m.clusterManager.RemoveVolume(name, engineID)
+	if err != nil {
+		return removed, err
+	}
+	if _, err := m.clusterManager.Volume(name, ""); err == cluster.ErrVolumeDoesNotExist {
+		return removed, m.releaseName(teamNameVolume, name)
+	}
+	return removed, nil
+}
@@ -0,0 +1,332 @@
+// Package manifest diffs a declared set of services against the containers
+// running in the cluster.
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	ActionAdd    = "add"
+	ActionChange = "change"
+	ActionRemove = "remove"
+)
+
+var (
+	validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+type (
+	// Manifest is the desired state of the cluster
+	Manifest struct {
+		Services map[string]*Service `json:"services"`
+	}
+
+	// Service is a number of identical containers of an image
+	Service struct {
+		// Replicas is the number of containers to run; 1 if not set
+		Replicas *int `json:"replicas,omitempty"`
+
+		// Image is the configuration of every container of the service
+		Image *cluster.Image `json:"image"`
+	}
+
+	// Change is a single step to bring the cluster to the manifest
+	Change struct {
+		Action  string `json:"action"`
+		Service string `json:"service,omitempty"`
+
+		// Container and Engine identify the existing container that is
+		// replaced or removed
+		Container string `json:"container,omitempty"`
+		Engine    string `json:"engine,omitempty"`
+
+		// Image is the configuration started for an add or change
+		Image *cluster.Image `json:"image,omitempty"`
+
+		Reason string `json:"reason,omitempty"`
+
+		// Started is the id of the container started when the change is applied
+		Started string `json:"started,omitempty"`
+
+		// Error is set if applying the change failed
+		Error string `json:"error,omitempty"`
+	}
+
+	// Plan is the list of changes between the manifest and the cluster
+	Plan struct {
+		Changes []*Change `json:"changes"`
+
+		// Unchanged is the number of containers already matching the manifest
+		Unchanged int `json:"unchanged"`
+	}
+)
+
+// Parse reads a manifest in yaml or json; json is read as yaml
+func Parse(data []byte) (*Manifest, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	// the cluster types only carry json tags, so decode through json
+	buf, err := json.Marshal(jsonValue(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return nil, err
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// jsonValue converts the maps yaml decodes into maps json can encode
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[fmt.Sprint(k)] = jsonValue(val)
+		}
+		return out
+	case []interface{}:
+		for i, val := range t {
+			t[i] = jsonValue(val)
+		}
+	}
+	return v
+}
+
+// Validate returns an error if a service cannot be run
+func (m *Manifest) Validate() error {
+	if len(m.Services) == 0 {
+		return fmt.Errorf("no services defined")
+	}
+
+	for name, s := range m.Services {
+		if !validName.MatchString(name) {
+			return fmt.Errorf("invalid service name %q", name)
+		}
+		if s == nil || s.Image == nil || s.Image.Name == "" {
+			return fmt.Errorf("service %s: image name is required", name)
+		}
+		if _, err := cluster.ParseImageReference(s.Image.Name); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+		if err := cluster.ValidatePullPolicy(s.Image.PullPolicy); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+		if err := cluster.ValidateDockerLabels(s.Image.DockerLabels); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+		if s.Count() < 0 {
+			return fmt.Errorf("service %s: replicas must not be negative", name)
+		}
+		if s.Image.ContainerName != "" && s.Count() > 1 {
+			return fmt.Errorf("service %s: container_name can only be used with a single replica", name)
+		}
+	}
+	return nil
+}
+
+// Count returns the number of replicas of the service
+func (s *Service) Count() int {
+	if s.Replicas == nil {
+		return 1
+	}
+	return *s.Replicas
+}
+
+// Hash identifies the service definition; containers started from an
+// earlier definition have a different hash
+func (s *Service) Hash() string {
+	data, _ := json.Marshal(s.Image)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// image returns the image to start for the service, marked with the service
+// name and definition hash
+func (s *Service) image(name string) *cluster.Image {
+	i := *s.Image
+	i.Service = name
+	i.Spec = s.Hash()
+	return &i
+}
+
+// Diff returns the changes that bring the containers to the manifest. The
+// containers of services no longer in the manifest are always removed;
+// containers never started from a manifest are only removed with prune.
+func Diff(m *Manifest, containers []*cluster.Container, prune bool) *Plan {
+	var (
+		plan      = &Plan{Changes: []*Change{}}
+		byService = make(map[string][]*cluster.Container)
+		services  = []string{}
+	)
+
+	for _, c := range containers {
+		name := c.Image.Service
+		byService[name] = append(byService[name], c)
+	}
+
+	for name := range m.Services {
+		services = append(services, name)
+	}
+	for name := range byService {
+		if _, ok := m.Services[name]; !ok && name != "" {
+			services = append(services, name)
+		}
+	}
+	sort.Strings(services)
+
+	for _, name := range services {
+		current := byService[name]
+
+		s, ok := m.Services[name]
+		if !ok {
+			sort.Sort(byRank{current, ""})
+			for _, c := range current {
+				plan.Changes = append(plan.Changes, removal(name, c, "service is not in the manifest"))
+			}
+			continue
+		}
+
+		var (
+			hash    = s.Hash()
+			desired = s.Count()
+		)
+		// keep the containers already matching the service when scaling down
+		sort.Sort(byRank{current, hash})
+		for i, c := range current {
+			if i >= desired {
+				plan.Changes = append(plan.Changes, removal(name, c, "scaled down"))
+				continue
+			}
+
+			reason := ""
+			switch {
+			case c.Image.Spec != hash && c.Image.Name != s.Image.Name:
+				reason = fmt.Sprintf("image %s changed to %s", c.Image.Name, s.Image.Name)
+			case c.Image.Spec != hash:
+				reason = "configuration changed"
+			case c.State != "running":
+				reason = fmt.Sprintf("container is %s", c.State)
+			}
+			if reason == "" {
+				plan.Unchanged++
+				continue
+			}
+
+			plan.Changes = append(plan.Changes, &Change{
+				Action:    ActionChange,
+				Service:   name,
+				Container: c.ID,
+				Engine:    c.Engine.ID,
+				Image:     s.image(name),
+				Reason:    reason,
+			})
+		}
+
+		for i := len(current); i < desired; i++ {
+			plan.Changes = append(plan.Changes, &Change{
+				Action:  ActionAdd,
+				Service: name,
+				Image:   s.image(name),
+				Reason:  fmt.Sprintf("replica %d of %d", i+1, desired),
+			})
+		}
+	}
+
+	if prune {
+		unmanaged := byService[""]
+		sort.Sort(byRank{unmanaged, ""})
+		for _, c := range unmanaged {
+			plan.Changes = append(plan.Changes, removal("", c, "not managed by the manifest"))
+		}
+	}
+
+	return plan
+}
+
+func removal(service string, c *cluster.Container, reason string) *Change {
+	return &Change{
+		Action:    ActionRemove,
+		Service:   service,
+		Container: c.ID,
+		Engine:    c.Engine.ID,
+		Reason:    reason,
+	}
+}
+
+func (c *Change) String() string {
+	var (
+		symbol = "~"
+		target = c.Container
+	)
+
+	switch c.Action {
+	case ActionAdd:
+		symbol, target = "+", c.Image.Name
+	case ActionRemove:
+		symbol = "-"
+	}
+	if c.Service != "" {
+		target = c.Service + " " + target
+	}
+
+	s := fmt.Sprintf("%s %s (%s)", symbol, target, c.Reason)
+	if c.Error != "" {
+		s += ": " + c.Error
+	}
+	return s
+}
+
+// byRank orders up to date containers first, then running ones, then by id
+type byRank struct {
+	containers []*cluster.Container
+	hash       string
+}
+
+func (r byRank) rank(c *cluster.Container) int {
+	n := 0
+	if r.hash == "" || c.Image.Spec != r.hash {
+		n += 2
+	}
+	if c.State != "running" {
+		n++
+	}
+	return n
+}
+
+func (r byRank) Len() int {
+	return len(r.containers)
+}
+
+func (r byRank) Swap(i, j int) {
+	r.containers[i], r.containers[j] = r.containers[j], r.containers[i]
+}
+
+func (r byRank) Less(i, j int) bool {
+	ri, rj := r.rank(r.containers[i]), r.rank(r.containers[j])
+	if ri != rj {
+		return ri < rj
+	}
+	return r.containers[i].ID < r.containers[j].ID
+}
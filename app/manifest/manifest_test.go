@@ -0,0 +1,156 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+const testManifest = `
+services:
+  web:
+    replicas: 2
+    image:
+      name: team/web:2
+      memory: 256
+      environment:
+        MODE: production
+  cache:
+    image:
+      name: redis
+`
+
+func container(id, state string, image *cluster.Image) *cluster.Container {
+	image.Name = "team/web:1"
+	return &cluster.Container{
+		ID:     id,
+		State:  state,
+		Engine: &cluster.Engine{ID: "engine-1"},
+		Image:  image,
+	}
+}
+
+func managed(m *Manifest, service string) *cluster.Image {
+	return m.Services[service].image(service)
+}
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := m.Services["web"]
+	if web.Count() != 2 || web.Image.Memory != 256 || web.Image.Environment["MODE"] != "production" {
+		t.Fatalf("unexpected web service %+v %+v", web, web.Image)
+	}
+	if m.Services["cache"].Count() != 1 {
+		t.Fatalf("expected the default of one replica; received %d", m.Services["cache"].Count())
+	}
+
+	json := `{"services": {"web": {"replicas": 0, "image": {"name": "team/web"}}}}`
+	if m, err = Parse([]byte(json)); err != nil {
+		t.Fatal(err)
+	}
+	if m.Services["web"].Count() != 0 {
+		t.Fatalf("expected zero replicas; received %d", m.Services["web"].Count())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"services:\n  web:\n    image:\n      memory: 1\n",
+		"services:\n  web:\n    image:\n      name: Web\n",
+		"services:\n  web:\n    image:\n      name: web\n      unknown: 1\n",
+		"services:\n  web:\n    replicas: -1\n    image:\n      name: web\n",
+		"services:\n  web:\n    replicas: 2\n    image:\n      name: web\n      container_name: web\n",
+		"services:\n  web:\n    image:\n      name: web\n      pull_policy: sometimes\n",
+		"services:\n  '-web':\n    image:\n      name: web\n",
+		"services:\n  web:\n    image:\n      name: web\n      docker_labels:\n        com.dockerman.spec: abc\n",
+	}
+
+	for _, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	m, err := Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outdated := managed(m, "web")
+	outdated.Spec = "0000000000000000"
+
+	containers := []*cluster.Container{
+		container("a", "running", managed(m, "web")),
+		container("b", "running", outdated),
+		container("c", "running", &cluster.Image{Service: "old"}),
+		container("d", "running", &cluster.Image{}),
+	}
+
+	plan := Diff(m, containers, false)
+	if plan.Unchanged != 1 {
+		t.Errorf("expected one unchanged container; received %d", plan.Unchanged)
+	}
+
+	expected := []struct {
+		action    string
+		service   string
+		container string
+	}{
+		{ActionAdd, "cache", ""},
+		{ActionRemove, "old", "c"},
+		{ActionChange, "web", "b"},
+	}
+	if len(plan.Changes) != len(expected) {
+		t.Fatalf("expected %d changes; received %v", len(expected), plan.Changes)
+	}
+	for i, e := range expected {
+		c := plan.Changes[i]
+		if c.Action != e.action || c.Service != e.service || c.Container != e.container {
+			t.Errorf("change %d: expected %s %s %s; received %s", i, e.action, e.service, e.container, c)
+		}
+	}
+
+	change := plan.Changes[2]
+	if change.Image.Service != "web" || change.Image.Spec != m.Services["web"].Hash() {
+		t.Errorf("expected the started image to be marked; received %+v", change.Image)
+	}
+	if change.Reason != "image team/web:1 changed to team/web:2" {
+		t.Errorf("unexpected reason %q", change.Reason)
+	}
+
+	plan = Diff(m, containers, true)
+	last := plan.Changes[len(plan.Changes)-1]
+	if last.Action != ActionRemove || last.Container != "d" {
+		t.Errorf("expected prune to remove the unmanaged container; received %s", last)
+	}
+}
+
+func TestDiffScaleDown(t *testing.T) {
+	m, err := Parse([]byte("services:\n  web:\n    replicas: 1\n    image:\n      name: team/web:2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers := []*cluster.Container{
+		container("a", "stopped", managed(m, "web")),
+		container("b", "running", managed(m, "web")),
+		container("c", "running", &cluster.Image{Service: "web"}),
+	}
+
+	plan := Diff(m, containers, false)
+	if plan.Unchanged != 1 || len(plan.Changes) != 2 {
+		t.Fatalf("expected to keep one container and remove two; received %d unchanged %v", plan.Unchanged, plan.Changes)
+	}
+	for _, c := range plan.Changes {
+		if c.Action != ActionRemove || c.Container == "b" {
+			t.Errorf("unexpected change %s", c)
+		}
+	}
+}
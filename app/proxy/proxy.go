@@ -0,0 +1,274 @@
+// Package proxy routes http requests by host and path to the published ports
+// of the containers running an image or service.
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/cluster"
+	"github.com/yleemj/dockerMan/app/discovery"
+)
+
+var (
+	logger = logrus.New()
+)
+
+// route is a route with the backends of its running containers
+type route struct {
+	*dockerMan.Route
+
+	backends []*url.URL
+
+	// next is the index of the backend of the next request
+	next uint32
+}
+
+// Proxy is an http handler sending each request to a backend of the most
+// specific matching route, round robin across the backends
+type Proxy struct {
+	mux    sync.RWMutex
+	routes []*route
+}
+
+func New() *Proxy {
+	return &Proxy{}
+}
+
+// Update replaces the routes and finds their backends in the containers;
+// backends of containers that are no longer running are dropped
+func (p *Proxy) Update(routes []*dockerMan.Route, containers []*cluster.Container) {
+	updated := []*route{}
+	for _, r := range routes {
+		updated = append(updated, &route{
+			Route:    r,
+			backends: backends(r, containers),
+		})
+	}
+	sort.Sort(bySpecificity(updated))
+
+	p.mux.Lock()
+	p.routes = updated
+	p.mux.Unlock()
+}
+
+// Backends returns the addresses of the backends of the named route
+func (p *Proxy) Backends(name string) []string {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+
+	out := []string{}
+	for _, r := range p.routes {
+		if r.Name != name {
+			continue
+		}
+		for _, b := range r.backends {
+			out = append(out, b.Host)
+		}
+	}
+	return out
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r := p.match(req)
+	if r == nil {
+		http.Error(w, "no route", http.StatusNotFound)
+		return
+	}
+	if len(r.backends) == 0 {
+		http.Error(w, fmt.Sprintf("route %s has no running containers", r.Name), http.StatusServiceUnavailable)
+		return
+	}
+
+	n := atomic.AddUint32(&r.next, 1) - 1
+	target := r.backends[int(n)%len(r.backends)]
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(out *http.Request) {
+		if r.StripPath {
+			out.URL.Path = "/" + strings.TrimLeft(strings.TrimPrefix(out.URL.Path, r.path()), "/")
+			out.URL.RawPath = ""
+		}
+		director(out)
+		out.Header.Set("X-Forwarded-Host", req.Host)
+		if req.TLS == nil {
+			out.Header.Set("X-Forwarded-Proto", "http")
+		} else {
+			out.Header.Set("X-Forwarded-Proto", "https")
+		}
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, out *http.Request, err error) {
+		logger.Warnf("proxy route %s to %s: %s", r.Name, target.Host, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	proxy.ServeHTTP(w, req)
+}
+
+// match returns the first route matching the request; the routes are
+// ordered from the most specific
+func (p *Proxy) match(req *http.Request) *route {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+
+	for _, r := range p.routes {
+		if r.Host != "" && !strings.EqualFold(r.Host, host) {
+			continue
+		}
+		if !matchPath(r.path(), req.URL.Path) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+func (r *route) path() string {
+	if r.Path == "" {
+		return "/"
+	}
+	return r.Path
+}
+
+// matchPath returns true if the path is the prefix or below it
+func matchPath(prefix, path string) bool {
+	if prefix == "/" || path == prefix {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// Overlaps returns true if a request could match both routes: their hosts
+// are the same or one matches any host, and one path is below the other
+func Overlaps(a, b *dockerMan.Route) bool {
+	if a.Host != "" && b.Host != "" && !strings.EqualFold(a.Host, b.Host) {
+		return false
+	}
+	pa, pb := (&route{Route: a}).path(), (&route{Route: b}).path()
+	return matchPath(pa, pb) || matchPath(pb, pa)
+}
+
+// backends returns the addresses of the routed port of the running
+// containers selected by the route
+func backends(r *dockerMan.Route, containers []*cluster.Container) []*url.URL {
+	out := []*url.URL{}
+	for _, c := range containers {
+		if c.State != "running" || c.Image == nil || c.Engine == nil || !selects(r, c) {
+			continue
+		}
+
+		port := routedPort(r, c)
+		if port == nil {
+			continue
+		}
+		out = append(out, &url.URL{
+			Scheme: "http",
+			Host:   net.JoinHostPort(discovery.Host(c, port), fmt.Sprint(port.Port)),
+		})
+	}
+
+	sort.Sort(byHost(out))
+	return out
+}
+
+// selects returns true if the route sends requests to the container
+func selects(r *dockerMan.Route, c *cluster.Container) bool {
+	if r.Team != "" && c.Image.Team != r.Team {
+		return false
+	}
+	if r.Service != "" && c.Image.Service != r.Service {
+		return false
+	}
+	if r.Image != "" && !matchImage(r.Image, c.Image.Name) {
+		return false
+	}
+	return r.Service != "" || r.Image != ""
+}
+
+// matchImage returns true if the image is the repository of the route, and
+// its tag if the route has one
+func matchImage(routed, image string) bool {
+	var (
+		want = cluster.ParseImageName(routed)
+		have = cluster.ParseImageName(image)
+	)
+	if want.Registry != have.Registry || want.Repository != have.Repository {
+		return false
+	}
+
+	name := routed[strings.LastIndex(routed, "/")+1:]
+	if strings.Contains(name, ":") && want.Tag != have.Tag {
+		return false
+	}
+	return true
+}
+
+// routedPort returns the published port of the container for the route
+func routedPort(r *dockerMan.Route, c *cluster.Container) *cluster.Port {
+	var port *cluster.Port
+	for _, p := range c.Ports {
+		if p.Port == 0 || (p.Proto != "" && p.Proto != "tcp") {
+			continue
+		}
+		if r.Port != 0 {
+			if p.ContainerPort == r.Port {
+				return p
+			}
+			continue
+		}
+		if port == nil || p.ContainerPort < port.ContainerPort {
+			port = p
+		}
+	}
+	return port
+}
+
+// bySpecificity orders routes with a host first, then by the longest path
+type bySpecificity []*route
+
+func (r bySpecificity) Len() int {
+	return len(r)
+}
+
+func (r bySpecificity) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+
+func (r bySpecificity) Less(i, j int) bool {
+	if (r[i].Host == "") != (r[j].Host == "") {
+		return r[i].Host != ""
+	}
+	if len(r[i].path()) != len(r[j].path()) {
+		return len(r[i].path()) > len(r[j].path())
+	}
+	return r[i].Name < r[j].Name
+}
+
+type byHost []*url.URL
+
+func (u byHost) Len() int {
+	return len(u)
+}
+
+func (u byHost) Swap(i, j int) {
+	u[i], u[j] = u[j], u[i]
+}
+
+func (u byHost) Less(i, j int) bool {
+	return u[i].Host < u[j].Host
+}
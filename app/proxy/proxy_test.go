@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/yleemj/dockerMan"
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+// backend starts a server answering with its name and the request path
+func backend(t *testing.T, name string) (*httptest.Server, int) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name + " " + r.URL.Path))
+	}))
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, port
+}
+
+func container(id, image, service, state string, port int) *cluster.Container {
+	return &cluster.Container{
+		ID:     id,
+		State:  state,
+		Engine: &cluster.Engine{ID: "local", Addr: "tcp://127.0.0.1:2375"},
+		Image:  &cluster.Image{Name: image, Service: service},
+		Ports:  []*cluster.Port{{Proto: "tcp", Port: port, ContainerPort: 80}},
+	}
+}
+
+func get(t *testing.T, p *Proxy, host, path string) (int, string) {
+	req := httptest.NewRequest("GET", "http://"+host+path, nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	body, err := ioutil.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, string(body)
+}
+
+func TestProxy(t *testing.T) {
+	web1, port1 := backend(t, "web1")
+	defer web1.Close()
+	web2, port2 := backend(t, "web2")
+	defer web2.Close()
+	api, apiPort := backend(t, "api")
+	defer api.Close()
+
+	routes := []*dockerMan.Route{
+		{Name: "web", Host: "example.com", Image: "team/web"},
+		{Name: "api", Host: "example.com", Path: "/api", StripPath: true, Service: "api"},
+		{Name: "empty", Path: "/empty", Image: "team/none"},
+	}
+	containers := []*cluster.Container{
+		container("a", "team/web:1", "", "running", port1),
+		container("b", "team/web:2", "", "running", port2),
+		container("c", "team/web:1", "", "stopped", port2),
+		container("d", "team/api", "api", "running", apiPort),
+	}
+
+	p := New()
+	p.Update(routes, containers)
+
+	if backends := p.Backends("web"); len(backends) != 2 {
+		t.Fatalf("expected the two running web containers; received %v", backends)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		code, body := get(t, p, "example.com:8080", "/index.html")
+		if code != http.StatusOK {
+			t.Fatalf("expected 200; received %d %s", code, body)
+		}
+		seen[body] = true
+	}
+	if !seen["web1 /index.html"] || !seen["web2 /index.html"] {
+		t.Fatalf("expected requests to be balanced across the replicas; received %v", seen)
+	}
+
+	if code, body := get(t, p, "EXAMPLE.com", "/api/users"); code != http.StatusOK || body != "api /users" {
+		t.Fatalf("expected the api route with the path stripped; received %d %q", code, body)
+	}
+	if code, _ := get(t, p, "other.com", "/index.html"); code != http.StatusNotFound {
+		t.Fatalf("expected no route for another host; received %d", code)
+	}
+	if code, _ := get(t, p, "other.com", "/empty"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a route without containers to be unavailable; received %d", code)
+	}
+
+	// the web replicas stopped
+	p.Update(routes, containers[3:])
+	if code, _ := get(t, p, "example.com", "/"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the stopped backends to be removed; received %d", code)
+	}
+}
+
+func TestRouteTeam(t *testing.T) {
+	payments := container("a", "team/web:1", "", "running", 8080)
+	payments.Image.Team = "payments"
+	other := container("b", "team/web:1", "", "running", 8081)
+	other.Image.Team = "search"
+
+	p := New()
+	p.Update([]*dockerMan.Route{
+		{Name: "web", Image: "team/web", Team: "payments"},
+		{Name: "all", Image: "team/web"},
+	}, []*cluster.Container{payments, other})
+
+	if backends := p.Backends("web"); len(backends) != 1 || backends[0] != "127.0.0.1:8080" {
+		t.Fatalf("expected only the container of the team; received %v", backends)
+	}
+	if backends := p.Backends("all"); len(backends) != 2 {
+		t.Fatalf("expected the containers of every team; received %v", backends)
+	}
+}
+
+func TestMatchImage(t *testing.T) {
+	tests := []struct {
+		routed, image string
+		match         bool
+	}{
+		{"team/web", "team/web:1", true},
+		{"team/web:1", "team/web:1", true},
+		{"team/web:1", "team/web:2", false},
+		{"redis", "docker.io/library/redis:3", true},
+		{"localhost:5000/web", "localhost:5000/web:1", true},
+		{"team/web", "team/api", false},
+	}
+
+	for _, test := range tests {
+		if m := matchImage(test.routed, test.image); m != test.match {
+			t.Errorf("%s %s: expected %t", test.routed, test.image, test.match)
+		}
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b    dockerMan.Route
+		overlap bool
+	}{
+		{dockerMan.Route{Host: "a.example.com"}, dockerMan.Route{Host: "a.example.com", Path: "/api"}, true},
+		{dockerMan.Route{Host: "a.example.com"}, dockerMan.Route{Host: "b.example.com"}, false},
+		{dockerMan.Route{Path: "/api"}, dockerMan.Route{Host: "A.example.com", Path: "/api/v1"}, true},
+		{dockerMan.Route{Host: "a.example.com", Path: "/api"}, dockerMan.Route{Host: "a.example.com", Path: "/web"}, false},
+		{dockerMan.Route{Path: "/api"}, dockerMan.Route{Path: "/apis"}, false},
+	}
+
+	for _, test := range tests {
+		if o := Overlaps(&test.a, &test.b); o != test.overlap {
+			t.Errorf("%s%s %s%s: expected %t", test.a.Host, test.a.Path, test.b.Host, test.b.Path, test.overlap)
+		}
+		if o := Overlaps(&test.b, &test.a); o != test.overlap {
+			t.Errorf("%s%s %s%s: expected %t", test.b.Host, test.b.Path, test.a.Host, test.a.Path, test.overlap)
+		}
+	}
+}
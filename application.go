@@ -0,0 +1,32 @@
+package dockerMan
+
+import (
+	"time"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+type (
+	// Application is a group of containers deployed together from a compose file
+	Application struct {
+		Name      string                `json:"name,omitempty" bson:"_id"`
+		Services  []*ApplicationService `json:"services,omitempty" bson:"services"`
+		Compose   string                `json:"compose,omitempty" bson:"compose,omitempty"`
+		Created   time.Time             `json:"created,omitempty" bson:"created"`
+		CreatedBy string                `json:"created_by,omitempty" bson:"created_by,omitempty"`
+
+		// Team owns the containers of the application; only its members
+		// see it
+		Team string `json:"team,omitempty" bson:"team,omitempty"`
+	}
+
+	ApplicationService struct {
+		Name      string         `json:"name,omitempty" bson:"name"`
+		Container string         `json:"container,omitempty" bson:"container"`
+		Engine    string         `json:"engine,omitempty" bson:"engine"`
+		Image     *cluster.Image `json:"image,omitempty" bson:"image"`
+
+		// State is the current state of the container; it is not stored
+		State string `json:"state,omitempty" bson:"-"`
+	}
+)
@@ -0,0 +1,31 @@
+package dockerMan
+
+import "time"
+
+type (
+	AuditEvent struct {
+		Username   string    `json:"username,omitempty" bson:"username,omitempty"`
+		Time       time.Time `json:"time,omitempty" bson:"time"`
+		RemoteAddr string    `json:"remote_addr,omitempty" bson:"remote_addr,omitempty"`
+		Action     string    `json:"action,omitempty" bson:"action"`
+		Method     string    `json:"method,omitempty" bson:"method,omitempty"`
+		Path       string    `json:"path,omitempty" bson:"path,omitempty"`
+		Containers []string  `json:"containers,omitempty" bson:"containers,omitempty"`
+		Engines    []string  `json:"engines,omitempty" bson:"engines,omitempty"`
+		Body       string    `json:"body,omitempty" bson:"body,omitempty"`
+		Status     int       `json:"status,omitempty" bson:"status"`
+		Success    bool      `json:"success" bson:"success"`
+		Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	}
+
+	AuditQuery struct {
+		Username  string
+		Action    string
+		Container string
+		Engine    string
+		Since     time.Time
+		Until     time.Time
+		Skip      int
+		Limit     int
+	}
+)
@@ -1,8 +1,28 @@
 package dockerMan
 
+import "time"
+
 type (
+    // Account is a user of the controller; the password is only accepted
+    // on create and stored as a bcrypt hash
     Account struct {
-        Username string       `json:"username,omitempty" gorethink:"username"`
-        Password string       `json:"password,omitempty" gorethink:"password"`
+        Username     string    `json:"username,omitempty" bson:"_id"`
+        Password     string    `json:"password,omitempty" bson:"-"`
+        PasswordHash string    `json:"-" bson:"password"`
+        Created      time.Time `json:"created,omitempty" bson:"created"`
+
+        // Role names the permissions of the account
+        Role string `json:"role,omitempty" bson:"role,omitempty"`
+
+        // Teams are the teams whose containers the account sees
+        Teams []string `json:"teams,omitempty" bson:"teams,omitempty"`
+
+        // ServiceAccount accounts have no password and only authenticate
+        // with access tokens
+        ServiceAccount bool `json:"service_account,omitempty" bson:"service_account,omitempty"`
+
+        // SessionGeneration is raised when the password changes; sessions
+        // signed in with an earlier generation are no longer valid
+        SessionGeneration int `json:"-" bson:"session_generation,omitempty"`
     }
 )
@@ -0,0 +1,32 @@
+package dockerMan
+
+import (
+	"time"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+type (
+	// Backup is a tar archive of the volumes of a container kept in the
+	// backup directory of the controller
+	Backup struct {
+		ID            string `json:"id,omitempty" bson:"_id"`
+		Container     string `json:"container,omitempty" bson:"container"`
+		ContainerName string `json:"container_name,omitempty" bson:"container_name,omitempty"`
+		Engine        string `json:"engine,omitempty" bson:"engine"`
+
+		// Team owned the container; restores belong to it too
+		Team string `json:"team,omitempty" bson:"team,omitempty"`
+
+		// Image is the definition of the container; a restore runs it with
+		// the volumes renamed
+		Image *cluster.Image `json:"image,omitempty" bson:"image"`
+
+		// Volumes are the mount points archived
+		Volumes []string `json:"volumes,omitempty" bson:"volumes"`
+
+		Size      int64     `json:"size,omitempty" bson:"size"`
+		Created   time.Time `json:"created,omitempty" bson:"created"`
+		CreatedBy string    `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	}
+)
@@ -0,0 +1,18 @@
+package dockerMan
+
+type (
+	Registry struct {
+		ID       string `json:"id,omitempty" bson:"_id"`
+		Host     string `json:"host,omitempty" bson:"host"`
+		Username string `json:"username,omitempty" bson:"username,omitempty"`
+		Email    string `json:"email,omitempty" bson:"email,omitempty"`
+
+		// Password and Token are only accepted on create and update; they
+		// are stored encrypted and never returned by the api
+		Password string `json:"password,omitempty" bson:"-"`
+		Token    string `json:"token,omitempty" bson:"-"`
+
+		EncryptedPassword string `json:"-" bson:"password,omitempty"`
+		EncryptedToken    string `json:"-" bson:"token,omitempty"`
+	}
+)
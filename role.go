@@ -0,0 +1,14 @@
+package dockerMan
+
+type (
+	// Role is a named set of permissions assigned to accounts
+	Role struct {
+		Name        string   `json:"name,omitempty" bson:"_id"`
+		Description string   `json:"description,omitempty" bson:"description,omitempty"`
+		Permissions []string `json:"permissions,omitempty" bson:"permissions"`
+
+		// Builtin roles are defined by the controller and cannot be
+		// changed
+		Builtin bool `json:"builtin,omitempty" bson:"-"`
+	}
+)
@@ -0,0 +1,42 @@
+package dockerMan
+
+import "time"
+
+type (
+	// Route sends the requests for a host and path through the proxy to
+	// the published ports of the containers of an image or service
+	Route struct {
+		Name string `json:"name,omitempty" bson:"_id"`
+
+		// Host is matched with the request host; empty matches any host
+		Host string `json:"host,omitempty" bson:"host,omitempty"`
+
+		// Path is the prefix of the request paths routed; "/" if empty
+		Path string `json:"path,omitempty" bson:"path,omitempty"`
+
+		// StripPath removes the path prefix before the request is proxied
+		StripPath bool `json:"strip_path,omitempty" bson:"strip_path,omitempty"`
+
+		// Image selects the containers of the image; without a tag every
+		// tag of the repository matches
+		Image string `json:"image,omitempty" bson:"image,omitempty"`
+
+		// Service selects the containers of the manifest service
+		Service string `json:"service,omitempty" bson:"service,omitempty"`
+
+		// Port is the container port requests are sent to; the lowest
+		// published tcp port if not set
+		Port int `json:"port,omitempty" bson:"port,omitempty"`
+
+		// Team owns the route; only its members see it and only the
+		// containers of the team receive its requests. Routes without a
+		// team select the containers of every team.
+		Team string `json:"team,omitempty" bson:"team,omitempty"`
+
+		Updated time.Time `json:"updated,omitempty" bson:"updated"`
+
+		// Backends are the addresses currently receiving the requests; they
+		// are not stored
+		Backends []string `json:"backends,omitempty" bson:"-"`
+	}
+)
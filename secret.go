@@ -0,0 +1,21 @@
+package dockerMan
+
+import "time"
+
+type (
+	// Secret is a named value injected into containers when they start
+	Secret struct {
+		Name        string `json:"name,omitempty" bson:"_id"`
+		Description string `json:"description,omitempty" bson:"description,omitempty"`
+
+		// Team is the team whose containers may use the secret
+		Team string `json:"team,omitempty" bson:"team,omitempty"`
+
+		// Value is only accepted on create and update; it is stored
+		// encrypted and never returned by the api
+		Value          string `json:"value,omitempty" bson:"-"`
+		EncryptedValue string `json:"-" bson:"value"`
+
+		Updated time.Time `json:"updated,omitempty" bson:"updated"`
+	}
+)
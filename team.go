@@ -0,0 +1,14 @@
+package dockerMan
+
+type (
+	// Team owns containers; accounts only see the containers of their
+	// teams
+	Team struct {
+		Name        string `json:"name,omitempty" bson:"_id"`
+		Description string `json:"description,omitempty" bson:"description,omitempty"`
+
+		// EngineLabels select the engines the containers of the team run
+		// on; empty runs them on any engine
+		EngineLabels []string `json:"engine_labels,omitempty" bson:"engine_labels,omitempty"`
+	}
+)
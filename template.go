@@ -0,0 +1,34 @@
+package dockerMan
+
+import (
+	"time"
+
+	"github.com/yleemj/dockerMan/app/cluster"
+)
+
+type (
+	// Template is a named, versioned container definition; saving a
+	// template under an existing name creates a new version
+	Template struct {
+		ID          string         `json:"id,omitempty" bson:"_id"`
+		Name        string         `json:"name,omitempty" bson:"name"`
+		Version     int            `json:"version,omitempty" bson:"version"`
+		Description string         `json:"description,omitempty" bson:"description,omitempty"`
+		Image       *cluster.Image `json:"image,omitempty" bson:"image"`
+		Count       int            `json:"count,omitempty" bson:"count,omitempty"`
+		Created     time.Time      `json:"created,omitempty" bson:"created"`
+		CreatedBy   string         `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	}
+
+	// TemplateOverrides are the per launch changes applied to a template
+	TemplateOverrides struct {
+		Version       int               `json:"version,omitempty"`
+		Environment   map[string]string `json:"environment,omitempty"`
+		Args          []string          `json:"args,omitempty"`
+		Count         int               `json:"count,omitempty"`
+		ResolveDigest bool              `json:"resolve_digest,omitempty"`
+
+		// Team owns the launched containers
+		Team string `json:"team,omitempty"`
+	}
+)
@@ -0,0 +1,23 @@
+package dockerMan
+
+import "time"
+
+type (
+	// AccessToken authenticates api requests as an account without a
+	// session; only the hash of the token is stored
+	AccessToken struct {
+		ID          string `json:"id,omitempty" bson:"_id"`
+		Username    string `json:"username,omitempty" bson:"username"`
+		Description string `json:"description,omitempty" bson:"description,omitempty"`
+
+		// Token is only returned when the token is created
+		Token string `json:"token,omitempty" bson:"-"`
+		Hash  string `json:"-" bson:"hash"`
+
+		// Expires is when the token stops being accepted; zero never
+		// expires
+		Expires  time.Time `json:"expires,omitempty" bson:"expires,omitempty"`
+		LastUsed time.Time `json:"last_used,omitempty" bson:"last_used,omitempty"`
+		Created  time.Time `json:"created,omitempty" bson:"created"`
+	}
+)